@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/tutuna/echopan/internals/alerts"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/logging"
+	"github.com/tutuna/echopan/internals/models"
+	"gopkg.in/telebot.v3"
+)
+
+// newAlerter sends the alerts to alerts.chat_id, alerts are dropped when it is not set
+func (a *app) newAlerter() *alerts.Alerter {
+	opts := alerts.Options{
+		Cooldown:      a.cfg.Alerts.Cooldown,
+		FetchFailures: a.cfg.Alerts.FetchFailures,
+		Digest:        a.cfg.Alerts.Digest,
+	}
+	chatID := a.cfg.Alerts.ChatID
+	if chatID == 0 {
+		return alerts.New(nil, opts)
+	}
+	return alerts.New(func(text string) error {
+		bot, err := a.newBot()
+		if err != nil {
+			return err
+		}
+		_, err = bot.Send(&telebot.Chat{ID: chatID}, text)
+		return err
+	}, opts)
+}
+
+// raise logs the alerts that could not be delivered
+func (a *app) raise(alert alerts.Alert) {
+	if err := a.alerts.Raise(alert); err != nil {
+		slog.Warn("Error sending alert", "kind", alert.Kind, "error", err)
+	}
+}
+
+// alertFetch alerts on repeated fetch failures of the feed and on its quarantine
+func (a *app) alertFetch(feed models.Feed, err error) {
+	if err := a.alerts.FeedFetched(feed.ID, feed.Title, feed.ConsecutiveFailures, err); err != nil {
+		slog.Warn("Error sending alert", "kind", alerts.KindFeedFetch, logging.FeedID, feed.ID, "error", err)
+	}
+	if feed.Quarantined {
+		a.raise(alerts.Alert{
+			Kind: alerts.KindFeedFetch,
+			Key:  fmt.Sprintf("quarantine:%d", feed.ID),
+			Text: fmt.Sprintf("Feed %d %s is quarantined after %d failures, release it with feed release %d",
+				feed.ID, feed.Title, feed.ConsecutiveFailures, feed.ID),
+		})
+	}
+}
+
+// failItem moves an item whose download or upload failed to the failed state and alerts
+// the operators. Permission errors are alerted once per channel.
+func (a *app) failItem(feed models.Feed, item models.Item, err error) {
+	logger := slog.With(logging.FeedID, feed.ID, logging.ItemID, item.ID, logging.ChatID, feed.TgChannel)
+	logger.Error("Error publishing episode", "error", err)
+	if err := a.items.Fail(item.ID, err.Error()); err != nil {
+		logger.Error("Error marking item failed", "error", err)
+	}
+	if isPermissionError(err) {
+		a.raise(alerts.Alert{
+			Kind: alerts.KindPermission,
+			Key:  fmt.Sprintf("%s:%d", alerts.KindPermission, feed.TgChannel),
+			Text: fmt.Sprintf("Cannot post to channel %d of feed %d %s: %v", feed.TgChannel, feed.ID, feed.Title, err),
+		})
+		return
+	}
+	a.raise(alerts.Alert{
+		Kind: alerts.KindUpload,
+		Key:  fmt.Sprintf("%s:%d", alerts.KindUpload, item.ID),
+		Text: fmt.Sprintf("Upload of item %d %q of feed %d %s failed: %v", item.ID, item.Title, feed.ID, feed.Title, err),
+	})
+}
+
+// isPermissionError reports whether Telegram refused the bot access to the channel
+func isPermissionError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"forbidden", "not enough rights", "chat not found", "not a member", "kicked"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStuckItems alerts while items sit in the failed state
+func (a *app) checkStuckItems() {
+	if !a.alerts.Enabled() {
+		return
+	}
+	failed := models.ItemFailed
+	stuck, err := a.items.List(items.Filter{State: &failed})
+	if err != nil {
+		slog.Error("Error listing failed items", "error", err)
+		return
+	}
+	if len(stuck) == 0 {
+		a.alerts.Resolve(string(alerts.KindStuckItems))
+		return
+	}
+	ids := make([]string, 0, len(stuck))
+	for _, item := range stuck {
+		ids = append(ids, fmt.Sprint(item.ID))
+	}
+	a.raise(alerts.Alert{
+		Kind: alerts.KindStuckItems,
+		Key:  string(alerts.KindStuckItems),
+		Text: fmt.Sprintf("%d items are stuck in the failed state: %s. Requeue them with items requeue once fixed.",
+			len(stuck), strings.Join(ids, ", ")),
+	})
+}
+
+// flushAlerts sends the digest when it is due
+func (a *app) flushAlerts() {
+	if err := a.alerts.Flush(); err != nil {
+		slog.Warn("Error sending alert digest", "error", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/alerts"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+func TestFailItem(t *testing.T) {
+	feed := models.Feed{Model: gorm.Model{ID: 3}, Title: "Feed", TgChannel: -100}
+	a, itemRepo, _ := newFakeApp(feed)
+	var sent []string
+	a.alerts = alerts.New(func(text string) error {
+		sent = append(sent, text)
+		return nil
+	}, alerts.Options{Cooldown: time.Hour})
+	itemRepo.items = []models.Item{
+		{Model: gorm.Model{ID: 1}, Title: "First", FeedId: 3},
+		{Model: gorm.Model{ID: 2}, Title: "Second", FeedId: 3},
+	}
+
+	a.failItem(feed, itemRepo.items[0], errors.New("telegram: Request Entity Too Large (413)"))
+	assert.Equal(t, models.ItemFailed, itemRepo.items[0].TgPublished)
+	assert.Equal(t, "telegram: Request Entity Too Large (413)", itemRepo.items[0].LastError)
+	if assert.Len(t, sent, 1) {
+		assert.Contains(t, sent[0], `Upload of item 1 "First" of feed 3 Feed failed`)
+	}
+
+	denied := errors.New("telegram: Forbidden: bot is not a member of the channel chat (403)")
+	a.failItem(feed, itemRepo.items[0], denied)
+	a.failItem(feed, itemRepo.items[1], denied)
+	if assert.Len(t, sent, 2, "permission alerts are deduplicated by channel") {
+		assert.Contains(t, sent[1], "Cannot post to channel -100 of feed 3 Feed")
+	}
+}
+
+func TestIsPermissionError(t *testing.T) {
+	assert.True(t, isPermissionError(errors.New("telegram: Bad Request: chat not found (400)")))
+	assert.True(t, isPermissionError(errors.New("telegram: Bad Request: not enough rights to send audios to the chat (400)")))
+	assert.False(t, isPermissionError(errors.New("telegram: Request Entity Too Large (413)")))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/tutuna/echopan/internals/api"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+// apiService runs the actions of the HTTP API and the dashboard on the app
+type apiService struct {
+	a *app
+}
+
+func (s apiService) AddFeed(url string) (models.Feed, bool, error) {
+	return s.a.storeFeed(url)
+}
+
+// Publish publishes the next episode of the feed in the background, unless
+// the service or another request is already publishing
+func (s apiService) Publish(feedID uint) error {
+	if !s.a.publishing.TryLock() {
+		return api.ErrBusy
+	}
+	s.a.busy.Store(true)
+	go func() {
+		defer s.a.publishing.Unlock()
+		defer s.a.busy.Store(false)
+		s.a.publishOnebyFeedId(int(feedID))
+	}()
+	return nil
+}
+
+func (s apiService) Status() (api.Status, error) {
+	status := api.Status{
+		SinceLastRound: s.a.health.SinceBeat().Seconds(),
+		Publishing:     s.a.busy.Load(),
+		Downloads:      s.a.health.Downloads(),
+	}
+	all, err := s.a.feeds.All()
+	if err != nil {
+		return status, err
+	}
+	status.Feeds = len(all)
+	for _, feed := range all {
+		stats, err := s.a.feeds.Stats(feed.ID)
+		if err != nil {
+			return status, err
+		}
+		status.Queued += stats.Unpublished
+	}
+	return status, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/tutuna/echopan/internals/caption"
+	"github.com/tutuna/echopan/internals/chapters"
+	"github.com/tutuna/echopan/internals/logging"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+// Telegram limits, counted in UTF-16 code units
+const (
+	captionLimit = 1024
+	messageLimit = 4096
+)
+
+// itemChapters returns the chapters of the item, from its podcast:chapters
+// document or else from the ID3 tag of the downloaded episode. Chapters are
+// optional, failures are only logged.
+func (a *app) itemChapters(item models.Item, episodeFile string) []chapters.Chapter {
+	if !a.cfg.Publish.Chapters {
+		return nil
+	}
+	logger := slog.With(logging.FeedID, item.FeedId, logging.ItemID, item.ID)
+	if item.ChaptersURL != "" && (item.ChaptersType == "" || strings.Contains(item.ChaptersType, "json")) {
+		list, err := chapters.Fetch(&http.Client{Timeout: 30 * time.Second}, item.ChaptersURL)
+		if err == nil && len(list) > 0 {
+			return list
+		}
+		if err != nil {
+			logger.Warn("Error fetching chapters", "url", item.ChaptersURL, "error", err)
+		}
+	}
+	f, err := os.Open(episodeFile)
+	if err != nil {
+		logger.Warn("Error reading chapters", "error", err)
+		return nil
+	}
+	defer f.Close()
+	list, err := chapters.ReadID3(bufio.NewReader(f))
+	if err != nil && !errors.Is(err, chapters.ErrNoTag) {
+		logger.Warn("Error reading chapters", "error", err)
+	}
+	return list
+}
+
+// withChapters appends the chapters to the Markdown caption. When the caption
+// would get too long the chapters are returned as a plain text reply instead.
+// A single chapter is not worth listing.
+func withChapters(text string, list []chapters.Chapter) (string, string) {
+	if len(list) < 2 {
+		return text, ""
+	}
+	escaped := make([]chapters.Chapter, len(list))
+	for i, c := range list {
+		escaped[i] = chapters.Chapter{Start: c.Start, Title: caption.Escape(c.Title)}
+	}
+	if full := text + "\n\n" + chapters.Format(escaped); utf16Len(full) <= captionLimit {
+		return full, ""
+	}
+	reply := chapters.Format(list)
+	for utf16Len(reply) > messageLimit {
+		cut := strings.LastIndexByte(reply, '\n')
+		if cut < 0 {
+			return text, ""
+		}
+		reply = reply[:cut]
+	}
+	return text, reply
+}
+
+// utf16Len is the length of s as counted by Telegram
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
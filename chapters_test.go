@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/chapters"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+func TestWithChapters(t *testing.T) {
+	list := []chapters.Chapter{{Start: 0, Title: "Intro"}, {Start: 90 * time.Second, Title: "my_guest"}}
+
+	text, reply := withChapters("*Pilot*", list)
+	assert.Equal(t, "*Pilot*\n\n00:00 Intro\n01:30 my\\_guest", text)
+	assert.Empty(t, reply)
+
+	text, reply = withChapters("*Pilot*", list[:1])
+	assert.Equal(t, "*Pilot*", text, "a single chapter is not listed")
+	assert.Empty(t, reply)
+
+	long := "*Pilot*\n\n" + strings.Repeat("я", captionLimit-20)
+	text, reply = withChapters(long, list)
+	assert.Equal(t, long, text)
+	assert.Equal(t, "00:00 Intro\n01:30 my_guest", reply, "the reply is plain text")
+}
+
+func TestItemChapters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"chapters":[{"startTime":0,"title":"Intro"},{"startTime":60,"title":"Main"}]}`)
+	}))
+	defer srv.Close()
+	episode := filepath.Join(t.TempDir(), "episode.mp3")
+	assert.NoError(t, os.WriteFile(episode, []byte{0xff, 0xfb, 0x90, 0x00}, 0o600))
+
+	a := newApp(nil)
+	item := models.Item{ChaptersURL: srv.URL + "/chapters.json", ChaptersType: "application/json+chapters"}
+	assert.Len(t, a.itemChapters(item, episode), 2)
+	assert.Empty(t, a.itemChapters(models.Item{}, episode), "no chapters in the file")
+
+	a.cfg.Publish.Chapters = false
+	assert.Empty(t, a.itemChapters(item, episode))
+}
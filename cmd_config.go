@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/tutuna/echopan/internals/config"
+)
+
+// loadConfig reads and validates the configuration. The configuration is
+// returned even when it is invalid so that config print can show it.
+func loadConfig(flags *config.Flags) (*config.Config, error) {
+	cfg, err := config.Load(flags)
+	if err != nil {
+		return config.Default(), err
+	}
+	return cfg, cfg.Validate()
+}
+
+type configCmd struct {
+	app *app
+}
+
+func (*configCmd) Name() string     { return "config" }
+func (*configCmd) Synopsis() string { return "Check or print the configuration." }
+func (*configCmd) Usage() string {
+	return `config <subcommand>:
+  Check or print the configuration. Subcommands: check, print.
+`
+}
+
+func (c *configCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *configCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, "config")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&configCheckCmd{app: c.app}, "")
+	cdr.Register(&configPrintCmd{app: c.app}, "")
+	return cdr.Execute(ctx, args...)
+}
+
+type configCheckCmd struct {
+	app *app
+}
+
+func (*configCheckCmd) Name() string     { return "check" }
+func (*configCheckCmd) Synopsis() string { return "Validate the configuration." }
+func (*configCheckCmd) Usage() string {
+	return `check:
+  Validate the configuration and report every problem.
+`
+}
+
+func (c *configCheckCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *configCheckCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.app.cfgErr != nil {
+		log.Printf("Invalid configuration:\n%v", c.app.cfgErr)
+		return subcommands.ExitFailure
+	}
+	fmt.Println("Configuration is valid")
+	return subcommands.ExitSuccess
+}
+
+type configPrintCmd struct {
+	app *app
+}
+
+func (*configPrintCmd) Name() string     { return "print" }
+func (*configPrintCmd) Synopsis() string { return "Print the effective configuration." }
+func (*configPrintCmd) Usage() string {
+	return `print:
+  Print the effective configuration as YAML, with secrets redacted.
+`
+}
+
+func (c *configPrintCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *configPrintCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	out, err := c.app.cfg.Redacted().YAML()
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	os.Stdout.Write(out)
+	if c.app.cfgErr != nil {
+		log.Printf("Invalid configuration:\n%v", c.app.cfgErr)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
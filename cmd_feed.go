@@ -0,0 +1,723 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/tutuna/echopan/internals/caption"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/shownotes"
+)
+
+const (
+	feedStatusReady   = "ready"
+	feedStatusPaused  = "paused"
+	feedStatusDeleted = "deleted"
+)
+
+// feedView is the representation of a feed printed by the feed commands
+type feedView struct {
+	ID               uint         `json:"id"`
+	Status           string       `json:"status"`
+	Title            string       `json:"title"`
+	Description      string       `json:"description"`
+	Link             string       `json:"link"`
+	Feed             string       `json:"feed"`
+	PublishReady     bool         `json:"publish_ready"`
+	TgChannel        int          `json:"tg_channel"`
+	Timeout          int          `json:"timeout"`
+	ExtraLinkEnabled bool         `json:"extra_link_enabled"`
+	ExtraLink        string       `json:"extra_link"`
+	CaptionTemplate  string       `json:"caption_template,omitempty"`
+	Caption          *captionView `json:"caption,omitempty"`
+	Schedule         string       `json:"schedule,omitempty"`
+	ShowNotes        string       `json:"show_notes,omitempty"`
+	Filter           *filterView  `json:"filter,omitempty"`
+	LastFetchAt      *time.Time   `json:"last_fetch_at,omitempty"`
+	LastSuccessAt    *time.Time   `json:"last_success_at,omitempty"`
+	Failures         int          `json:"consecutive_failures"`
+	LastStatus       int          `json:"last_status,omitempty"`
+	LastFetchError   string       `json:"last_fetch_error,omitempty"`
+	Quarantined      bool         `json:"quarantined"`
+	CreatedAt        time.Time    `json:"created_at"`
+	DeletedAt        *time.Time   `json:"deleted_at,omitempty"`
+	Stats            *feeds.Stats `json:"stats,omitempty"`
+	URLChanges       []urlChange  `json:"url_changes,omitempty"`
+}
+
+// captionView holds the caption options of a feed
+type captionView struct {
+	HideSubtitle bool   `json:"hide_subtitle,omitempty"`
+	Source       string `json:"source,omitempty"`
+	MaxLength    int    `json:"max_length,omitempty"`
+	StripLinks   bool   `json:"strip_links,omitempty"`
+	Numbers      bool   `json:"numbers,omitempty"`
+}
+
+func newCaptionView(feed models.Feed) *captionView {
+	v := captionView{
+		HideSubtitle: feed.CaptionHideSubtitle,
+		Source:       feed.CaptionSource,
+		MaxLength:    feed.CaptionMaxLength,
+		StripLinks:   feed.CaptionStripLinks,
+		Numbers:      feed.CaptionNumbers,
+	}
+	if v == (captionView{}) {
+		return nil
+	}
+	return &v
+}
+
+// String lists the options on one line
+func (v *captionView) String() string {
+	if v == nil {
+		return ""
+	}
+	var options []string
+	if v.HideSubtitle {
+		options = append(options, "no subtitle")
+	}
+	if v.Source != "" {
+		options = append(options, "from "+v.Source)
+	}
+	if v.MaxLength > 0 {
+		options = append(options, fmt.Sprintf("max %d", v.MaxLength))
+	}
+	if v.StripLinks {
+		options = append(options, "no links")
+	}
+	if v.Numbers {
+		options = append(options, "numbers")
+	}
+	return strings.Join(options, ", ")
+}
+
+// filterView holds the filter rules of a feed, see feeds.Rules
+type filterView struct {
+	Include      string `json:"include,omitempty"`
+	Exclude      string `json:"exclude,omitempty"`
+	EpisodeTypes string `json:"skip_episode_types,omitempty"`
+	Explicit     bool   `json:"skip_explicit,omitempty"`
+	MinDuration  string `json:"min_duration,omitempty"`
+	MaxDuration  string `json:"max_duration,omitempty"`
+}
+
+func newFilterView(feed models.Feed) *filterView {
+	v := filterView{
+		Include:      feed.FilterInclude,
+		Exclude:      feed.FilterExclude,
+		EpisodeTypes: feed.FilterEpisodeTypes,
+		Explicit:     feed.FilterExplicit,
+		MinDuration:  feed.FilterMinDuration,
+		MaxDuration:  feed.FilterMaxDuration,
+	}
+	if v == (filterView{}) {
+		return nil
+	}
+	return &v
+}
+
+// String lists the rules on one line
+func (v *filterView) String() string {
+	if v == nil {
+		return ""
+	}
+	var rules []string
+	if v.Include != "" {
+		rules = append(rules, fmt.Sprintf("include %q", v.Include))
+	}
+	if v.Exclude != "" {
+		rules = append(rules, fmt.Sprintf("exclude %q", v.Exclude))
+	}
+	if v.EpisodeTypes != "" {
+		rules = append(rules, "skip "+v.EpisodeTypes)
+	}
+	if v.Explicit {
+		rules = append(rules, "skip explicit")
+	}
+	if v.MinDuration != "" {
+		rules = append(rules, "min "+v.MinDuration)
+	}
+	if v.MaxDuration != "" {
+		rules = append(rules, "max "+v.MaxDuration)
+	}
+	return strings.Join(rules, ", ")
+}
+
+// urlChange is a previous location of a feed
+type urlChange struct {
+	At     time.Time `json:"at"`
+	OldURL string    `json:"old_url"`
+	NewURL string    `json:"new_url"`
+	Reason string    `json:"reason"`
+}
+
+func feedStatus(feed models.Feed) string {
+	switch {
+	case feed.DeletedAt.Valid:
+		return feedStatusDeleted
+	case feed.PublishReady:
+		return feedStatusReady
+	default:
+		return feedStatusPaused
+	}
+}
+
+func newFeedView(feed models.Feed, stats *feeds.Stats) feedView {
+	view := feedView{
+		ID:               feed.ID,
+		Status:           feedStatus(feed),
+		Title:            feed.Title,
+		Description:      feed.Description,
+		Link:             feed.Link,
+		Feed:             feed.Feed,
+		PublishReady:     feed.PublishReady,
+		TgChannel:        feed.TgChannel,
+		Timeout:          feed.Timeout,
+		ExtraLinkEnabled: feed.ExtraLinkEnabled,
+		ExtraLink:        feed.ExtraLink,
+		CaptionTemplate:  feed.CaptionTemplate,
+		Caption:          newCaptionView(feed),
+		Schedule:         feed.Schedule,
+		ShowNotes:        feed.ShowNotes,
+		Filter:           newFilterView(feed),
+		LastFetchAt:      feed.LastFetchAt,
+		LastSuccessAt:    feed.LastSuccessAt,
+		Failures:         feed.ConsecutiveFailures,
+		LastStatus:       feed.LastStatus,
+		LastFetchError:   feed.LastFetchError,
+		Quarantined:      feed.Quarantined,
+		CreatedAt:        feed.CreatedAt,
+		Stats:            stats,
+	}
+	if feed.DeletedAt.Valid {
+		view.DeletedAt = &feed.DeletedAt.Time
+	}
+	return view
+}
+
+func writeFeedList(w io.Writer, format string, views []feedView) error {
+	if format == formatJSON {
+		return writeJSON(w, views)
+	}
+	rows := make([][]string, 0, len(views))
+	for _, v := range views {
+		queued, published := "-", "-"
+		if v.Stats != nil {
+			queued = strconv.FormatInt(v.Stats.Unpublished, 10)
+			published = strconv.FormatInt(v.Stats.Published, 10)
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(v.ID), 10), v.Status, strconv.Itoa(v.TgChannel),
+			queued, published, v.Title,
+		})
+	}
+	return writeTable(w, []string{"ID", "STATUS", "CHANNEL", "QUEUED", "PUBLISHED", "TITLE"}, rows)
+}
+
+func writeFeedDetails(w io.Writer, format string, v feedView) error {
+	if format == formatJSON {
+		return writeJSON(w, v)
+	}
+	rows := [][]string{
+		{"Title", v.Title},
+		{"Status", v.Status},
+		{"Feed", v.Feed},
+		{"Link", v.Link},
+		{"Channel", strconv.Itoa(v.TgChannel)},
+		{"Timeout", strconv.Itoa(v.Timeout)},
+		{"Extra link", fmt.Sprintf("%s (enabled: %t)", v.ExtraLink, v.ExtraLinkEnabled)},
+		{"Caption template", v.CaptionTemplate},
+		{"Caption", v.Caption.String()},
+		{"Schedule", v.Schedule},
+		{"Show notes", v.ShowNotes},
+		{"Filter", v.Filter.String()},
+		{"Last fetch", fmt.Sprintf("%s (status %d)", formatTime(v.LastFetchAt), v.LastStatus)},
+		{"Last success", formatTime(v.LastSuccessAt)},
+		{"Failures", fmt.Sprintf("%d (quarantined: %t)", v.Failures, v.Quarantined)},
+		{"Last error", v.LastFetchError},
+		{"Created", formatTime(&v.CreatedAt)},
+		{"Deleted", formatTime(v.DeletedAt)},
+	}
+	if v.Stats != nil {
+		rows = append(rows,
+			[]string{"Items", strconv.FormatInt(v.Stats.Items, 10)},
+			[]string{"Published", strconv.FormatInt(v.Stats.Published, 10)},
+			[]string{"Queued", strconv.FormatInt(v.Stats.Unpublished, 10)},
+			[]string{"Enclosures", strconv.FormatInt(v.Stats.Enclosures, 10)},
+			[]string{"Last published", formatTime(v.Stats.LastPublished)},
+		)
+	}
+	for _, change := range v.URLChanges {
+		rows = append(rows, []string{"Moved", fmt.Sprintf("%s from %s (%s)", formatTime(&change.At), change.OldURL, change.Reason)})
+	}
+	return writeTable(w, []string{"ID", strconv.FormatUint(uint64(v.ID), 10)}, rows)
+}
+
+// feedArg resolves the single positional argument to a feed id. The argument
+// is a feed id, url, podcast:guid or title, see feeds.Resolve.
+func (a *app) feedArg(f *flag.FlagSet) (uint, error) {
+	if f.NArg() != 1 {
+		return 0, errUsage
+	}
+	if id, err := strconv.ParseUint(f.Arg(0), 10, 64); err == nil {
+		return uint(id), nil
+	}
+	feed, err := a.feeds.Resolve(f.Arg(0))
+	if errors.Is(err, feeds.ErrFeedNotFound) {
+		return 0, fmt.Errorf("no feed matches %q", f.Arg(0))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return feed.ID, nil
+}
+
+// errUsage is returned by feedArg when the command line is malformed
+var errUsage = errors.New("expected exactly one feed id, url or title")
+
+// runFeedOp resolves the feed argument and applies op to it, reporting the outcome
+func (a *app) runFeedOp(f *flag.FlagSet, done string, op func(id uint) error) subcommands.ExitStatus {
+	id, err := a.feedArg(f)
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, errUsage) {
+			f.PrintDefaults()
+			return subcommands.ExitUsageError
+		}
+		return subcommands.ExitFailure
+	}
+	if err := op(id); err != nil {
+		log.Printf("Feed %d: %v", id, err)
+		return subcommands.ExitFailure
+	}
+	fmt.Printf("Feed %d %s\n", id, done)
+	return subcommands.ExitSuccess
+}
+
+type feedCmd struct {
+	app *app
+}
+
+func (*feedCmd) Name() string     { return "feed" }
+func (*feedCmd) Synopsis() string { return "Manage feeds." }
+func (*feedCmd) Usage() string {
+	return `feed <subcommand> [flags] [args]:
+  Manage feeds. Subcommands: list, show, set, pause, resume, delete, restore, set-url, release.
+  A <feed> is given by id, url, podcast:guid or title.
+`
+}
+
+func (c *feedCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *feedCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, "feed")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&feedListCmd{app: c.app}, "")
+	cdr.Register(&feedShowCmd{app: c.app}, "")
+	cdr.Register(&feedSetCmd{app: c.app}, "")
+	cdr.Register(&feedPauseCmd{app: c.app}, "")
+	cdr.Register(&feedResumeCmd{app: c.app}, "")
+	cdr.Register(&feedDeleteCmd{app: c.app}, "")
+	cdr.Register(&feedRestoreCmd{app: c.app}, "")
+	cdr.Register(&feedSetURLCmd{app: c.app}, "")
+	cdr.Register(&feedReleaseCmd{app: c.app}, "")
+	return cdr.Execute(ctx, args...)
+}
+
+type feedListCmd struct {
+	app    *app
+	format string
+	all    bool
+}
+
+func (*feedListCmd) Name() string     { return "list" }
+func (*feedListCmd) Synopsis() string { return "List feeds with their status." }
+func (*feedListCmd) Usage() string {
+	return `list [-format table|json] [-all]:
+  List feeds with their status.
+`
+}
+
+func (c *feedListCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.format, "format", formatTable, "Output format: table or json")
+	f.BoolVar(&c.all, "all", false, "Include deleted feeds")
+}
+
+func (c *feedListCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if !validFormat(c.format) {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	list, err := c.app.feeds.List(c.all)
+	if err != nil {
+		log.Println("Error getting feeds:", err)
+		return subcommands.ExitFailure
+	}
+	views := make([]feedView, 0, len(list))
+	for _, feed := range list {
+		stats, err := c.app.feeds.Stats(feed.ID)
+		if err != nil {
+			log.Printf("Error getting stats for feed %d: %v", feed.ID, err)
+			return subcommands.ExitFailure
+		}
+		views = append(views, newFeedView(feed, &stats))
+	}
+	if err := writeFeedList(os.Stdout, c.format, views); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type feedShowCmd struct {
+	app    *app
+	format string
+}
+
+func (*feedShowCmd) Name() string     { return "show" }
+func (*feedShowCmd) Synopsis() string { return "Show feed details and stats." }
+func (*feedShowCmd) Usage() string {
+	return `show [-format table|json] <feed>:
+  Show feed details and stats.
+`
+}
+
+func (c *feedShowCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.format, "format", formatTable, "Output format: table or json")
+}
+
+func (c *feedShowCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if !validFormat(c.format) {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	id, err := c.app.feedArg(f)
+	if errors.Is(err, errUsage) {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	feed, err := c.app.feeds.Get(id)
+	if err != nil {
+		log.Printf("Feed %d: %v", id, err)
+		return subcommands.ExitFailure
+	}
+	stats, err := c.app.feeds.Stats(id)
+	if err != nil {
+		log.Printf("Error getting stats for feed %d: %v", id, err)
+		return subcommands.ExitFailure
+	}
+	changes, err := c.app.feeds.URLChanges(id)
+	if err != nil {
+		log.Printf("Error getting url changes of feed %d: %v", id, err)
+		return subcommands.ExitFailure
+	}
+	view := newFeedView(feed, &stats)
+	for _, change := range changes {
+		view.URLChanges = append(view.URLChanges, urlChange{
+			At: change.CreatedAt, OldURL: change.OldURL, NewURL: change.NewURL, Reason: change.Reason,
+		})
+	}
+	if err := writeFeedDetails(os.Stdout, c.format, view); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type feedSetCmd struct {
+	app              *app
+	title            string
+	channel          int
+	ready            bool
+	timeout          int
+	extraLink        string
+	extraLinkEnabled bool
+	captionTemplate  string
+	hideSubtitle     bool
+	captionSource    string
+	captionMaxLength int
+	stripLinks       bool
+	captionNumbers   bool
+	schedule         string
+	showNotes        string
+	include          string
+	exclude          string
+	skipTypes        string
+	skipExplicit     bool
+	minDuration      string
+	maxDuration      string
+}
+
+func (*feedSetCmd) Name() string     { return "set" }
+func (*feedSetCmd) Synopsis() string { return "Set feed fields." }
+func (*feedSetCmd) Usage() string {
+	return `set [-title <title>] [-channel <id>] [-ready] [-timeout <n>] [-extra-link <url>] [-extra-link-enabled]
+    [-caption-template <template>] [-hide-subtitle] [-caption-source subtitle|summary|description]
+    [-caption-max-length <n>] [-strip-links] [-caption-numbers] [-schedule <duration>] [-show-notes reply|page]
+    [-include <regexp>] [-exclude <regexp>] [-skip-types <types>] [-skip-explicit]
+    [-min-duration <duration>] [-max-duration <duration>] <feed>:
+  Set feed fields, only the given flags are changed. Items rejected by the
+  filter rules are skipped instead of published.
+`
+}
+
+func (c *feedSetCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.title, "title", "", "Title of the feed")
+	f.IntVar(&c.channel, "channel", 0, "Telegram channel id")
+	f.BoolVar(&c.ready, "ready", false, "Publish the feed")
+	f.IntVar(&c.timeout, "timeout", 0, "Feed timeout")
+	f.StringVar(&c.extraLink, "extra-link", "", "Link appended to every caption")
+	f.BoolVar(&c.extraLinkEnabled, "extra-link-enabled", false, "Append the extra link")
+	f.StringVar(&c.captionTemplate, "caption-template", "", "Caption template, empty for the default caption")
+	f.BoolVar(&c.hideSubtitle, "hide-subtitle", false, "Leave the subtitle out of the caption")
+	f.StringVar(&c.captionSource, "caption-source", "", "Caption text: subtitle, summary or description, empty for the subtitle")
+	f.IntVar(&c.captionMaxLength, "caption-max-length", 0, "Caption text characters kept, 0 for publish.subtitle_limit")
+	f.BoolVar(&c.stripLinks, "strip-links", false, "Remove the links of the caption text")
+	f.BoolVar(&c.captionNumbers, "caption-numbers", false, "Add the season and episode numbers to the caption title")
+	f.StringVar(&c.schedule, "schedule", "", "Minimum time between two publications, e.g. 24h, empty for no limit")
+	f.StringVar(&c.showNotes, "show-notes", "", "Post the full show notes as replies (reply) or a linked page (page), empty for none")
+	f.StringVar(&c.include, "include", "", "Only publish items whose title or description matches the regexp")
+	f.StringVar(&c.exclude, "exclude", "", "Skip items whose title or description matches the regexp")
+	f.StringVar(&c.skipTypes, "skip-types", "", "Comma separated episode types to skip, e.g. trailer,bonus")
+	f.BoolVar(&c.skipExplicit, "skip-explicit", false, "Skip explicit items")
+	f.StringVar(&c.minDuration, "min-duration", "", "Skip items shorter than the duration, e.g. 5m")
+	f.StringVar(&c.maxDuration, "max-duration", "", "Skip items longer than the duration, e.g. 3h")
+}
+
+// fields maps the flags given on the command line to feed columns
+func (c *feedSetCmd) fields(f *flag.FlagSet) map[string]interface{} {
+	fields := map[string]interface{}{}
+	f.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "title":
+			fields["title"] = c.title
+		case "channel":
+			fields["tg_channel"] = c.channel
+		case "ready":
+			fields["publish_ready"] = c.ready
+		case "timeout":
+			fields["timeout"] = c.timeout
+		case "extra-link":
+			fields["extra_link"] = c.extraLink
+		case "extra-link-enabled":
+			fields["extra_link_enabled"] = c.extraLinkEnabled
+		case "caption-template":
+			fields["caption_template"] = c.captionTemplate
+		case "hide-subtitle":
+			fields["caption_hide_subtitle"] = c.hideSubtitle
+		case "caption-source":
+			fields["caption_source"] = c.captionSource
+		case "caption-max-length":
+			fields["caption_max_length"] = c.captionMaxLength
+		case "strip-links":
+			fields["caption_strip_links"] = c.stripLinks
+		case "caption-numbers":
+			fields["caption_numbers"] = c.captionNumbers
+		case "schedule":
+			fields["schedule"] = c.schedule
+		case "show-notes":
+			fields["show_notes"] = c.showNotes
+		case "include":
+			fields["filter_include"] = c.include
+		case "exclude":
+			fields["filter_exclude"] = c.exclude
+		case "skip-types":
+			fields["filter_episode_types"] = c.skipTypes
+		case "skip-explicit":
+			fields["filter_explicit"] = c.skipExplicit
+		case "min-duration":
+			fields["filter_min_duration"] = c.minDuration
+		case "max-duration":
+			fields["filter_max_duration"] = c.maxDuration
+		}
+	})
+	return fields
+}
+
+// rules holds the filter rules given on the command line, for validation
+func (c *feedSetCmd) rules() models.Feed {
+	return models.Feed{
+		FilterInclude:     c.include,
+		FilterExclude:     c.exclude,
+		FilterMinDuration: c.minDuration,
+		FilterMaxDuration: c.maxDuration,
+	}
+}
+
+func (c *feedSetCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	fields := c.fields(f)
+	if len(fields) == 0 {
+		log.Println("Nothing to set")
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	if _, err := feeds.ParseSchedule(c.schedule); err != nil {
+		log.Println(err)
+		return subcommands.ExitUsageError
+	}
+	if err := caption.Validate(c.captionTemplate); err != nil {
+		log.Println("Invalid caption template:", err)
+		return subcommands.ExitUsageError
+	}
+	if err := caption.ValidSource(c.captionSource); err != nil {
+		log.Println(err)
+		return subcommands.ExitUsageError
+	}
+	if c.captionMaxLength < 0 {
+		log.Println("The caption max length must not be negative")
+		return subcommands.ExitUsageError
+	}
+	if err := shownotes.ValidMode(c.showNotes); err != nil {
+		log.Println(err)
+		return subcommands.ExitUsageError
+	}
+	if _, err := feeds.ParseRules(c.rules()); err != nil {
+		log.Println(err)
+		return subcommands.ExitUsageError
+	}
+	return c.app.runFeedOp(f, "updated", func(id uint) error {
+		return c.app.feeds.Update(id, fields)
+	})
+}
+
+type feedPauseCmd struct {
+	app *app
+}
+
+func (*feedPauseCmd) Name() string     { return "pause" }
+func (*feedPauseCmd) Synopsis() string { return "Stop publishing a feed." }
+func (*feedPauseCmd) Usage() string {
+	return `pause <feed>:
+  Stop publishing a feed.
+`
+}
+
+func (c *feedPauseCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *feedPauseCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	return c.app.runFeedOp(f, "paused", func(id uint) error {
+		return c.app.feeds.SetPublishReady(id, false)
+	})
+}
+
+type feedResumeCmd struct {
+	app *app
+}
+
+func (*feedResumeCmd) Name() string     { return "resume" }
+func (*feedResumeCmd) Synopsis() string { return "Resume publishing a feed." }
+func (*feedResumeCmd) Usage() string {
+	return `resume <feed>:
+  Resume publishing a feed.
+`
+}
+
+func (c *feedResumeCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *feedResumeCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	return c.app.runFeedOp(f, "resumed", func(id uint) error {
+		return c.app.feeds.SetPublishReady(id, true)
+	})
+}
+
+type feedDeleteCmd struct {
+	app *app
+}
+
+func (*feedDeleteCmd) Name() string     { return "delete" }
+func (*feedDeleteCmd) Synopsis() string { return "Soft delete a feed." }
+func (*feedDeleteCmd) Usage() string {
+	return `delete <feed>:
+  Soft delete a feed, it can be brought back with restore.
+`
+}
+
+func (c *feedDeleteCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *feedDeleteCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	return c.app.runFeedOp(f, "deleted", c.app.feeds.Delete)
+}
+
+type feedRestoreCmd struct {
+	app *app
+}
+
+func (*feedRestoreCmd) Name() string     { return "restore" }
+func (*feedRestoreCmd) Synopsis() string { return "Restore a deleted feed." }
+func (*feedRestoreCmd) Usage() string {
+	return `restore <feed>:
+  Restore a deleted feed.
+`
+}
+
+func (c *feedRestoreCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *feedRestoreCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	return c.app.runFeedOp(f, "restored", c.app.feeds.Restore)
+}
+
+type feedSetURLCmd struct {
+	app *app
+	url string
+}
+
+func (*feedSetURLCmd) Name() string     { return "set-url" }
+func (*feedSetURLCmd) Synopsis() string { return "Change the feed URL." }
+func (*feedSetURLCmd) Usage() string {
+	return `set-url -url <url> <feed>:
+  Change the URL the feed is fetched from.
+`
+}
+
+func (c *feedSetURLCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.url, "url", "", "New URL of the RSS feed")
+}
+
+func (c *feedSetURLCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.url == "" {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	return c.app.runFeedOp(f, "url changed", func(id uint) error {
+		return c.app.feeds.SetURL(id, c.url)
+	})
+}
+
+type feedReleaseCmd struct {
+	app *app
+}
+
+func (*feedReleaseCmd) Name() string     { return "release" }
+func (*feedReleaseCmd) Synopsis() string { return "Fetch a quarantined feed again." }
+func (*feedReleaseCmd) Usage() string {
+	return `release <feed>:
+  Lift the quarantine of a feed and reset its failure count.
+`
+}
+
+func (c *feedReleaseCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *feedReleaseCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	return c.app.runFeedOp(f, "released", c.app.feeds.Release)
+}
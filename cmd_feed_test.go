@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+func TestFeedStatus(t *testing.T) {
+	assert.Equal(t, feedStatusReady, feedStatus(models.Feed{PublishReady: true}))
+	assert.Equal(t, feedStatusPaused, feedStatus(models.Feed{}))
+	deleted := models.Feed{PublishReady: true}
+	deleted.DeletedAt = gorm.DeletedAt{Valid: true}
+	assert.Equal(t, feedStatusDeleted, feedStatus(deleted))
+}
+
+func TestWriteFeedList(t *testing.T) {
+	feed := models.Feed{Model: gorm.Model{ID: 7}, Title: "Podcast", PublishReady: true, TgChannel: -1001}
+	views := []feedView{newFeedView(feed, &feeds.Stats{Published: 3, Unpublished: 2})}
+
+	var table bytes.Buffer
+	assert.NoError(t, writeFeedList(&table, formatTable, views))
+	assert.Contains(t, table.String(), "STATUS")
+	assert.Regexp(t, `7\s+ready\s+-1001\s+2\s+3\s+Podcast`, table.String())
+
+	var out bytes.Buffer
+	assert.NoError(t, writeFeedList(&out, formatJSON, views))
+	var decoded []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, "ready", decoded[0]["status"])
+	assert.Equal(t, float64(7), decoded[0]["id"])
+}
+
+func TestFeedSetFields(t *testing.T) {
+	c := &feedSetCmd{}
+	f := flag.NewFlagSet("set", flag.ContinueOnError)
+	c.SetFlags(f)
+	assert.NoError(t, f.Parse([]string{"-channel", "-100", "-ready=false", "3"}))
+
+	assert.Equal(t, map[string]interface{}{"tg_channel": -100, "publish_ready": false}, c.fields(f))
+
+	c = &feedSetCmd{}
+	f = flag.NewFlagSet("set", flag.ContinueOnError)
+	c.SetFlags(f)
+	assert.NoError(t, f.Parse([]string{"-skip-types", "trailer,bonus", "-skip-explicit", "-min-duration", "5m", "3"}))
+	assert.Equal(t, map[string]interface{}{"filter_episode_types": "trailer,bonus", "filter_explicit": true, "filter_min_duration": "5m"}, c.fields(f))
+	a, _, _ := newFakeApp()
+	id, err := a.feedArg(f)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), id)
+}
+
+func TestFeedArg_Selectors(t *testing.T) {
+	a, _, _ := newFakeApp(
+		models.Feed{Model: gorm.Model{ID: 1}, Title: "Podcast", Feed: "https://one.example.com/rss"},
+		models.Feed{Model: gorm.Model{ID: 2}, Title: "Podcast", Feed: "https://two.example.com/rss"},
+		models.Feed{Model: gorm.Model{ID: 3}, Title: "Other", Feed: "https://three.example.com/rss"},
+	)
+	parse := func(args ...string) *flag.FlagSet {
+		f := flag.NewFlagSet("show", flag.ContinueOnError)
+		assert.NoError(t, f.Parse(args))
+		return f
+	}
+
+	id, err := a.feedArg(parse("Other"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), id)
+	id, err = a.feedArg(parse("https://two.example.com/rss"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), id)
+
+	_, err = a.feedArg(parse("Podcast"))
+	assert.ErrorContains(t, err, `"Podcast" matches feeds 1, 2`)
+	_, err = a.feedArg(parse("abc"))
+	assert.ErrorContains(t, err, `no feed matches "abc"`)
+	_, err = a.feedArg(parse())
+	assert.ErrorIs(t, err, errUsage)
+}
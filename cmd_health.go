@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/tutuna/echopan/internals/feeds"
+)
+
+// feedHealthView is the representation of a feed printed by feedHealth
+type feedHealthView struct {
+	ID            uint       `json:"id"`
+	Title         string     `json:"title"`
+	Health        string     `json:"health"`
+	Failures      int        `json:"consecutive_failures"`
+	LastStatus    int        `json:"last_status,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastEpisode   *time.Time `json:"last_episode,omitempty"`
+}
+
+func newFeedHealthView(h feeds.Health) feedHealthView {
+	return feedHealthView{
+		ID:            h.Feed.ID,
+		Title:         h.Feed.Title,
+		Health:        h.Status(),
+		Failures:      h.Feed.ConsecutiveFailures,
+		LastStatus:    h.Feed.LastStatus,
+		LastError:     h.Feed.LastFetchError,
+		LastSuccessAt: h.Feed.LastSuccessAt,
+		LastEpisode:   h.LastEpisode,
+	}
+}
+
+func writeFeedHealth(w io.Writer, format string, views []feedHealthView) error {
+	if format == formatJSON {
+		return writeJSON(w, views)
+	}
+	rows := make([][]string, 0, len(views))
+	for _, v := range views {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(v.ID), 10), v.Health, strconv.Itoa(v.Failures),
+			formatTime(v.LastSuccessAt), formatTime(v.LastEpisode), v.Title, v.LastError,
+		})
+	}
+	return writeTable(w, []string{"ID", "HEALTH", "FAILURES", "LAST SUCCESS", "LAST EPISODE", "TITLE", "ERROR"}, rows)
+}
+
+type feedHealthCmd struct {
+	app    *app
+	format string
+	stale  time.Duration
+	all    bool
+}
+
+func (*feedHealthCmd) Name() string     { return "feedHealth" }
+func (*feedHealthCmd) Synopsis() string { return "List stale and broken feeds." }
+func (*feedHealthCmd) Usage() string {
+	return `feedHealth [-stale <duration>] [-all] [-format table|json]:
+  List the feeds without a new episode for the stale period, and the feeds
+  whose last fetch failed or that are quarantined.
+`
+}
+
+func (c *feedHealthCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.format, "format", formatTable, "Output format: table or json")
+	f.DurationVar(&c.stale, "stale", c.app.cfg.Feeds.StaleAfter, "Time without a new episode after which a feed is stale")
+	f.BoolVar(&c.all, "all", false, "Include healthy feeds")
+}
+
+func (c *feedHealthCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if !validFormat(c.format) || c.stale <= 0 {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	report, err := c.app.feeds.Health(c.stale, time.Now())
+	if err != nil {
+		log.Println("Error checking feeds:", err)
+		return subcommands.ExitFailure
+	}
+	views := make([]feedHealthView, 0, len(report))
+	for _, h := range report {
+		view := newFeedHealthView(h)
+		if view.Health == feeds.HealthOK && !c.all {
+			continue
+		}
+		views = append(views, view)
+	}
+	if err := writeFeedHealth(os.Stdout, c.format, views); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+func TestWriteFeedHealth(t *testing.T) {
+	report := []feeds.Health{
+		{Feed: models.Feed{Title: "Stale"}, Stale: true},
+		{Feed: models.Feed{Title: "Broken", ConsecutiveFailures: 2, LastFetchError: "http error: 404 Not Found"}, Broken: true, Stale: true},
+		{Feed: models.Feed{Title: "Quarantined", Quarantined: true}, Broken: true},
+	}
+	var views []feedHealthView
+	for _, h := range report {
+		views = append(views, newFeedHealthView(h))
+	}
+	assert.Equal(t, feeds.HealthStale, views[0].Health)
+	assert.Equal(t, feeds.HealthBroken, views[1].Health, "broken wins over stale")
+	assert.Equal(t, feeds.HealthQuarantined, views[2].Health)
+
+	var out bytes.Buffer
+	assert.NoError(t, writeFeedHealth(&out, formatTable, views))
+	assert.Regexp(t, `broken\s+2\s+-\s+-\s+Broken\s+http error: 404 Not Found`, out.String())
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+type enclosureView struct {
+	Url    string `json:"url"`
+	Length uint64 `json:"length"`
+	Type   string `json:"type"`
+}
+
+// itemView is the representation of an item printed by the items commands
+type itemView struct {
+	ID          uint            `json:"id"`
+	FeedID      int             `json:"feed_id"`
+	State       string          `json:"state"`
+	Title       string          `json:"title"`
+	Link        string          `json:"link"`
+	Published   *time.Time      `json:"published,omitempty"`
+	Duration    string          `json:"duration,omitempty"`
+	Episode     string          `json:"episode,omitempty"`
+	Season      string          `json:"season,omitempty"`
+	EpisodeType string          `json:"episode_type,omitempty"`
+	Subtitle    string          `json:"subtitle,omitempty"`
+	SkipReason  string          `json:"skip_reason,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	Enclosures  []enclosureView `json:"enclosures,omitempty"`
+}
+
+func newItemView(item models.Item) itemView {
+	view := itemView{
+		ID:          item.ID,
+		FeedID:      item.FeedId,
+		State:       items.StateName(item.TgPublished),
+		Title:       item.Title,
+		Link:        item.Link,
+		Published:   item.PublishedParsed,
+		Duration:    item.ItunesDuration,
+		Episode:     item.ItunesEpisode,
+		Season:      item.ItunesSeason,
+		EpisodeType: item.ItunesEpisodeType,
+		Subtitle:    item.ItunesSubtitle,
+		SkipReason:  item.SkipReason,
+		LastError:   item.LastError,
+	}
+	for _, enc := range item.Enclosures {
+		view.Enclosures = append(view.Enclosures, enclosureView{Url: enc.Url, Length: enc.Length, Type: enc.Type})
+	}
+	return view
+}
+
+func writeItemList(w io.Writer, format string, views []itemView) error {
+	if format == formatJSON {
+		return writeJSON(w, views)
+	}
+	rows := make([][]string, 0, len(views))
+	for _, v := range views {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(v.ID), 10), strconv.Itoa(v.FeedID), v.State,
+			formatTime(v.Published), v.Title,
+		})
+	}
+	return writeTable(w, []string{"ID", "FEED", "STATE", "PUBLISHED", "TITLE"}, rows)
+}
+
+func writeItemDetails(w io.Writer, format string, v itemView) error {
+	if format == formatJSON {
+		return writeJSON(w, v)
+	}
+	rows := [][]string{
+		{"Title", v.Title},
+		{"Feed", strconv.Itoa(v.FeedID)},
+		{"State", v.State},
+		{"Published", formatTime(v.Published)},
+		{"Link", v.Link},
+		{"Duration", v.Duration},
+		{"Season", v.Season},
+		{"Episode", v.Episode},
+		{"Episode type", v.EpisodeType},
+		{"Skip reason", v.SkipReason},
+		{"Last error", v.LastError},
+	}
+	for _, enc := range v.Enclosures {
+		rows = append(rows, []string{"Enclosure", fmt.Sprintf("%s (%s, %d bytes)", enc.Url, enc.Type, enc.Length)})
+	}
+	return writeTable(w, []string{"ID", strconv.FormatUint(uint64(v.ID), 10)}, rows)
+}
+
+// itemIDArgs parses the item ids given as positional arguments
+func itemIDArgs(f *flag.FlagSet) ([]uint, error) {
+	if f.NArg() == 0 {
+		return nil, errors.New("expected at least one item id")
+	}
+	ids := make([]uint, 0, f.NArg())
+	for _, arg := range f.Args() {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item id %q", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// setItemsState moves every item given on the command line to state
+func (a *app) setItemsState(f *flag.FlagSet, state int) subcommands.ExitStatus {
+	ids, err := itemIDArgs(f)
+	if err != nil {
+		log.Println(err)
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	status := subcommands.ExitSuccess
+	for _, id := range ids {
+		if err := a.items.SetState(id, state); err != nil {
+			log.Printf("Item %d: %v", id, err)
+			status = subcommands.ExitFailure
+			continue
+		}
+		fmt.Printf("Item %d is %s\n", id, items.StateName(state))
+	}
+	return status
+}
+
+// publishItem downloads and publishes the given item regardless of its state
+func (a *app) publishItem(id uint) error {
+	item, err := a.items.Get(id)
+	if err != nil {
+		return err
+	}
+	feed, err := a.feeds.Get(uint(item.FeedId))
+	if err != nil {
+		return err
+	}
+	if feed.TgChannel == 0 {
+		return fmt.Errorf("feed %d has no telegram channel", feed.ID)
+	}
+	if reason := a.policySkip(feed, item); reason != "" {
+		return fmt.Errorf("item %d is never published: %s", id, reason)
+	}
+	episodeFile, err := a.downloadEpisode(item)
+	if err != nil {
+		a.failItem(feed, item, err)
+		return err
+	}
+	if episodeFile == "" {
+		return fmt.Errorf("no episode file found for %s", item.Title)
+	}
+	messageID, err := a.publishToTheChannel(feed, item, episodeFile)
+	if err != nil {
+		a.failItem(feed, item, err)
+		deleteFile(episodeFile)
+		return err
+	}
+	a.updateItem(item, messageID)
+	a.markFeedPublished(feed)
+	deleteFile(episodeFile)
+	return nil
+}
+
+type itemsCmd struct {
+	app *app
+}
+
+func (*itemsCmd) Name() string     { return "items" }
+func (*itemsCmd) Synopsis() string { return "Inspect and manage feed items." }
+func (*itemsCmd) Usage() string {
+	return `items <subcommand> [flags] [args]:
+  Inspect and manage feed items. Subcommands: list, show, requeue, skip, publish.
+`
+}
+
+func (c *itemsCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *itemsCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, "items")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&itemsListCmd{app: c.app}, "")
+	cdr.Register(&itemsShowCmd{app: c.app}, "")
+	cdr.Register(&itemsRequeueCmd{app: c.app}, "")
+	cdr.Register(&itemsSkipCmd{app: c.app}, "")
+	cdr.Register(&itemsPublishCmd{app: c.app}, "")
+	return cdr.Execute(ctx, args...)
+}
+
+type itemsListCmd struct {
+	app    *app
+	feed   uint
+	state  string
+	limit  int
+	format string
+}
+
+func (*itemsListCmd) Name() string     { return "list" }
+func (*itemsListCmd) Synopsis() string { return "List items." }
+func (*itemsListCmd) Usage() string {
+	return `list [-feed <id>] [-state pending|published|skipped|failed] [-limit <n>] [-format table|json]:
+  List items, newest first.
+`
+}
+
+func (c *itemsListCmd) SetFlags(f *flag.FlagSet) {
+	f.UintVar(&c.feed, "feed", 0, "Only items of this feed id")
+	f.StringVar(&c.state, "state", "", "Only items in this state: pending, published, skipped or failed")
+	f.IntVar(&c.limit, "limit", 50, "Maximum number of items, 0 for no limit")
+	f.StringVar(&c.format, "format", formatTable, "Output format: table or json")
+}
+
+func (c *itemsListCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if !validFormat(c.format) {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	filter := items.Filter{FeedID: c.feed, Limit: c.limit}
+	if c.state != "" {
+		state, err := items.ParseState(c.state)
+		if err != nil {
+			log.Println(err)
+			return subcommands.ExitUsageError
+		}
+		filter.State = &state
+	}
+	list, err := c.app.items.List(filter)
+	if err != nil {
+		log.Println("Error getting items:", err)
+		return subcommands.ExitFailure
+	}
+	views := make([]itemView, 0, len(list))
+	for _, item := range list {
+		views = append(views, newItemView(item))
+	}
+	if err := writeItemList(os.Stdout, c.format, views); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type itemsShowCmd struct {
+	app    *app
+	format string
+}
+
+func (*itemsShowCmd) Name() string     { return "show" }
+func (*itemsShowCmd) Synopsis() string { return "Show an item with its enclosures." }
+func (*itemsShowCmd) Usage() string {
+	return `show [-format table|json] <id>:
+  Show an item with its enclosures.
+`
+}
+
+func (c *itemsShowCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.format, "format", formatTable, "Output format: table or json")
+}
+
+func (c *itemsShowCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	ids, err := itemIDArgs(f)
+	if err != nil || len(ids) != 1 || !validFormat(c.format) {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	item, err := c.app.items.Get(ids[0])
+	if err != nil {
+		log.Printf("Item %d: %v", ids[0], err)
+		return subcommands.ExitFailure
+	}
+	if err := writeItemDetails(os.Stdout, c.format, newItemView(item)); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type itemsRequeueCmd struct {
+	app *app
+}
+
+func (*itemsRequeueCmd) Name() string     { return "requeue" }
+func (*itemsRequeueCmd) Synopsis() string { return "Put items back in the publishing queue." }
+func (*itemsRequeueCmd) Usage() string {
+	return `requeue <id> [<id>...]:
+  Put items back in the publishing queue.
+`
+}
+
+func (c *itemsRequeueCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *itemsRequeueCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	return c.app.setItemsState(f, models.ItemPending)
+}
+
+type itemsSkipCmd struct {
+	app *app
+}
+
+func (*itemsSkipCmd) Name() string     { return "skip" }
+func (*itemsSkipCmd) Synopsis() string { return "Never publish the given items." }
+func (*itemsSkipCmd) Usage() string {
+	return `skip <id> [<id>...]:
+  Never publish the given items.
+`
+}
+
+func (c *itemsSkipCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *itemsSkipCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	return c.app.setItemsState(f, models.ItemSkipped)
+}
+
+type itemsPublishCmd struct {
+	app *app
+}
+
+func (*itemsPublishCmd) Name() string     { return "publish" }
+func (*itemsPublishCmd) Synopsis() string { return "Publish a specific item now." }
+func (*itemsPublishCmd) Usage() string {
+	return `publish <id>:
+  Publish a specific item now, whatever its state.
+`
+}
+
+func (c *itemsPublishCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *itemsPublishCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	ids, err := itemIDArgs(f)
+	if err != nil || len(ids) != 1 {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	if err := c.app.publishItem(ids[0]); err != nil {
+		log.Printf("Item %d: %v", ids[0], err)
+		return subcommands.ExitFailure
+	}
+	fmt.Printf("Item %d published\n", ids[0])
+	return subcommands.ExitSuccess
+}
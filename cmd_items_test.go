@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestItemIDArgs(t *testing.T) {
+	f := flag.NewFlagSet("requeue", flag.ContinueOnError)
+	assert.NoError(t, f.Parse([]string{"4", "5"}))
+	ids, err := itemIDArgs(f)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{4, 5}, ids)
+
+	f = flag.NewFlagSet("requeue", flag.ContinueOnError)
+	assert.NoError(t, f.Parse([]string{"4", "x"}))
+	_, err = itemIDArgs(f)
+	assert.Error(t, err)
+}
+
+func TestWriteItemDetails(t *testing.T) {
+	item := models.Item{Title: "Episode", TgPublished: models.ItemSkipped, FeedId: 3}
+	item.ID = 12
+	item.Enclosures = []models.Enclosure{{Url: "http://example.com/e.mp3", Type: "audio/mpeg", Length: 42}}
+
+	var out bytes.Buffer
+	assert.NoError(t, writeItemDetails(&out, formatTable, newItemView(item)))
+	assert.Regexp(t, `State\s+skipped`, out.String())
+	assert.Contains(t, out.String(), "http://example.com/e.mp3 (audio/mpeg, 42 bytes)")
+}
+
+func TestWriteItemDetails_Failed(t *testing.T) {
+	item := models.Item{Title: "Episode", TgPublished: models.ItemFailed, LastError: "Forbidden: bot is not a member"}
+
+	var out bytes.Buffer
+	assert.NoError(t, writeItemDetails(&out, formatTable, newItemView(item)))
+	assert.Regexp(t, `State\s+failed`, out.String())
+	assert.Regexp(t, `Last error\s+Forbidden: bot is not a member`, out.String())
+}
+
+func TestPublishItem_FeedWithoutChannel(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{}, &models.Enclosure{})
+	feed := models.Feed{Title: "Feed"}
+	db.Create(&feed)
+	item := models.Item{Title: "Episode", FeedId: int(feed.ID)}
+	db.Create(&item)
+
+	a := newApp(db)
+	assert.ErrorContains(t, a.publishItem(item.ID), "no telegram channel")
+	assert.Error(t, a.publishItem(item.ID+1))
+}
+
+func TestPublishItem_DownloadFailure(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{}, &models.Enclosure{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	feed := models.Feed{Title: "Feed", TgChannel: -1001}
+	db.Create(&feed)
+	item := models.Item{Title: "Episode", FeedId: int(feed.ID)}
+	db.Create(&item)
+	db.Create(&models.Enclosure{ItemId: item.ID, Url: server.URL + "/e.mp3"})
+
+	a := newApp(db)
+	assert.ErrorContains(t, a.publishItem(item.ID), "503")
+	stored, _ := a.items.Get(item.ID)
+	assert.Equal(t, models.ItemFailed, stored.TgPublished, "the item is failed instead of the process exiting")
+	assert.Contains(t, stored.LastError, "503")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/google/subcommands"
+	"github.com/tutuna/echopan/internals/database"
+)
+
+// withoutDatabase lists the commands that run without opening the database,
+// they also start when the configuration is invalid
+var withoutDatabase = map[string]bool{
+	"":         true,
+	"help":     true,
+	"flags":    true,
+	"commands": true,
+	"config":   true,
+}
+
+// skipStartupMigrations lists the commands that open the database without migrating it first
+var skipStartupMigrations = map[string]bool{
+	"migrate": true,
+}
+
+// migrateOnStartup brings the schema up to date before any command touches the database
+func (a *app) migrateOnStartup() {
+	applied, err := database.Migrate(a.db)
+	if err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
+	for _, m := range applied {
+		log.Printf("Applied migration %d %s", m.Version, m.Name)
+	}
+}
+
+func writeMigrationStatus(w io.Writer, format string, statuses []database.MigrationStatus) error {
+	if format == formatJSON {
+		return writeJSON(w, statuses)
+	}
+	rows := make([][]string, 0, len(statuses))
+	for _, s := range statuses {
+		state := "pending"
+		if s.Applied {
+			state = "applied"
+		}
+		rows = append(rows, []string{strconv.Itoa(s.Version), s.Name, state, formatTime(s.AppliedAt)})
+	}
+	return writeTable(w, []string{"VERSION", "NAME", "STATE", "APPLIED AT"}, rows)
+}
+
+type migrateCmd struct {
+	app *app
+}
+
+func (*migrateCmd) Name() string     { return "migrate" }
+func (*migrateCmd) Synopsis() string { return "Manage database schema migrations." }
+func (*migrateCmd) Usage() string {
+	return `migrate <subcommand> [flags]:
+  Manage database schema migrations. Subcommands: status, up, down.
+`
+}
+
+func (c *migrateCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *migrateCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, "migrate")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&migrateStatusCmd{app: c.app}, "")
+	cdr.Register(&migrateUpCmd{app: c.app}, "")
+	cdr.Register(&migrateDownCmd{app: c.app}, "")
+	return cdr.Execute(ctx, args...)
+}
+
+type migrateStatusCmd struct {
+	app    *app
+	format string
+}
+
+func (*migrateStatusCmd) Name() string     { return "status" }
+func (*migrateStatusCmd) Synopsis() string { return "Show applied and pending migrations." }
+func (*migrateStatusCmd) Usage() string {
+	return `status [-format table|json]:
+  Show applied and pending migrations.
+`
+}
+
+func (c *migrateStatusCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.format, "format", formatTable, "Output format: table or json")
+}
+
+func (c *migrateStatusCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if !validFormat(c.format) {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	statuses, err := database.Status(c.app.db)
+	if err != nil {
+		log.Println("Error reading migrations:", err)
+		return subcommands.ExitFailure
+	}
+	if err := writeMigrationStatus(os.Stdout, c.format, statuses); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type migrateUpCmd struct {
+	app *app
+}
+
+func (*migrateUpCmd) Name() string     { return "up" }
+func (*migrateUpCmd) Synopsis() string { return "Apply all pending migrations." }
+func (*migrateUpCmd) Usage() string {
+	return `up:
+  Apply all pending migrations.
+`
+}
+
+func (c *migrateUpCmd) SetFlags(f *flag.FlagSet) {
+}
+
+func (c *migrateUpCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	applied, err := database.Migrate(c.app.db)
+	for _, m := range applied {
+		fmt.Printf("Applied %d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	if len(applied) == 0 {
+		fmt.Println("Database is up to date")
+	}
+	return subcommands.ExitSuccess
+}
+
+type migrateDownCmd struct {
+	app   *app
+	steps int
+}
+
+func (*migrateDownCmd) Name() string     { return "down" }
+func (*migrateDownCmd) Synopsis() string { return "Revert the latest migrations." }
+func (*migrateDownCmd) Usage() string {
+	return `down [-steps <n>]:
+  Revert the latest applied migrations.
+`
+}
+
+func (c *migrateDownCmd) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.steps, "steps", 1, "Number of migrations to revert")
+}
+
+func (c *migrateDownCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.steps < 1 {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	reverted, err := database.Rollback(c.app.db, c.steps)
+	for _, m := range reverted {
+		fmt.Printf("Reverted %d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/tutuna/echopan/internals/feedurl"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/opml"
+)
+
+// importOutlines creates a paused feed for every outline whose URL is not
+// stored yet, soft deleted feeds included, and returns the created feeds
+func (a *app) importOutlines(outlines []opml.Outline, channel int) ([]models.Feed, error) {
+	stored, err := a.feeds.List(true)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, feed := range stored {
+		known[feedurl.Key(feed.Feed)] = true
+	}
+	var created []models.Feed
+	for _, o := range outlines {
+		if known[feedurl.Key(o.XMLURL)] {
+			log.Printf("Skipping %s, already stored", o.XMLURL)
+			continue
+		}
+		title := o.Title
+		if title == "" {
+			title = o.XMLURL
+		}
+		feed := models.Feed{Title: title, Link: o.HTMLURL, Feed: o.XMLURL, TgChannel: channel}
+		if err := a.feeds.Save(&feed); err != nil {
+			return created, fmt.Errorf("saving %s: %w", o.XMLURL, err)
+		}
+		known[feedurl.Key(o.XMLURL)] = true
+		created = append(created, feed)
+	}
+	return created, nil
+}
+
+// exportOutlines writes every stored feed as an OPML document
+func (a *app) exportOutlines(w io.Writer, withDeleted bool) error {
+	stored, err := a.feeds.List(withDeleted)
+	if err != nil {
+		return err
+	}
+	outlines := make([]opml.Outline, 0, len(stored))
+	for _, feed := range stored {
+		outlines = append(outlines, opml.Outline{Title: feed.Title, XMLURL: feed.Feed, HTMLURL: feed.Link})
+	}
+	return opml.Write(w, "echopan feeds", outlines, time.Now())
+}
+
+type importOpmlCmd struct {
+	app     *app
+	channel int
+}
+
+func (*importOpmlCmd) Name() string     { return "importOpml" }
+func (*importOpmlCmd) Synopsis() string { return "Import feeds from an OPML file." }
+func (*importOpmlCmd) Usage() string {
+	return `importOpml [-channel <id>] <file>:
+  Create a paused feed for every subscription of an OPML file. Feeds already stored are skipped.
+`
+}
+
+func (c *importOpmlCmd) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.channel, "channel", 0, "Telegram channel id given to the imported feeds")
+}
+
+func (c *importOpmlCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	file, err := os.Open(f.Arg(0))
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	defer file.Close()
+	outlines, err := opml.Parse(file)
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	created, err := c.app.importOutlines(outlines, c.channel)
+	for _, feed := range created {
+		fmt.Printf("%d: %s\n", feed.ID, feed.Title)
+	}
+	if err != nil {
+		log.Println("Error importing feeds:", err)
+		return subcommands.ExitFailure
+	}
+	fmt.Printf("Imported %d of %d feeds\n", len(created), len(outlines))
+	return subcommands.ExitSuccess
+}
+
+type exportOpmlCmd struct {
+	app  *app
+	file string
+	all  bool
+}
+
+func (*exportOpmlCmd) Name() string     { return "exportOpml" }
+func (*exportOpmlCmd) Synopsis() string { return "Export feeds as an OPML file." }
+func (*exportOpmlCmd) Usage() string {
+	return `exportOpml [-file <path>] [-all]:
+  Write all feeds with their titles and URLs as OPML.
+`
+}
+
+func (c *exportOpmlCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.file, "file", "", "Output file, standard output when empty")
+	f.BoolVar(&c.all, "all", false, "Include deleted feeds")
+}
+
+func (c *exportOpmlCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	var w io.Writer = os.Stdout
+	if c.file != "" {
+		file, err := os.Create(c.file)
+		if err != nil {
+			log.Println(err)
+			return subcommands.ExitFailure
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := c.app.exportOutlines(w, c.all); err != nil {
+		log.Println("Error exporting feeds:", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/opml"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestImportExportOutlines(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Image{})
+	db.Create(&models.Feed{Title: "Stored", Feed: "https://example.com/stored.rss"})
+	a := newApp(db)
+
+	created, err := a.importOutlines([]opml.Outline{
+		{Title: "Stored again", XMLURL: "https://example.com/stored.rss"},
+		{Title: "New", XMLURL: "https://example.com/new.rss", HTMLURL: "https://example.com/new"},
+		{XMLURL: "https://example.com/untitled.rss"},
+	}, -100)
+	assert.NoError(t, err)
+	if assert.Len(t, created, 2) {
+		assert.Equal(t, "New", created[0].Title)
+		assert.Equal(t, -100, created[0].TgChannel)
+		assert.False(t, created[0].PublishReady)
+		assert.Equal(t, "https://example.com/untitled.rss", created[1].Title)
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, a.exportOutlines(&out, false))
+	outlines, err := opml.Parse(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, []opml.Outline{
+		{Title: "Stored", XMLURL: "https://example.com/stored.rss"},
+		{Title: "New", XMLURL: "https://example.com/new.rss", HTMLURL: "https://example.com/new"},
+		{Title: "https://example.com/untitled.rss", XMLURL: "https://example.com/untitled.rss"},
+	}, outlines)
+}
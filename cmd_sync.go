@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mmcdole/gofeed"
+	"github.com/tutuna/echopan/internals/feedsync"
+)
+
+// describeNewFeeds fills in the title, description and link of the feeds the
+// plan creates without a title in the file
+func describeNewFeeds(plan feedsync.Plan) error {
+	fp := gofeed.NewParser()
+	for i, c := range plan.Changes {
+		if c.Action != feedsync.ActionCreate || c.Feed.Title != "" {
+			continue
+		}
+		feedData, err := fp.ParseURL(c.Feed.Feed)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", c.Feed.Feed, err)
+		}
+		plan.Changes[i].Feed.Title = feedData.Title
+		plan.Changes[i].Feed.Description = feedData.Description
+		plan.Changes[i].Feed.Link = feedData.Link
+	}
+	return nil
+}
+
+type syncCmd struct {
+	app    *app
+	file   string
+	dryRun bool
+}
+
+func (*syncCmd) Name() string     { return "sync" }
+func (*syncCmd) Synopsis() string { return "Reconcile feeds with a feeds file." }
+func (*syncCmd) Usage() string {
+	return `sync -file <feeds.yaml> [-dry-run]:
+  Create and update the feeds listed in the file and pause the feeds missing from it.
+  Deleted feeds listed in the file are restored.
+  The changes are printed as a diff before they are applied.
+`
+}
+
+func (c *syncCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.file, "file", "", "Path of the feeds file")
+	f.BoolVar(&c.dryRun, "dry-run", false, "Only print the changes")
+}
+
+func (c *syncCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.file == "" {
+		f.PrintDefaults()
+		return subcommands.ExitUsageError
+	}
+	file, err := feedsync.LoadFile(c.file)
+	if err != nil {
+		log.Printf("Invalid feeds file:\n%v", err)
+		return subcommands.ExitFailure
+	}
+	stored, err := c.app.feeds.List(true)
+	if err != nil {
+		log.Println("Error getting feeds:", err)
+		return subcommands.ExitFailure
+	}
+	plan := feedsync.Diff(stored, file.Feeds)
+	if err := plan.Write(os.Stdout); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	if c.dryRun || plan.Empty() {
+		return subcommands.ExitSuccess
+	}
+	if err := describeNewFeeds(plan); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	if err := c.app.feeds.Sync(plan); err != nil {
+		log.Println("Error applying changes:", err)
+		return subcommands.ExitFailure
+	}
+	fmt.Println("Feeds are in sync")
+	return subcommands.ExitSuccess
+}
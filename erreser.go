@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/pkg/errors"
+	"github.com/tutuna/echopan/internals/alerts"
+	"github.com/tutuna/echopan/internals/caption"
+	"github.com/tutuna/echopan/internals/config"
 	"github.com/tutuna/echopan/internals/database"
 	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/health"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/logging"
+	"github.com/tutuna/echopan/internals/metrics"
 	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/repository"
+	"github.com/tutuna/echopan/internals/shownotes"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/subcommands"
@@ -23,200 +35,366 @@ import (
 	"gorm.io/gorm"
 )
 
-func addFeed(feed string) {
-	log.Println("Showing RSS feed data for: ", feed)
-	fp := gofeed.NewParser()
-	feedData, err := fp.ParseURL(feed)
+// app holds the configuration, the database handle and the repositories
+// shared by every command
+type app struct {
+	cfg        *config.Config
+	cfgErr     error
+	metrics    *metrics.Metrics
+	health     *health.Tracker
+	alerts     *alerts.Alerter
+	db         *gorm.DB
+	feeds      repository.FeedRepo
+	items      repository.ItemRepo
+	enclosures repository.EnclosureRepo
+	// publishing serializes the publishing rounds of the service and the
+	// publications started from the API
+	publishing sync.Mutex
+	// busy is set while a publishing round runs, for the API status
+	busy atomic.Bool
+}
+
+func newApp(db *gorm.DB) *app {
+	a := &app{cfg: config.Default(), metrics: metrics.New(), health: health.NewTracker(), alerts: alerts.New(nil, alerts.Options{})}
+	a.setDb(db)
+	return a
+}
+
+func (a *app) setDb(db *gorm.DB) {
+	repos := repository.New(db)
+	a.db = db
+	a.feeds = repos.Feeds
+	a.items = repos.Items
+	a.enclosures = repos.Enclosures
+}
+
+// close releases the database pool, it is a no-op when no database was opened
+func (a *app) close() {
+	if a.db == nil {
+		return
+	}
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		return
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Println("Error closing database:", err)
+	}
+}
+
+func (a *app) addFeed(feed string) {
+	slog.Info("Adding feed", "url", feed)
+	stored, created, err := a.storeFeed(feed)
 	if err != nil {
-		log.Println("Error parsing feed: ", err)
+		slog.Error("Error adding feed", "url", feed, "error", err)
 		return
 	}
-	mf := models.Feed{
-		Title:       feedData.Title,
-		Description: feedData.Description,
-		Link:        feedData.Link,
-		Feed:        feed,
+	if !created {
+		slog.Warn("A feed already uses this url or podcast:guid", logging.FeedID, stored.ID, "title", stored.Title)
+		return
 	}
+	slog.Info("Feed added", logging.FeedID, stored.ID, "title", stored.Title)
+}
 
-	dbParams := database.InitDbParams()
-	db := database.DbConnect(dbParams)
-	db.AutoMigrate(&models.Feed{})
-	var existingFeed models.Feed
-	db.Where(&models.Feed{Title: mf.Title}).FirstOrCreate(&existingFeed, mf)
+// storeFeed fetches the feed and stores it with its image, unless a feed
+// with the same URL or podcast:guid exists. created reports whether it is new.
+func (a *app) storeFeed(url string) (models.Feed, bool, error) {
+	fp := gofeed.NewParser()
+	feedData, err := fp.ParseURL(url)
+	if err != nil {
+		return models.Feed{}, false, fmt.Errorf("parsing feed: %w", err)
+	}
+	stored, created, err := a.feeds.FirstOrCreateByURL(feeds.NewFeed(feedData, url))
+	if err != nil {
+		return models.Feed{}, false, fmt.Errorf("saving feed: %w", err)
+	}
+	if feedData.Image == nil {
+		return stored, created, nil
+	}
 	image := models.Image{
 		Url:    feedData.Image.URL,
 		Title:  feedData.Image.Title,
-		FeedId: int(existingFeed.ID),
+		FeedId: int(stored.ID),
 	}
-	db.Where(&models.Image{FeedId: int(existingFeed.ID)}).FirstOrCreate(&models.Image{}, image)
+	if err := a.feeds.CreateImageIfMissing(image); err != nil {
+		slog.Warn("Error saving feed image", logging.FeedID, stored.ID, "error", err)
+	}
+	return stored, created, nil
+}
 
+// updateItems stores the fetched items of the feed and logs the ingestion report.
+// The new enclosures the feed gave no length for are sized afterwards.
+func (a *app) updateItems(fetched []*gofeed.Item, feed *models.Feed) (items.IngestReport, error) {
+	list := make([]models.Item, 0, len(fetched))
+	for _, v := range fetched {
+		list = append(list, feeds.NewItem(v, int(feed.ID)))
+	}
+	logger := slog.With(logging.FeedID, feed.ID)
+	report, err := a.items.Ingest(feed.ID, list)
+	if err != nil {
+		logger.Error("Error storing items", "error", err)
+		return report, err
+	}
+	a.sizeEnclosures(report.Unsized)
+	a.metrics.ItemsIngested(feed.ID, report.Created, report.Updated, len(report.Rejected))
+	for _, r := range report.Rejected {
+		logger.Warn("Rejected item", "title", r.Title, "reason", r.Reason)
+	}
+	logger.Info("Items ingested", "created", report.Created, "updated", report.Updated, "rejected", len(report.Rejected))
+	return report, nil
 }
 
-func reInitFeeds() {
-	log.Println("Reinitializing feeds")
-	dbParams := database.InitDbParams()
-	db := database.DbConnect(dbParams)
-	db.AutoMigrate(&models.Feed{})
-	db.AutoMigrate(&models.Image{})
-	// Get all feeds from the database
-	var feeds []models.Feed
-	if err := db.Find(&feeds).Error; err != nil {
-		log.Panic("Error getting feeds:", err)
+// sizeEnclosures asks the servers for the length of the enclosures, outside
+// of the ingestion transaction
+func (a *app) sizeEnclosures(enclosures []models.Enclosure) {
+	if len(enclosures) == 0 {
+		return
 	}
-	for _, feed := range feeds {
-		url := feed.Feed
-		fp := gofeed.NewParser()
-		feedData, err := fp.ParseURL(url)
-		if err != nil {
-			log.Println("Error parsing feed: ", err)
-			return
-		}
-		image := models.Image{
-			Url:   feedData.Image.URL,
-			Title: feedData.Image.Title,
-		}
-		feed.Image = image
-		db.Save(&feed)
-	}
-}
-
-func updateItems(db *gorm.DB, items []*gofeed.Item, feed *models.Feed) error {
-	db.AutoMigrate(&models.Item{})
-	db.AutoMigrate(&models.Enclosure{})
-	for _, v := range items {
-		item := models.Item{
-			Title:                   v.Title,
-			Description:             v.Description,
-			Content:                 v.Content,
-			Link:                    v.Link,
-			Updated:                 v.Updated,
-			UpdatedParsed:           v.UpdatedParsed,
-			Published:               v.Published,
-			PublishedParsed:         v.PublishedParsed,
-			FeedId:                  int(feed.ID),
-			TgPublished:             0,
-			ItunesAuthor:            v.ITunesExt.Author,
-			ItunesBlock:             v.ITunesExt.Block,
-			ItunesDuration:          v.ITunesExt.Duration,
-			ItunesExplicit:          v.ITunesExt.Explicit,
-			ItunesKeywords:          v.ITunesExt.Keywords,
-			ItunesSubtitle:          v.ITunesExt.Subtitle,
-			ItunesSummary:           v.ITunesExt.Summary,
-			ItunesImage:             v.ITunesExt.Image,
-			ItunesIsClosedCaptioned: v.ITunesExt.IsClosedCaptioned,
-			ItunesEpisode:           v.ITunesExt.Episode,
-			ItunesSeason:            v.ITunesExt.Season,
-			ItunesOrder:             v.ITunesExt.Order,
-			ItunesEpisodeType:       v.ITunesExt.EpisodeType,
+	fetcher := feeds.NewFetcher()
+	for _, enc := range enclosures {
+		length := fetcher.ContentLength(enc.Url)
+		if length == 0 {
+			continue
 		}
-		var existingItem models.Item
-		db.Where(&models.Item{Title: item.Title}).FirstOrCreate(&existingItem, item)
-		for _, enc := range v.Enclosures {
-			encInt, err := strconv.ParseUint(enc.Length, 10, 64)
-			if err != nil {
-				log.Println("Error parsing enclosure length: ", err)
-				return err
-			}
-			enclosure := models.Enclosure{
-				Url:    enc.URL,
-				Length: encInt,
-				Type:   enc.Type,
-				ItemId: existingItem.ID,
-			}
-			db.Where(&models.Enclosure{Url: enclosure.Url}).FirstOrCreate(&models.Enclosure{}, enclosure)
+		if err := a.enclosures.SetLength(enc.ID, length); err != nil {
+			slog.Error("Error storing enclosure length", logging.ItemID, enc.ItemId, "error", err)
 		}
 	}
-	return nil
 }
-func fullFeed(feedTitle string) {
-	dbParams := database.InitDbParams()
-	db := database.DbConnect(dbParams)
-	var feed models.Feed
-	db.Where(&models.Feed{Title: feedTitle}).First(&feed)
-	log.Println("Checking feed: ", feed.Title)
-	fp := gofeed.NewParser()
-	feedData, err := fp.ParseURL(feed.Feed)
+
+func (a *app) fullFeed(selector string, limit int) {
+	feed, err := a.feeds.Resolve(selector)
 	if err != nil {
-		log.Println("Error parsing feed: ", err)
+		slog.Error("Error finding feed", "feed", selector, "error", err)
 		return
 	}
-	if len(feedData.Items) > 200 {
-		updateItems(db, feedData.Items[:200], &feed)
-	} else {
-		updateItems(db, feedData.Items, &feed)
+	logger := slog.With(logging.FeedID, feed.ID)
+	logger.Info("Checking feed", "title", feed.Title)
+	start := time.Now()
+	result, err := feeds.NewFetcher().Fetch(feed.Feed, feeds.FetchOptions{MaxItems: limit})
+	a.metrics.FeedFetched(feed.ID, time.Since(start), err)
+	a.recordFetch(feed, err)
+	if err != nil {
+		logger.Error("Error fetching feed", "error", err)
+		return
+	}
+	logger.Info("Fetched feed", "items", len(result.Items), "pages", result.Pages)
+	a.followMove(feed, result)
+	a.updatePodcast(feed, result.Feed)
+	a.updateImage(feed, result.Feed)
+	a.updateItems(result.Items, &feed)
+}
 
+func (a *app) checkFeeds(limit int) {
+	allFeeds, err := a.feeds.All()
+	if err != nil {
+		slog.Error("Error getting feeds", "error", err)
+		return
 	}
+	fetcher := feeds.NewFetcher()
+	policy := a.healthPolicy()
+	for _, feed := range allFeeds {
+		logger := slog.With(logging.FeedID, feed.ID)
+		if !policy.ShouldFetch(feed, time.Now()) {
+			logger.Debug("Skipping failing feed", "failures", feed.ConsecutiveFailures, "quarantined", feed.Quarantined)
+			continue
+		}
+		logger.Info("Checking feed", "title", feed.Title)
+		start := time.Now()
+		result, err := fetcher.Fetch(feed.Feed, feeds.FetchOptions{
+			MaxItems: limit,
+			Known:    a.items.Known(feed),
+		})
+		a.metrics.FeedFetched(feed.ID, time.Since(start), err)
+		a.recordFetch(feed, err)
+		if err != nil {
+			logger.Error("Error fetching feed", "error", err)
+			continue
+		}
+		logger.Info("Fetched feed", "items", len(result.Items), "pages", result.Pages)
+		a.followMove(feed, result)
+		a.updatePodcast(feed, result.Feed)
+		a.updateImage(feed, result.Feed)
+		a.updateItems(result.Items, &feed)
+	}
+}
 
+// healthPolicy returns the backoff and quarantine settings of failing feeds
+func (a *app) healthPolicy() feeds.HealthPolicy {
+	return feeds.HealthPolicy{
+		Backoff:         a.cfg.Feeds.Backoff,
+		MaxBackoff:      a.cfg.Feeds.MaxBackoff,
+		QuarantineAfter: a.cfg.Feeds.QuarantineAfter,
+	}
 }
-func checkFeeds() {
-	dbParams := database.InitDbParams()
-	db := database.DbConnect(dbParams)
-	feeds, err := feeds.GetAllFeeds(db)
+
+// recordFetch stores the outcome of a fetch of the feed and alerts on
+// repeated failures
+func (a *app) recordFetch(feed models.Feed, fetchErr error) {
+	logger := slog.With(logging.FeedID, feed.ID)
+	updated, err := a.feeds.RecordFetch(feed.ID, fetchErr, time.Now(), a.healthPolicy())
 	if err != nil {
-		log.Println("Error getting feeds:", err)
+		logger.Error("Error recording feed health", "error", err)
 		return
 	}
-	for _, feed := range feeds {
-		log.Println("Checking feed: ", feed.Title)
-		fp := gofeed.NewParser()
-		feedData, err := fp.ParseURL(feed.Feed)
-		if err != nil {
-			log.Println("Error parsing feed: ", err)
-			return
+	if updated.Quarantined && !feed.Quarantined {
+		logger.Warn("Feed quarantined", "failures", updated.ConsecutiveFailures)
+	}
+	a.alertFetch(updated, fetchErr)
+}
+
+// followMove stores the new location of a feed that moved. The operators are
+// alerted when the new feed shares no episode with the stored ones, it may
+// not be the same podcast, so it runs before the fetched items are stored.
+func (a *app) followMove(feed models.Feed, result *feeds.FetchResult) {
+	if result.MovedTo == "" {
+		return
+	}
+	logger := slog.With(logging.FeedID, feed.ID)
+	logger.Warn("Feed moved", "from", feed.Feed, "to", result.MovedTo, "reason", result.MovedBy)
+	if err := a.feeds.Move(feed.ID, result.MovedTo, result.MovedBy); err != nil {
+		logger.Error("Error updating feed url", "error", err)
+		return
+	}
+
+	problem := "shares no episode with the stored ones"
+	moved, err := feeds.NewFetcher().Fetch(result.MovedTo, feeds.FetchOptions{MaxPages: 1})
+	if err != nil {
+		problem = fmt.Sprintf("cannot be fetched: %v", err)
+	} else {
+		known := a.items.Known(feed)
+		for _, item := range moved.Items {
+			if known(item) {
+				return
+			}
 		}
-		items := feedData.Items[:9]
-		updateItems(db, items, &feed)
 	}
+	a.raise(alerts.Alert{
+		Kind: alerts.KindFeedMoved,
+		Key:  fmt.Sprintf("%s:%d", alerts.KindFeedMoved, feed.ID),
+		Text: fmt.Sprintf("Feed %d %s moved (%s) from %s to %s, the new feed %s",
+			feed.ID, feed.Title, result.MovedBy, feed.Feed, result.MovedTo, problem),
+	})
 }
 
-func printReadyFeeds() {
-	DbParams := database.InitDbParams()
-	db := database.DbConnect(DbParams)
-	feeds := getReadyFeeds(db)
+func (a *app) printReadyFeeds() {
+	feeds := a.getReadyFeeds()
 	for _, feed := range feeds {
 		fmt.Printf("%d: %s\n", feed.ID, feed.Title)
 	}
 }
 
-func getReadyFeeds(db *gorm.DB) []models.Feed {
-	var feeds []models.Feed
-	db.Where(&models.Feed{PublishReady: true}).Find(&feeds)
+func (a *app) getReadyFeeds() []models.Feed {
+	feeds, err := a.feeds.Ready()
+	if err != nil {
+		slog.Error("Error getting ready feeds", "error", err)
+	}
 	return feeds
 }
 
-func getFeedById(db *gorm.DB, id int) models.Feed {
-	var feed models.Feed
-	db.First(&feed, id)
+// getDueFeeds returns the ready feeds whose schedule allows publishing now
+func (a *app) getDueFeeds() []models.Feed {
+	var due []models.Feed
+	for _, feed := range a.getReadyFeeds() {
+		if feeds.Due(feed, time.Now()) {
+			due = append(due, feed)
+		}
+	}
+	return due
+}
+
+// markFeedPublished records the publication time checked by the feed schedule
+func (a *app) markFeedPublished(feed models.Feed) {
+	now := time.Now()
+	a.metrics.EpisodePublished(feed.ID, now)
+	if err := a.feeds.Update(feed.ID, map[string]interface{}{"last_pub_date": now}); err != nil {
+		slog.Error("Error updating feed", logging.FeedID, feed.ID, "error", err)
+	}
+}
+
+func (a *app) getFeedById(id int) models.Feed {
+	feed, err := a.feeds.Get(uint(id))
+	if err != nil {
+		slog.Error("Error getting feed", logging.FeedID, id, "error", err)
+	}
 	return feed
 }
 
-func getFirstUnpublishedItem(db *gorm.DB, feed models.Feed) (models.Item, error) {
-	var item models.Item
-	result := db.Where(&models.Item{FeedId: int(feed.ID), TgPublished: 0}).Not(&models.Item{TgPublished: 1}).Order("published_parsed asc").First(&item)
-	if result.Error != nil && errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		log.Println("No unpublished items found")
-		return models.Item{}, result.Error
+// getFirstUnpublishedItem returns the oldest pending item of the feed,
+// skipping the items rejected by the filter rules of the feed on the way
+func (a *app) getFirstUnpublishedItem(feed models.Feed) (models.Item, error) {
+	rules, err := feeds.ParseRules(feed)
+	if err != nil {
+		slog.Error("Invalid filter rules", logging.FeedID, feed.ID, "error", err)
+		return models.Item{}, err
 	}
-	log.Printf("First unpublished item: %s", item.Title)
-	log.Printf("First unpublished item: %s", item.Title)
-	return item, nil
+	for {
+		item, err := a.items.FirstUnpublished(feed.ID)
+		if err != nil {
+			return models.Item{}, err
+		}
+		skipped, err := a.skipFiltered(feed, rules, item)
+		if err != nil {
+			return models.Item{}, err
+		}
+		if !skipped {
+			slog.Debug("First unpublished item", logging.FeedID, feed.ID, logging.ItemID, item.ID, "title", item.Title)
+			return item, nil
+		}
+	}
+}
+
+// skipFiltered moves the item to the skipped state when the publishing
+// policy or the rules of the feed reject it and reports whether they did
+func (a *app) skipFiltered(feed models.Feed, rules feeds.Rules, item models.Item) (bool, error) {
+	reason := a.policySkip(feed, item)
+	if reason == "" {
+		reason = rules.Skip(item)
+	}
+	if reason == "" {
+		return false, nil
+	}
+	if err := a.items.Skip(item.ID, reason); err != nil {
+		slog.Error("Error skipping item", logging.FeedID, item.FeedId, logging.ItemID, item.ID, "error", err)
+		return false, err
+	}
+	slog.Info("Item skipped", logging.FeedID, item.FeedId, logging.ItemID, item.ID, "reason", reason)
+	return true, nil
 }
 
-func getUnpublishedItems(db *gorm.DB, feed models.Feed) []models.Item {
-	var items []models.Item
-	//sorted by published date from the oldest to the newest
-	db.Where(map[string]interface{}{"feed_id": int(feed.ID), "tg_published": 0}).Order("published_parsed asc").Find(&items)
+// policySkip returns why the item must never be published to the channel of
+// the feed, empty when it may be: blocked items and, depending on the
+// channel policy, explicit ones
+func (a *app) policySkip(feed models.Feed, item models.Item) string {
+	if feeds.Blocked(item) {
+		return "itunes:block"
+	}
+	if feeds.Explicit(item) && a.cfg.Publish.ExplicitPolicy(int64(feed.TgChannel)) == config.ExplicitSkip {
+		return "explicit, skipped in this channel"
+	}
+	return ""
+}
+
+func (a *app) getUnpublishedItems(feed models.Feed) []models.Item {
+	items, err := a.items.Unpublished(feed.ID)
+	if err != nil {
+		slog.Error("Error getting unpublished items", logging.FeedID, feed.ID, "error", err)
+	}
 	return items
 }
 
-func downloadFile(url string) string {
-	log.Printf("Downloading file: %s", url)
-	resp, err := http.Get(url)
+// downloadFile saves url to a temporary file and returns its path. The
+// client bounds the whole transfer, a hung download must not hold the
+// publishing lock.
+func downloadFile(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
 	if err != nil {
-		// handle error
-		log.Fatal(err)
+		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http error: %s", resp.Status)
+	}
 
 	// Get the file name from the URL
 	fileName := ""
@@ -231,74 +409,102 @@ func downloadFile(url string) string {
 	// Create a temporary file in the /tmp directory
 	tmpFile, err := os.CreateTemp("", fileName)
 	if err != nil {
-		// handle error
-		log.Fatal(err)
+		return "", err
 	}
 	defer tmpFile.Close()
 
 	// Copy the response body to the temporary file
-	_, err = io.Copy(tmpFile, resp.Body)
-	if err != nil {
-		// handle error
-		log.Fatal(err)
+	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
+		deleteFile(tmpFile.Name())
+		return "", err
 	}
 
 	// Return the path of the temporary file
-	return tmpFile.Name()
+	return tmpFile.Name(), nil
 }
 
 // DownloadEpisode downloads an episode file using the first available enclosure associated with the given item.
-// It queries the database for up to one enclosure corresponding to the item's ID. If an enclosure is found,
+// It queries the enclosure repository for up to one enclosure corresponding to the item's ID. If an enclosure is found,
 // it downloads the file from the enclosure's URL by calling downloadFile, logs the progress, and returns the local file path.
 // If no enclosure is found, it logs an appropriate message and returns an empty string.
+// Download errors are returned, the transfer is bounded by service.stall_timeout.
 //
 // Parameters:
 //
-//	db   - Pointer to the gorm.DB instance used for database queries.
 //	item - The models.Item instance representing the episode, whose Title is used for logging and ID for lookup.
 //
 // Returns:
 //
-//	The local file path to the downloaded episode file as a string, or an empty string if no enclosure is available.
+//	The local file path to the downloaded episode file as a string, or an empty string if no enclosure is available,
+//	and the download error.
 //
 // Example usage:
 //
-//	filePath := downloadEpisode(db, item)
-//	if filePath == "" {
+//	filePath, err := a.downloadEpisode(item)
+//	if err == nil && filePath == "" {
 //	    log.Println("No enclosure found; download aborted.")
 //	}
-func downloadEpisode(db *gorm.DB, item models.Item) string {
+func (a *app) downloadEpisode(item models.Item) (string, error) {
 	// download the episode, the lik taken from enclosures URL
-	log.Printf("Downloading episode %s", item.Title)
-	var enclosures []models.Enclosure
-	db.Where(&models.Enclosure{ItemId: item.ID}).Limit(1).Find(&enclosures)
+	logger := slog.With(logging.FeedID, item.FeedId, logging.ItemID, item.ID)
+	enclosures, err := a.enclosures.ForItem(item.ID)
+	if err != nil {
+		logger.Error("Error getting enclosures", "error", err)
+		return "", nil
+	}
 	if len(enclosures) == 0 {
-		log.Printf("No enclosures found for item %s", item.Title)
-		return ""
+		logger.Warn("No enclosures found")
+		return "", nil
+	}
+	logger = logger.With(logging.EnclosureURL, enclosures[0].Url)
+	logger.Info("Downloading episode", "title", item.Title)
+	start := time.Now()
+	done := a.health.StartDownload(enclosures[0].Url)
+	file, err := downloadFile(&http.Client{Timeout: a.cfg.Service.StallTimeout}, enclosures[0].Url)
+	done()
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", enclosures[0].Url, err)
 	}
-	log.Printf("Downloading episode %s", enclosures[0].Url)
-	file := downloadFile(enclosures[0].Url)
-	log.Printf("Downloaded episode: %s", file)
-	return file
+	if info, err := os.Stat(file); err == nil {
+		a.metrics.EpisodeDownloaded(info.Size(), time.Since(start))
+		logger.Info("Downloaded episode", "file", file, "bytes", info.Size(), "duration", time.Since(start))
+	}
+	return file, nil
 }
 
 func deleteFile(file string) {
-	log.Printf("Deleting file: %s", file)
-	err := os.Remove(file)
-	if err != nil {
-		log.Fatal(err)
+	if err := os.Remove(file); err != nil {
+		slog.Error("Error deleting file", "file", file, "error", err)
+		return
+	}
+	slog.Debug("Deleted file", "file", file)
+}
+
+// newBot connects to the Telegram bot API with the configured token and URL
+func (a *app) newBot() (*telebot.Bot, error) {
+	if a.cfg.Telegram.BotToken == "" {
+		return nil, errors.New("EP_TG_BOT_TOKEN is not set")
 	}
-	log.Printf("Deleted file: %s", file)
+	return telebot.NewBot(telebot.Settings{
+		Token:  a.cfg.Telegram.BotToken,
+		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
+		URL:    a.cfg.Telegram.BotURL,
+	})
 }
 
 // publishToTheChannel sends an audio file representing a podcast episode to a Telegram channel.
-// It retrieves the bot token from the EP_TG_BOT_TOKEN environment variable (and the API URL from EP_TG_BOT_URL),
-// then initializes a Telegram bot to send an audio message. The function logs key details such as the episode title,
-// publication count, and item ID, and processes the episode caption by truncating the subtitle to 800 characters
-// (if needed), omitting it when the feed ID equals 34, and appending an extra link if ExtraLinkEnabled is true.
+// It takes the bot token and API URL from the telegram section of the configuration,
+// then initializes a Telegram bot to send an audio message. The function logs the send with the feed, item and chat ids,
+// and processes the episode caption by picking the subtitle following the caption options of the feed, by default
+// truncated to publish.subtitle_limit characters (see captionSubtitle), and then either rendering the feed's caption template
+// or appending an extra link if ExtraLinkEnabled is true (see itemCaption). Explicit episodes get a warning
+// in channels whose publish.explicit policy is mark (see markExplicit).
 // The audio file is constructed with a Markdown-formatted caption and sent to the Telegram channel.
-// In case of errors, if the error message indicates that the file is too large or the text encoding is not UTF-8,
-// a corresponding log message is produced; all other errors trigger a panic.
+// With publish.chapters the episode chapters are listed under the caption, or in a reply to the
+// audio message when the caption would exceed the Telegram limit (see withChapters).
+// Feeds with show notes get them as replies or as a page linked from the caption (see shownotes.go).
+// It returns the id of the audio message, stored with the item (see updateItem). Errors are returned
+// to the caller, which marks the item as failed (see failItem).
 //
 // Parameters:
 //
@@ -306,159 +512,342 @@ func deleteFile(file string) {
 //	item        - a models.Item containing episode details such as Title, ItunesSubtitle, TgPublished, ID, and FeedId.
 //	episodeFile - a string specifying the path of the downloaded audio file to be published.
 //
-// Environment Variables:
+// Configuration:
 //
-//	EP_TG_BOT_TOKEN - Telegram bot token; the function panics if not set.
-//	EP_TG_BOT_URL   - Optional Telegram bot API URL.
-//
-// Note: This function does not return a value and will log or panic on critical errors.
-func publishToTheChannel(feed models.Feed, item models.Item, episodeFile string) {
-	log.Printf("Publishing to telegram %s", item.Title)
-	log.Printf("Published %d", item.TgPublished)
-	log.Printf("item id %d", item.ID)
-	botToken := os.Getenv("EP_TG_BOT_TOKEN")
-	if botToken == "" {
-		log.Panic("EP_TG_BOT_TOKEN is not set")
-	}
-
-	bot, err := telebot.NewBot(telebot.Settings{
-		Token:  botToken,
-		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
-		URL:    os.Getenv("EP_TG_BOT_URL"),
-	})
-
+//	telegram.bot_token - Telegram bot token (EP_TG_BOT_TOKEN); an error is returned if not set.
+//	telegram.bot_url   - Optional Telegram bot API URL (EP_TG_BOT_URL).
+func (a *app) publishToTheChannel(feed models.Feed, item models.Item, episodeFile string) (int, error) {
+	bot, err := a.newBot()
 	if err != nil {
-		log.Panic(err)
+		return 0, err
 	}
 
 	channel := &telebot.Chat{ID: int64(feed.TgChannel)}
-	log.Println(item.ItunesSubtitle)
-	subtitle := item.ItunesSubtitle
+	logger := slog.With(logging.FeedID, feed.ID, logging.ItemID, item.ID, logging.ChatID, channel.ID)
+	logger.Info("Publishing to telegram", "title", item.Title)
+	text, reply := withChapters(a.markExplicit(feed, item, a.itemCaption(feed, item)), a.itemChapters(item, episodeFile))
+	file := &telebot.Audio{File: telebot.FromDisk(episodeFile), MIME: "audio/mpeg", FileName: fmt.Sprintf("*%s*.mp3", item.Title), Caption: text}
+	start := time.Now()
+	msg, err := bot.Send(channel, file, &telebot.SendOptions{
+		ParseMode: telebot.ModeMarkdown,
+	})
+	a.metrics.TelegramSent(time.Since(start), sendErrorClass(err))
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("Published to telegram", "duration", time.Since(start))
+	// the episode is out, missing chapters or show notes do not fail it
+	if reply != "" {
+		if _, err := bot.Send(channel, reply, &telebot.SendOptions{ReplyTo: msg}); err != nil {
+			logger.Warn("Error sending chapters", "error", err)
+		}
+	}
+	if a.showNotesMode(feed) == shownotes.ModeReply {
+		if err := sendShowNotes(bot, channel, msg, itemShowNotes(item)); err != nil {
+			logger.Warn("Error sending show notes", "error", err)
+		}
+	}
+	return msg.ID, nil
+}
 
-	if len(item.ItunesSubtitle) > 800 {
-		subtitle = item.ItunesSubtitle[:800] + "..."
+// sendErrorClass sorts Telegram send errors for the metrics, it returns an
+// empty class for nil
+func sendErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case strings.Contains(err.Error(), "Request Entity Too Large"):
+		return metrics.SendErrorTooLarge
+	case strings.Contains(err.Error(), "text must be encoded in UTF-8"):
+		return metrics.SendErrorEncoding
+	default:
+		return metrics.SendErrorOther
 	}
-	if item.FeedId == 34 {
-		subtitle = ""
+}
+
+// itemCaption renders the caption template of the feed, or the default
+// caption when the feed has none or its template fails
+func (a *app) itemCaption(feed models.Feed, item models.Item) string {
+	subtitle := a.captionSubtitle(feed, item)
+	data := a.podcastCaption(feed, item)
+	if a.showNotesMode(feed) == shownotes.ModePage {
+		data.NotesURL = a.notesURL(item)
+	}
+	data.Season = firstNonEmpty(item.ItunesSeason, item.PodcastSeason)
+	data.Episode = firstNonEmpty(item.ItunesEpisode, item.PodcastEpisode)
+	if feed.CaptionTemplate != "" {
+		data.Title = item.Title
+		data.Subtitle = subtitle
+		data.Link = item.Link
+		data.FeedTitle = feed.Title
+		data.ExtraLink = feed.ExtraLink
+		text, err := caption.Render(feed.CaptionTemplate, data)
+		if err == nil {
+			return text
+		}
+		slog.Warn("Error rendering caption", logging.FeedID, feed.ID, logging.ItemID, item.ID, "error", err)
+	}
+	if feed.CaptionSource == caption.SourceSummary || feed.CaptionSource == caption.SourceDescription {
+		// the text of the show notes is not written for Markdown captions
+		subtitle = caption.Escape(subtitle)
+	}
+	if data.NotesURL != "" {
+		subtitle += "\n\n" + data.NotesURL
 	}
 	if feed.ExtraLinkEnabled {
 		subtitle += fmt.Sprintf("\n\n%s", feed.ExtraLink)
+	} else if len(data.Funding) > 0 {
+		// the funding links of the feed stand in for the manual extra link,
+		// they come from the feed and must not break the Markdown caption
+		subtitle += "\n"
+		for _, link := range data.Funding {
+			target := caption.Escape(link.URL)
+			if link.Text != "" {
+				subtitle += "\n" + caption.Escape(link.Text) + ": " + target
+			} else {
+				subtitle += "\n" + target
+			}
+		}
 	}
-	file := &telebot.Audio{File: telebot.FromDisk(episodeFile), MIME: "audio/mpeg", FileName: fmt.Sprintf("*%s*.mp3", item.Title), Caption: fmt.Sprintf("*%s*\n\n%s", item.Title, subtitle)}
-	_, err = bot.Send(channel, file, &telebot.SendOptions{
-		ParseMode: telebot.ModeMarkdown,
-	})
+	heading := fmt.Sprintf("*%s*", item.Title)
+	if numbers := caption.Numbers(data.Season, data.Episode); feed.CaptionNumbers && numbers != "" {
+		heading += " (" + numbers + ")"
+	}
+	return fmt.Sprintf("%s\n\n%s", heading, subtitle)
+}
+
+// captionSubtitle picks the subtitle of the caption following the caption
+// options of the feed
+func (a *app) captionSubtitle(feed models.Feed, item models.Item) string {
+	if feed.CaptionHideSubtitle {
+		return ""
+	}
+	text := item.ItunesSubtitle
+	switch feed.CaptionSource {
+	case caption.SourceSummary:
+		text = shownotes.Parse(item.ItunesSummary).Text
+	case caption.SourceDescription:
+		text = shownotes.Parse(item.Description).Text
+	}
+	if feed.CaptionStripLinks {
+		text = caption.StripLinks(text)
+	}
+	limit := a.cfg.Publish.SubtitleLimit
+	if feed.CaptionMaxLength > 0 {
+		limit = feed.CaptionMaxLength
+	}
+	return caption.Truncate(text, limit)
+}
+
+// explicitWarning prefixes the caption of explicit episodes in channels
+// with the mark policy
+const explicitWarning = "🔞 18+\n\n"
+
+// markExplicit adds the explicit warning to the caption when the channel of
+// the feed asks for it
+func (a *app) markExplicit(feed models.Feed, item models.Item, text string) string {
+	if feeds.Explicit(item) && a.cfg.Publish.ExplicitPolicy(int64(feed.TgChannel)) == config.ExplicitMark {
+		return explicitWarning + text
+	}
+	return text
+}
 
+// podcastCaption loads the podcast namespace of the item and its feed for
+// the caption, what cannot be loaded is left out
+func (a *app) podcastCaption(feed models.Feed, item models.Item) caption.Data {
+	logger := slog.With(logging.FeedID, feed.ID, logging.ItemID, item.ID)
+	var data caption.Data
+	if err := a.items.LoadPodcast(&item); err != nil {
+		logger.Debug("Error loading item podcast data", "error", err)
+	}
+	for _, person := range item.Persons {
+		data.Persons = append(data.Persons, caption.Person{Name: person.Name, Role: person.Role, Href: person.Href})
+	}
+	if len(item.Transcripts) > 0 {
+		data.Transcript = item.Transcripts[0].Url
+	}
+	data.ChaptersURL = item.ChaptersURL
+	funding, err := a.feeds.Funding(feed.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "Request Entity Too Large") {
-			log.Printf("File is too large, trying to send it as a document")
-		} else if strings.Contains(err.Error(), "text must be encoded in UTF-8") {
-			log.Printf("Text is not UTF-8 encoded, trying to send it as a document")
-		} else {
-			log.Panic(err)
+		logger.Debug("Error loading feed funding", "error", err)
+	}
+	for _, f := range funding {
+		data.Funding = append(data.Funding, caption.Link{URL: f.Url, Text: f.Text})
+	}
+	return data
+}
+
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
 		}
 	}
+	return ""
+}
+
+// updatePodcast stores the podcast:guid and funding links of a fetched feed
+func (a *app) updatePodcast(feed models.Feed, fetched *gofeed.Feed) {
+	if fetched == nil {
+		return
+	}
+	if err := a.feeds.UpdatePodcast(feed.ID, feeds.PodcastGUID(fetched), feeds.NewFunding(fetched)); err != nil {
+		slog.Error("Error storing podcast data", logging.FeedID, feed.ID, "error", err)
+	}
+}
+
+// updateImage refreshes the image of the feed from the fetched feed. Only the
+// image is written, the feed may have been edited since it was loaded.
+func (a *app) updateImage(feed models.Feed, fetched *gofeed.Feed) {
+	if fetched == nil || fetched.Image == nil {
+		return
+	}
+	image := models.Image{Url: fetched.Image.URL, Title: fetched.Image.Title, FeedId: int(feed.ID)}
+	if err := a.feeds.SetImage(image); err != nil {
+		slog.Error("Error saving feed image", logging.FeedID, feed.ID, "error", err)
+	}
 }
 
-func updateItem(db *gorm.DB, item models.Item) {
-	log.Printf("Updating item %s", item.Title)
-	log.Printf("Make item %s as published", item.Title)
-	db.Model(&models.Item{}).Where("id = ?", item.ID).Update("tg_published", 1)
+// updateItem marks the item published with its Telegram message, 0 when
+// nothing was sent
+func (a *app) updateItem(item models.Item, messageID int) {
+	if err := a.items.Publish(item.ID, messageID, time.Now()); err != nil {
+		slog.Error("Error marking item published", logging.FeedID, item.FeedId, logging.ItemID, item.ID, "error", err)
+		return
+	}
+	slog.Debug("Item marked published", logging.FeedID, item.FeedId, logging.ItemID, item.ID)
 }
 
-func publishOnebyFeedId(feedId int) {
-	DbParams := database.InitDbParams()
-	db := database.DbConnect(DbParams)
-	feed := getFeedById(db, feedId)
-	item, err := getFirstUnpublishedItem(db, feed)
+func (a *app) publishOnebyFeedId(feedId int) {
+	feed := a.getFeedById(feedId)
+	item, err := a.getFirstUnpublishedItem(feed)
 	if err != nil {
-		log.Printf("No unpublished items found for %s", feed.Title)
+		slog.Info("No unpublished items found", logging.FeedID, feed.ID)
+		return
+	}
+	episodeFile, err := a.downloadEpisode(item)
+	if err != nil {
+		a.failItem(feed, item, err)
 		return
 	}
-	episodeFile := downloadEpisode(db, item)
 	if episodeFile == "" {
-		log.Printf("No episode file found for %s", item.Title)
-		updateItem(db, item)
+		slog.Warn("No episode file, skipping the item", logging.FeedID, feed.ID, logging.ItemID, item.ID)
+		a.updateItem(item, 0)
+		return
+	}
+	messageID, err := a.publishToTheChannel(feed, item, episodeFile)
+	if err != nil {
+		a.failItem(feed, item, err)
+		deleteFile(episodeFile)
 		return
 	}
-	log.Println(episodeFile)
-	publishToTheChannel(feed, item, episodeFile)
 
-	updateItem(db, item)
+	a.updateItem(item, messageID)
+	a.markFeedPublished(feed)
 	deleteFile(episodeFile)
-	log.Printf("Sleeping for 5 seconds")
 }
 
-func publishOneItem() {
-	reInitFeeds()
-	checkFeeds()
-	DbParams := database.InitDbParams()
-	db := database.DbConnect(DbParams)
-	feeds := getReadyFeeds(db)
+func (a *app) publishOneItem() {
+	a.checkFeeds(a.cfg.Feeds.ItemLimit)
+	feeds := a.getDueFeeds()
 	for _, feed := range feeds {
-		item, err := getFirstUnpublishedItem(db, feed)
+		item, err := a.getFirstUnpublishedItem(feed)
 		if err != nil {
-			log.Printf("No unpublished items found for %s", feed.Title)
+			slog.Info("No unpublished items found", logging.FeedID, feed.ID)
+			continue
+		}
+		episodeFile, err := a.downloadEpisode(item)
+		if err != nil {
+			a.failItem(feed, item, err)
 			continue
 		}
-		episodeFile := downloadEpisode(db, item)
 		if episodeFile == "" {
-			log.Printf("No episode file found for %s", item.Title)
-			updateItem(db, item)
+			slog.Warn("No episode file, skipping the item", logging.FeedID, feed.ID, logging.ItemID, item.ID)
+			a.updateItem(item, 0)
+			continue
+		}
+		messageID, err := a.publishToTheChannel(feed, item, episodeFile)
+		if err != nil {
+			a.failItem(feed, item, err)
+			deleteFile(episodeFile)
 			continue
 		}
-		log.Println(episodeFile)
-		publishToTheChannel(feed, item, episodeFile)
 
-		updateItem(db, item)
+		a.updateItem(item, messageID)
+		a.markFeedPublished(feed)
 		deleteFile(episodeFile)
-		log.Printf("Sleeping for 5 seconds")
-		time.Sleep(5 * time.Second)
+		slog.Debug("Sleeping", "duration", a.cfg.Service.PublishDelay)
+		time.Sleep(a.cfg.Service.PublishDelay)
 	}
 }
 
-func publish() {
+func (a *app) publish() {
 	// Plan for the next steps:
 	// function that will get all feeds that has PublishReady set to true
-	reInitFeeds()
-	checkFeeds()
-	DbParams := database.InitDbParams()
-	db := database.DbConnect(DbParams)
-	feeds := getReadyFeeds(db)
-	for _, feed := range feeds {
-		items := getUnpublishedItems(db, feed)
+	a.checkFeeds(a.cfg.Feeds.ItemLimit)
+	for _, feed := range a.getDueFeeds() {
+		rules, err := feeds.ParseRules(feed)
+		if err != nil {
+			slog.Error("Invalid filter rules", logging.FeedID, feed.ID, "error", err)
+			continue
+		}
+		items := a.getUnpublishedItems(feed)
 		for _, item := range items {
-			episodeFile := downloadEpisode(db, item)
+			if skipped, err := a.skipFiltered(feed, rules, item); skipped || err != nil {
+				continue
+			}
+			episodeFile, err := a.downloadEpisode(item)
+			if err != nil {
+				a.failItem(feed, item, err)
+				break
+			}
 			if episodeFile == "" {
-				log.Printf("No episode file found for %s", item.Title)
-				updateItem(db, item)
+				slog.Warn("No episode file, skipping the item", logging.FeedID, feed.ID, logging.ItemID, item.ID)
+				a.updateItem(item, 0)
 				continue
 			}
-			log.Println(episodeFile)
-			publishToTheChannel(feed, item, episodeFile)
+			messageID, err := a.publishToTheChannel(feed, item, episodeFile)
+			if err != nil {
+				a.failItem(feed, item, err)
+				deleteFile(episodeFile)
+				// The next items of the feed would most likely fail the same way
+				break
+			}
 
-			updateItem(db, item)
+			a.updateItem(item, messageID)
+			a.markFeedPublished(feed)
 			deleteFile(episodeFile)
-			log.Printf("Sleeping for 5 seconds")
-			time.Sleep(5 * time.Second)
+			slog.Debug("Sleeping", "duration", a.cfg.Service.PublishDelay)
+			time.Sleep(a.cfg.Service.PublishDelay)
 
-			os.Exit(0)
-			// update the item TgPublished to true
+			// One episode per round, the next one waits for the next round
+			return
 		}
 		// delete the episode from the disk
 	}
 }
 
-func service() {
-	log.Println("Starting the service")
+func (a *app) service() {
+	slog.Info("Starting the service")
+	a.startServer()
 	for {
-		publish()
-		log.Println("Sleeping for 10 minutes")
-		time.Sleep(10 * time.Minute)
+		a.health.Beat()
+		a.publishing.Lock()
+		a.busy.Store(true)
+		a.publish()
+		a.busy.Store(false)
+		a.publishing.Unlock()
+		a.refreshQueueDepth()
+		a.checkStuckItems()
+		a.flushAlerts()
+		slog.Debug("Sleeping", "duration", a.cfg.Service.Interval)
+		time.Sleep(a.cfg.Service.Interval)
 	}
 }
 
 type readyFeedsCmd struct {
+	app *app
 }
 
 func (*readyFeedsCmd) Name() string     { return "readyFeeds" }
@@ -473,11 +862,12 @@ func (c *readyFeedsCmd) SetFlags(f *flag.FlagSet) {
 }
 
 func (c *readyFeedsCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	printReadyFeeds()
+	c.app.printReadyFeeds()
 	return subcommands.ExitSuccess
 }
 
 type addFeedCmd struct {
+	app  *app
 	feed string
 }
 
@@ -499,45 +889,49 @@ func (c *addFeedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{
 		return subcommands.ExitUsageError
 	}
 
-	addFeed(c.feed)
+	c.app.addFeed(c.feed)
 	return subcommands.ExitSuccess
 }
 
 type checkFeedsCmd struct {
-	// Add fields if needed
+	app   *app
+	limit int
 }
 
 func (*checkFeedsCmd) Name() string     { return "checkFeeds" }
 func (*checkFeedsCmd) Synopsis() string { return "Check all feeds." }
 func (*checkFeedsCmd) Usage() string {
-	return `checkFeeds:
+	return `checkFeeds [-limit <n>]:
   Check all feeds.
 `
 }
 
 func (c *checkFeedsCmd) SetFlags(f *flag.FlagSet) {
-	// Add flags if needed
+	f.IntVar(&c.limit, "limit", c.app.cfg.Feeds.ItemLimit, "Maximum number of new items per feed, 0 for no limit")
 }
 
 func (c *checkFeedsCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	checkFeeds()
+	c.app.checkFeeds(c.limit)
 	return subcommands.ExitSuccess
 }
 
 type fullFeedCmd struct {
-	feed string
+	app   *app
+	feed  string
+	limit int
 }
 
 func (*fullFeedCmd) Name() string     { return "fullFeed" }
 func (*fullFeedCmd) Synopsis() string { return "Get all feed data." }
 func (*fullFeedCmd) Usage() string {
-	return `fullFeed:
+	return `fullFeed -feed <id|url|title> [-limit <n>]:
   Get all feed data.
 `
 }
 
 func (c *fullFeedCmd) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&c.feed, "feed", "", "Title of the feed")
+	f.StringVar(&c.feed, "feed", "", "Id, URL, podcast:guid or title of the feed")
+	f.IntVar(&c.limit, "limit", c.app.cfg.Feeds.ItemLimit, "Maximum number of items, 0 for no limit")
 }
 
 func (c *fullFeedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -545,11 +939,12 @@ func (c *fullFeedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface
 		f.PrintDefaults()
 		return subcommands.ExitUsageError
 	}
-	fullFeed(c.feed)
+	c.app.fullFeed(c.feed, c.limit)
 	return subcommands.ExitSuccess
 }
 
 type publishItems struct {
+	app *app
 }
 
 func (*publishItems) Name() string     { return "publishItems" }
@@ -561,6 +956,7 @@ func (*publishItems) Usage() string {
 }
 
 type publishOne struct {
+	app *app
 }
 
 func (*publishOne) Name() string     { return "publishOne" }
@@ -575,7 +971,7 @@ func (*publishOne) Usage() string {
 }
 
 func (c *publishOne) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	publishOneItem()
+	c.app.publishOneItem()
 	return subcommands.ExitSuccess
 }
 
@@ -583,11 +979,12 @@ func (c *publishItems) SetFlags(f *flag.FlagSet) {
 }
 
 func (c *publishItems) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	publish()
+	c.app.publish()
 	return subcommands.ExitSuccess
 }
 
 type serviceCmd struct {
+	app *app
 }
 
 func (*serviceCmd) Name() string     { return "service" }
@@ -602,11 +999,12 @@ func (c *serviceCmd) SetFlags(f *flag.FlagSet) {
 }
 
 func (c *serviceCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	service()
+	c.app.service()
 	return subcommands.ExitSuccess
 }
 
 type publishFeedByIdCmd struct {
+	app  *app
 	feed string
 }
 
@@ -633,23 +1031,53 @@ func (c *publishFeedByIdCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...in
 		panic(err)
 	}
 
-	publishOnebyFeedId(id)
+	c.app.publishOnebyFeedId(id)
 	return subcommands.ExitSuccess
 }
 
 func main() {
+	a := &app{metrics: metrics.New(), health: health.NewTracker()}
 	subcommands.Register(subcommands.HelpCommand(), "")
 	subcommands.Register(subcommands.FlagsCommand(), "")
 	subcommands.Register(subcommands.CommandsCommand(), "")
-	subcommands.Register(&addFeedCmd{}, "")
-	subcommands.Register(&checkFeedsCmd{}, "")
-	subcommands.Register(&fullFeedCmd{}, "")
-	subcommands.Register(&publishItems{}, "")
-	subcommands.Register(&serviceCmd{}, "")
-	subcommands.Register(&publishOne{}, "")
-	subcommands.Register(&readyFeedsCmd{}, "")
-	subcommands.Register(&publishFeedByIdCmd{}, "")
+	subcommands.Register(&addFeedCmd{app: a}, "")
+	subcommands.Register(&checkFeedsCmd{app: a}, "")
+	subcommands.Register(&fullFeedCmd{app: a}, "")
+	subcommands.Register(&publishItems{app: a}, "")
+	subcommands.Register(&serviceCmd{app: a}, "")
+	subcommands.Register(&publishOne{app: a}, "")
+	subcommands.Register(&readyFeedsCmd{app: a}, "")
+	subcommands.Register(&publishFeedByIdCmd{app: a}, "")
+	subcommands.Register(&feedCmd{app: a}, "")
+	subcommands.Register(&itemsCmd{app: a}, "")
+	subcommands.Register(&migrateCmd{app: a}, "")
+	subcommands.Register(&configCmd{app: a}, "")
+	subcommands.Register(&syncCmd{app: a}, "")
+	subcommands.Register(&importOpmlCmd{app: a}, "")
+	subcommands.Register(&exportOpmlCmd{app: a}, "")
+	subcommands.Register(&feedHealthCmd{app: a}, "")
+	configFlags := config.BindFlags(flag.CommandLine)
 	flag.Parse()
+	a.cfg, a.cfgErr = loadConfig(configFlags)
+	if a.cfgErr != nil && !withoutDatabase[flag.Arg(0)] {
+		log.Fatalf("Invalid configuration: %v", a.cfgErr)
+	}
+	if a.cfgErr == nil {
+		logger, err := logging.New(os.Stderr, a.cfg.Log.Format, a.cfg.Log.Level)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		slog.SetDefault(logger)
+	}
+	a.alerts = a.newAlerter()
+	if !withoutDatabase[flag.Arg(0)] {
+		a.setDb(database.DbConnect(a.cfg.DbParams()))
+		if !skipStartupMigrations[flag.Arg(0)] {
+			a.migrateOnStartup()
+		}
+	}
 	ctx := context.Background()
-	os.Exit(int(subcommands.Execute(ctx)))
+	status := subcommands.Execute(ctx)
+	a.close()
+	os.Exit(int(status))
 }
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/alerts"
+	"github.com/tutuna/echopan/internals/caption"
+	"github.com/tutuna/echopan/internals/config"
+	"github.com/tutuna/echopan/internals/items"
 	"github.com/tutuna/echopan/internals/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -18,18 +25,36 @@ func TestDownloadEpisode(t *testing.T) {
 	// AutoMigrate the models
 	db.AutoMigrate(&models.Item{}, &models.Enclosure{})
 
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test.mp3" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ID3"))
+	}))
+	defer server.Close()
+
 	// Create a test item and enclosure
 	item := models.Item{Title: "Test Item"}
 	db.Create(&item)
-	enclosure := models.Enclosure{ItemId: item.ID, Url: "http://example.com/test.mp3"}
+	enclosure := models.Enclosure{ItemId: item.ID, Url: server.URL + "/test.mp3"}
 	db.Create(&enclosure)
 
 	// Call the function to test
-	file := downloadEpisode(db, item)
+	file, err := newApp(db).downloadEpisode(item)
 
 	// Assert the results
+	assert.NoError(t, err)
 	assert.NotEmpty(t, file, "The file path should not be empty")
 	assert.Contains(t, file, "test.mp3", "The file path should contain the enclosure URL")
+	deleteFile(file)
+
+	missing := models.Item{Title: "Missing"}
+	db.Create(&missing)
+	db.Create(&models.Enclosure{ItemId: missing.ID, Url: server.URL + "/missing.mp3"})
+	file, err = newApp(db).downloadEpisode(missing)
+	assert.ErrorContains(t, err, "404", "download errors are returned instead of exiting")
+	assert.Empty(t, file)
 }
 
 func TestDownloadEpisodeNoEnclosure(t *testing.T) {
@@ -47,9 +72,10 @@ func TestDownloadEpisodeNoEnclosure(t *testing.T) {
 	db.Create(&item)
 
 	// Call the function to test
-	file := downloadEpisode(db, item)
+	file, err := newApp(db).downloadEpisode(item)
 
 	// Assert the results
+	assert.NoError(t, err)
 	assert.Empty(t, file, "The file path should be empty when there is no enclosure")
 }
 
@@ -78,10 +104,265 @@ func TestGetUnpublishedItems(t *testing.T) {
 	db.Create(&item3)
 
 	// Call the function to test
-	items := getUnpublishedItems(db, feed)
+	items := newApp(db).getUnpublishedItems(feed)
 
 	// Assert the results
 	assert.Equal(t, 2, len(items), "There should be 2 unpublished items")
 	assert.Equal(t, "Item 1", items[0].Title, "The first item should be 'Item 1'")
 	assert.Equal(t, "Item 2", items[1].Title, "The second item should be 'Item 2'")
 }
+
+func TestCheckFeeds_StoresNewItemsWithEnclosures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Podcast</title>
+<item><title>Episode 3</title></item>
+<item><title>Episode 2</title><enclosure url="http://example.com/2.mp3" length="20" type="audio/mpeg"/></item>
+<item><title>Episode 1</title><enclosure url="http://example.com/1.mp3" length="10" type="audio/mpeg"/></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+
+	feed := models.Feed{Model: gorm.Model{ID: 1}, Title: "Podcast", Feed: srv.URL}
+	a, itemRepo, _ := newFakeApp(feed)
+	itemRepo.items = []models.Item{{Model: gorm.Model{ID: 1}, Title: "Episode 1", FeedId: 1, TgPublished: models.ItemPublished}}
+
+	a.checkFeeds(0)
+
+	assert.Len(t, itemRepo.items, 2, "only the unknown episode with an enclosure should be added")
+	assert.Equal(t, "Episode 2", itemRepo.items[1].Title)
+	assert.Equal(t, models.ItemPending, itemRepo.items[1].TgPublished)
+	if assert.Len(t, itemRepo.items[1].Enclosures, 1) {
+		assert.Equal(t, "http://example.com/2.mp3", itemRepo.items[1].Enclosures[0].Url)
+		assert.Equal(t, uint64(20), itemRepo.items[1].Enclosures[0].Length)
+	}
+}
+
+func TestCheckFeeds_SizesNewEnclosures(t *testing.T) {
+	var heads []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads = append(heads, r.URL.Path)
+			w.Header().Set("Content-Length", "42")
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Podcast</title>
+<item><title>Episode 2</title><enclosure url="%[1]s/2.mp3" type="audio/mpeg"/></item>
+<item><title>Episode 1</title><enclosure url="%[1]s/1.mp3" type="audio/mpeg"/></item>
+</channel></rss>`, srv.URL)
+	}))
+	defer srv.Close()
+
+	feed := models.Feed{Model: gorm.Model{ID: 1}, Title: "Podcast", Feed: srv.URL}
+	a, itemRepo, enclosureRepo := newFakeApp(feed)
+	itemRepo.items = []models.Item{{Model: gorm.Model{ID: 1}, Title: "Episode 1", FeedId: 1, TgPublished: models.ItemPublished}}
+
+	a.checkFeeds(0)
+
+	assert.Equal(t, []string{"/2.mp3"}, heads, "only the new enclosure is sized")
+	assert.Equal(t, map[uint]uint64{200: 42}, enclosureRepo.lengths)
+}
+
+func TestCheckFeeds_RefreshesImages(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Podcast</title>
+<image><url>http://example.com/cover.png</url><title>Cover</title></image>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+
+	quarantined := models.Feed{Model: gorm.Model{ID: 2}, Title: "Quarantined", Feed: srv.URL, Quarantined: true}
+	a, _, _ := newFakeApp(models.Feed{Model: gorm.Model{ID: 1}, Title: "Podcast", Feed: srv.URL}, quarantined)
+
+	a.checkFeeds(0)
+
+	assert.Equal(t, 1, requests, "quarantined feeds are not fetched for their image either")
+	assert.Equal(t, []models.Image{{Url: "http://example.com/cover.png", Title: "Cover", FeedId: 1}}, a.feeds.(*fakeFeedRepo).images)
+}
+
+func TestCheckFeeds_BacksOffFailingFeeds(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "gone", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	quarantined := models.Feed{Model: gorm.Model{ID: 2}, Title: "Quarantined", Feed: srv.URL, Quarantined: true}
+	failing := models.Feed{Model: gorm.Model{ID: 1}, Title: "Failing", Feed: srv.URL}
+	a, _, _ := newFakeApp(failing, quarantined)
+	feedRepo := a.feeds.(*fakeFeedRepo)
+
+	a.checkFeeds(0)
+	assert.Equal(t, 1, requests, "quarantined feeds are not fetched")
+	assert.Equal(t, 1, feedRepo.feeds[0].ConsecutiveFailures)
+
+	a.checkFeeds(0)
+	assert.Equal(t, 1, requests, "failing feeds wait for their backoff")
+}
+
+func TestCheckFeeds_FollowsMovedFeeds(t *testing.T) {
+	page := func(titles ...string) string {
+		items := ""
+		for _, title := range titles {
+			items += fmt.Sprintf(`<item><title>%s</title><enclosure url="http://example.com/%s.mp3" length="1" type="audio/mpeg"/></item>`, title, title)
+		}
+		return `<?xml version="1.0"?><rss version="2.0"><channel><title>Podcast</title>` + items + `</channel></rss>`
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/same", http.RedirectHandler("/same-new", http.StatusMovedPermanently))
+	mux.HandleFunc("/same-new", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, page("e2", "e1")) })
+	mux.Handle("/other", http.RedirectHandler("/other-new", http.StatusMovedPermanently))
+	mux.HandleFunc("/other-new", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, page("x1")) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	same := models.Feed{Model: gorm.Model{ID: 1}, Title: "Same", Feed: srv.URL + "/same"}
+	other := models.Feed{Model: gorm.Model{ID: 2}, Title: "Other", Feed: srv.URL + "/other"}
+	a, itemRepo, _ := newFakeApp(same, other)
+	itemRepo.items = []models.Item{
+		{Model: gorm.Model{ID: 1}, Title: "e1", FeedId: 1},
+		{Model: gorm.Model{ID: 2}, Title: "o1", FeedId: 2},
+	}
+	var sent []string
+	a.alerts = alerts.New(func(text string) error {
+		sent = append(sent, text)
+		return nil
+	}, alerts.Options{})
+
+	a.checkFeeds(0)
+
+	feedRepo := a.feeds.(*fakeFeedRepo)
+	assert.Equal(t, srv.URL+"/same-new", feedRepo.feeds[0].Feed)
+	assert.Equal(t, srv.URL+"/other-new", feedRepo.feeds[1].Feed)
+	if assert.Len(t, sent, 1, "only the feed without common episodes is alerted") {
+		assert.Contains(t, sent[0], "Feed 2 Other moved (redirect)")
+		assert.Contains(t, sent[0], "shares no episode")
+	}
+}
+
+func TestGetFirstUnpublishedItem_WithFakes(t *testing.T) {
+	feed := models.Feed{Model: gorm.Model{ID: 1}, Title: "Podcast", PublishReady: true}
+	a, itemRepo, _ := newFakeApp(feed)
+
+	_, err := a.getFirstUnpublishedItem(feed)
+	assert.Error(t, err)
+
+	itemRepo.items = []models.Item{
+		{Title: "Done", FeedId: 1, TgPublished: models.ItemPublished},
+		{Title: "Skipped", FeedId: 1, TgPublished: models.ItemSkipped},
+		{Title: "Next", FeedId: 1},
+	}
+	item, err := a.getFirstUnpublishedItem(feed)
+	assert.NoError(t, err)
+	assert.Equal(t, "Next", item.Title)
+	assert.Len(t, a.getReadyFeeds(), 1)
+}
+
+func TestGetFirstUnpublishedItem_SkipsFiltered(t *testing.T) {
+	feed := models.Feed{Model: gorm.Model{ID: 1}, FilterEpisodeTypes: "trailer", FilterMinDuration: "5m"}
+	a, itemRepo, _ := newFakeApp(feed)
+	itemRepo.items = []models.Item{
+		{Model: gorm.Model{ID: 1}, Title: "Trailer", FeedId: 1, ItunesEpisodeType: "trailer"},
+		{Model: gorm.Model{ID: 2}, Title: "Teaser", FeedId: 1, ItunesDuration: "00:45"},
+		{Model: gorm.Model{ID: 3}, Title: "Pilot", FeedId: 1, ItunesDuration: "32:10"},
+	}
+
+	item, err := a.getFirstUnpublishedItem(feed)
+	assert.NoError(t, err)
+	assert.Equal(t, "Pilot", item.Title)
+	assert.Equal(t, models.ItemSkipped, itemRepo.items[0].TgPublished)
+	assert.Equal(t, "episode type trailer", itemRepo.items[0].SkipReason)
+	assert.Equal(t, "duration 45s under min duration 5m0s", itemRepo.items[1].SkipReason)
+	assert.Equal(t, models.ItemPending, itemRepo.items[2].TgPublished)
+
+	feed.FilterInclude = "("
+	_, err = a.getFirstUnpublishedItem(feed)
+	assert.Error(t, err, "invalid rules hold the feed")
+}
+
+func TestGetFirstUnpublishedItem_Policies(t *testing.T) {
+	feed := models.Feed{Model: gorm.Model{ID: 1}, TgChannel: -1001}
+	a, itemRepo, _ := newFakeApp(feed)
+	itemRepo.items = []models.Item{
+		{Model: gorm.Model{ID: 1}, Title: "Blocked", FeedId: 1, ItunesBlock: "yes"},
+		{Model: gorm.Model{ID: 2}, Title: "Explicit", FeedId: 1, ItunesExplicit: "true"},
+	}
+
+	item, err := a.getFirstUnpublishedItem(feed)
+	assert.NoError(t, err)
+	assert.Equal(t, "Explicit", item.Title, "explicit episodes are allowed by default")
+	assert.Equal(t, "itunes:block", itemRepo.items[0].SkipReason)
+	assert.Equal(t, "*Explicit*", a.markExplicit(feed, item, "*Explicit*"))
+
+	a.cfg.Publish.ExplicitChannels = map[int64]string{-1001: config.ExplicitMark}
+	assert.Equal(t, "🔞 18+\n\n*Explicit*", a.markExplicit(feed, item, "*Explicit*"))
+	assert.Equal(t, "*Other*", a.markExplicit(feed, models.Item{}, "*Other*"))
+
+	a.cfg.Publish.ExplicitChannels[-1001] = config.ExplicitSkip
+	_, err = a.getFirstUnpublishedItem(feed)
+	assert.ErrorIs(t, err, items.ErrItemNotFound)
+	assert.Equal(t, "explicit, skipped in this channel", itemRepo.items[1].SkipReason)
+}
+
+func TestItemCaption(t *testing.T) {
+	a := newApp(nil)
+	item := models.Item{Title: "Pilot", ItunesSubtitle: "First one", ItunesEpisode: "1"}
+
+	feed := models.Feed{ExtraLinkEnabled: true, ExtraLink: "https://t.me/extra"}
+	assert.Equal(t, "*Pilot*\n\nFirst one\n\nhttps://t.me/extra", a.itemCaption(feed, item))
+
+	feed.CaptionTemplate = "{{.Title}} #{{.Episode}}: {{.Subtitle}} {{.ExtraLink}}"
+	assert.Equal(t, "Pilot #1: First one https://t.me/extra", a.itemCaption(feed, item))
+
+	feed.CaptionTemplate = "{{.Missing}}"
+	assert.Equal(t, "*Pilot*\n\nFirst one\n\nhttps://t.me/extra", a.itemCaption(feed, item), "broken templates fall back to the default")
+}
+
+func TestItemCaption_Options(t *testing.T) {
+	a := newApp(nil)
+	item := models.Item{
+		Title:          "Pilot",
+		ItunesSubtitle: "First one, see https://example.com/pilot for more",
+		ItunesSummary:  "<p>The <b>summary</b></p>",
+		ItunesSeason:   "2",
+		ItunesEpisode:  "5",
+	}
+
+	feed := models.Feed{CaptionHideSubtitle: true, CaptionNumbers: true}
+	assert.Equal(t, "*Pilot* (S2E5)\n\n", a.itemCaption(feed, item))
+
+	feed = models.Feed{CaptionStripLinks: true, CaptionMaxLength: 12}
+	assert.Equal(t, "*Pilot*\n\nFirst one, s...", a.itemCaption(feed, item))
+
+	feed = models.Feed{CaptionSource: caption.SourceSummary, CaptionTemplate: "{{.Subtitle}}"}
+	assert.Equal(t, "The summary", a.itemCaption(feed, item), "templates get the chosen text")
+
+	item.Description = "<p>Read *this* [now]</p>"
+	feed = models.Feed{CaptionSource: caption.SourceDescription}
+	assert.Equal(t, "*Pilot*\n\nRead \\*this\\* \\[now]", a.itemCaption(feed, item), "show notes text is escaped")
+}
+
+func TestItemCaption_Podcast(t *testing.T) {
+	feed := models.Feed{Model: gorm.Model{ID: 1}}
+	a, _, _ := newFakeApp(feed)
+	a.feeds.UpdatePodcast(1, "", []models.Funding{{Url: "https://example.com/donate", Text: "Support *us*"}, {Url: "https://example.com/tip_jar"}})
+	item := models.Item{Title: "Pilot", FeedId: 1, PodcastEpisode: "4", Persons: []models.Person{{Name: "Jane", Role: "host"}}}
+
+	assert.Equal(t, "*Pilot*\n\n\n\nSupport \\*us\\*: https://example.com/donate\nhttps://example.com/tip\\_jar", a.itemCaption(feed, item), "funding links are escaped")
+
+	feed.ExtraLinkEnabled, feed.ExtraLink = true, "https://t.me/extra"
+	assert.Equal(t, "*Pilot*\n\n\n\nhttps://t.me/extra", a.itemCaption(feed, item), "the extra link replaces the funding links")
+
+	feed.CaptionTemplate = "{{.Title}} #{{.Episode}} {{range .Persons}}{{.Name}}{{end}} {{range .Funding}}{{md .URL}} {{end}}"
+	assert.Equal(t, "Pilot #4 Jane https://example.com/donate https://example.com/tip\\_jar", a.itemCaption(feed, item), "templates escape with md")
+}
+
+func TestSendErrorClass(t *testing.T) {
+	assert.Equal(t, "", sendErrorClass(nil))
+	assert.Equal(t, "too_large", sendErrorClass(fmt.Errorf("telegram: Request Entity Too Large (413)")))
+	assert.Equal(t, "encoding", sendErrorClass(fmt.Errorf("telegram: Bad Request: text must be encoded in UTF-8 (400)")))
+	assert.Equal(t, "other", sendErrorClass(fmt.Errorf("telegram: Forbidden (403)")))
+}
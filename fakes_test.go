@@ -0,0 +1,217 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/tutuna/echopan/internals/alerts"
+	"github.com/tutuna/echopan/internals/config"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/health"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/metrics"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/repository"
+	"gorm.io/gorm"
+)
+
+// The fakes embed the repository interfaces, calling a method a test did not
+// expect panics on the nil interface.
+
+type fakeFeedRepo struct {
+	repository.FeedRepo
+	feeds   []models.Feed
+	funding map[uint][]models.Funding
+	images  []models.Image
+}
+
+func (r *fakeFeedRepo) All() ([]models.Feed, error) {
+	return r.feeds, nil
+}
+
+func (r *fakeFeedRepo) Ready() ([]models.Feed, error) {
+	var ready []models.Feed
+	for _, feed := range r.feeds {
+		if feed.PublishReady {
+			ready = append(ready, feed)
+		}
+	}
+	return ready, nil
+}
+
+func (r *fakeFeedRepo) RecordFetch(id uint, fetchErr error, now time.Time, policy feeds.HealthPolicy) (models.Feed, error) {
+	for i := range r.feeds {
+		if r.feeds[i].ID != id {
+			continue
+		}
+		r.feeds[i].LastFetchAt = &now
+		if fetchErr == nil {
+			r.feeds[i].ConsecutiveFailures = 0
+		} else {
+			r.feeds[i].ConsecutiveFailures++
+		}
+		return r.feeds[i], nil
+	}
+	return models.Feed{}, feeds.ErrFeedNotFound
+}
+
+func (r *fakeFeedRepo) Resolve(selector string) (models.Feed, error) {
+	var matches []models.Feed
+	for _, feed := range r.feeds {
+		if feed.Title == selector || feed.Feed == selector {
+			matches = append(matches, feed)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return models.Feed{}, feeds.ErrFeedNotFound
+	case 1:
+		return matches[0], nil
+	}
+	ambiguous := &feeds.AmbiguousError{Selector: selector}
+	for _, feed := range matches {
+		ambiguous.Matches = append(ambiguous.Matches, feed.ID)
+	}
+	return models.Feed{}, ambiguous
+}
+
+func (r *fakeFeedRepo) Move(id uint, url, reason string) error {
+	for i := range r.feeds {
+		if r.feeds[i].ID == id {
+			r.feeds[i].Feed = url
+			return nil
+		}
+	}
+	return feeds.ErrFeedNotFound
+}
+
+func (r *fakeFeedRepo) UpdatePodcast(id uint, guid string, funding []models.Funding) error {
+	if r.funding == nil {
+		r.funding = map[uint][]models.Funding{}
+	}
+	r.funding[id] = funding
+	return nil
+}
+
+func (r *fakeFeedRepo) SetImage(image models.Image) error {
+	r.images = append(r.images, image)
+	return nil
+}
+
+func (r *fakeFeedRepo) Funding(id uint) ([]models.Funding, error) {
+	return r.funding[id], nil
+}
+
+type fakeItemRepo struct {
+	repository.ItemRepo
+	items []models.Item
+}
+
+func (r *fakeItemRepo) Ingest(feedID uint, fetched []models.Item) (items.IngestReport, error) {
+	var report items.IngestReport
+	known := r.Known(models.Feed{Model: gorm.Model{ID: feedID}})
+	for _, item := range fetched {
+		if len(item.Enclosures) == 0 {
+			report.Rejected = append(report.Rejected, items.Rejection{Title: item.Title, Reason: "no enclosure"})
+			continue
+		}
+		if known(&gofeed.Item{Title: item.Title}) {
+			continue
+		}
+		item.ID = uint(len(r.items) + 1)
+		for i := range item.Enclosures {
+			item.Enclosures[i].ID, item.Enclosures[i].ItemId = item.ID*100+uint(i), item.ID
+			if item.Enclosures[i].Length == 0 {
+				report.Unsized = append(report.Unsized, item.Enclosures[i])
+			}
+		}
+		r.items = append(r.items, item)
+		report.Created++
+	}
+	return report, nil
+}
+
+// LoadPodcast keeps the transcripts and persons the test put on the item
+func (r *fakeItemRepo) LoadPodcast(item *models.Item) error {
+	return nil
+}
+
+func (r *fakeItemRepo) Known(feed models.Feed) func(item *gofeed.Item) bool {
+	return func(item *gofeed.Item) bool {
+		for _, existing := range r.items {
+			if existing.FeedId == int(feed.ID) && existing.Title == item.Title {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (r *fakeItemRepo) FirstUnpublished(feedID uint) (models.Item, error) {
+	for _, item := range r.items {
+		if item.FeedId == int(feedID) && item.TgPublished == models.ItemPending {
+			return item, nil
+		}
+	}
+	return models.Item{}, items.ErrItemNotFound
+}
+
+func (r *fakeItemRepo) Fail(id uint, reason string) error {
+	for i := range r.items {
+		if r.items[i].ID == id {
+			r.items[i].TgPublished = models.ItemFailed
+			r.items[i].LastError = reason
+			return nil
+		}
+	}
+	return items.ErrItemNotFound
+}
+
+func (r *fakeItemRepo) Skip(id uint, reason string) error {
+	for i := range r.items {
+		if r.items[i].ID == id {
+			r.items[i].TgPublished = models.ItemSkipped
+			r.items[i].SkipReason = reason
+			return nil
+		}
+	}
+	return items.ErrItemNotFound
+}
+
+type fakeEnclosureRepo struct {
+	repository.EnclosureRepo
+	enclosures []models.Enclosure
+	lengths    map[uint]uint64
+}
+
+func (r *fakeEnclosureRepo) ForItem(itemID uint) ([]models.Enclosure, error) {
+	var found []models.Enclosure
+	for _, enc := range r.enclosures {
+		if enc.ItemId == itemID {
+			found = append(found, enc)
+		}
+	}
+	return found, nil
+}
+
+func (r *fakeEnclosureRepo) SetLength(id uint, length uint64) error {
+	if r.lengths == nil {
+		r.lengths = map[uint]uint64{}
+	}
+	r.lengths[id] = length
+	return nil
+}
+
+func newFakeApp(feeds ...models.Feed) (*app, *fakeItemRepo, *fakeEnclosureRepo) {
+	itemRepo := &fakeItemRepo{}
+	enclosureRepo := &fakeEnclosureRepo{}
+	return &app{
+		cfg:        config.Default(),
+		metrics:    metrics.New(),
+		health:     health.NewTracker(),
+		alerts:     alerts.New(nil, alerts.Options{}),
+		feeds:      &fakeFeedRepo{feeds: feeds},
+		items:      itemRepo,
+		enclosures: enclosureRepo,
+	}, itemRepo, enclosureRepo
+}
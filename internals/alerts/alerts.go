@@ -0,0 +1,169 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is the class of problem an alert reports
+type Kind string
+
+const (
+	KindFeedFetch  Kind = "feed_fetch"
+	KindUpload     Kind = "upload"
+	KindStuckItems Kind = "stuck_items"
+	KindPermission Kind = "permission"
+	KindFeedMoved  Kind = "feed_moved"
+)
+
+// Alert is one message for the operators. Alerts with the same key are
+// deduplicated.
+type Alert struct {
+	Kind Kind
+	Key  string
+	Text string
+}
+
+// Sender delivers a message to the admin chat
+type Sender func(text string) error
+
+// Options tunes the alerter
+type Options struct {
+	// Cooldown is how long an alert is not repeated after being raised
+	Cooldown time.Duration
+	// FetchFailures is the number of consecutive fetch failures of a feed
+	// before an alert is raised
+	FetchFailures int
+	// Digest queues the alerts and sends them together once per DigestInterval
+	Digest         bool
+	DigestInterval time.Duration
+}
+
+// Alerter sends alerts to the admin chat without repeating itself
+type Alerter struct {
+	send Sender
+	opts Options
+	now  func() time.Time
+
+	mu         sync.Mutex
+	raised     map[string]time.Time
+	queue      []Alert
+	lastDigest time.Time
+}
+
+// New creates an alerter. With a nil sender alerts are dropped.
+func New(send Sender, opts Options) *Alerter {
+	if opts.FetchFailures <= 0 {
+		opts.FetchFailures = 1
+	}
+	if opts.DigestInterval <= 0 {
+		opts.DigestInterval = 24 * time.Hour
+	}
+	return &Alerter{
+		send:   send,
+		opts:   opts,
+		now:    time.Now,
+		raised: map[string]time.Time{},
+	}
+}
+
+// Enabled reports whether alerts are delivered anywhere
+func (a *Alerter) Enabled() bool {
+	return a.send != nil
+}
+
+// Raise sends the alert, or queues it in digest mode, unless an alert with
+// the same key was raised less than the cooldown ago. An alert that could not
+// be sent is raised again on the next occurrence.
+func (a *Alerter) Raise(alert Alert) error {
+	if a.send == nil {
+		return nil
+	}
+	a.mu.Lock()
+	now := a.now()
+	if last, ok := a.raised[alert.Key]; ok && now.Sub(last) < a.opts.Cooldown {
+		a.mu.Unlock()
+		return nil
+	}
+	if a.opts.Digest {
+		a.raised[alert.Key] = now
+		a.queue = append(a.queue, alert)
+		a.mu.Unlock()
+		return nil
+	}
+	a.mu.Unlock()
+	if err := a.send(alert.Text); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.raised[alert.Key] = now
+	a.mu.Unlock()
+	return nil
+}
+
+// Resolve forgets the alert with the given key, so the next occurrence is
+// raised even within the cooldown
+func (a *Alerter) Resolve(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.raised, key)
+}
+
+// FeedFetched raises an alert once the consecutive fetch failures of a feed
+// reach the threshold. A success resolves the alert.
+func (a *Alerter) FeedFetched(feedID uint, title string, failures int, err error) error {
+	key := fmt.Sprintf("%s:%d", KindFeedFetch, feedID)
+	if err == nil {
+		a.Resolve(key)
+		return nil
+	}
+	if failures < a.opts.FetchFailures {
+		return nil
+	}
+	return a.Raise(Alert{
+		Kind: KindFeedFetch,
+		Key:  key,
+		Text: fmt.Sprintf("Feed %d %s failed %d times in a row: %v", feedID, title, failures, err),
+	})
+}
+
+// Flush sends the queued alerts as one message once the digest interval has
+// passed since the previous digest. When the digest could not be sent the
+// alerts stay queued for the next Flush.
+func (a *Alerter) Flush() error {
+	a.mu.Lock()
+	now := a.now()
+	if a.lastDigest.IsZero() {
+		a.lastDigest = now
+	}
+	if len(a.queue) == 0 || now.Sub(a.lastDigest) < a.opts.DigestInterval {
+		a.mu.Unlock()
+		return nil
+	}
+	queue := a.queue
+	a.queue = nil
+	a.mu.Unlock()
+	if err := a.send(Digest(queue)); err != nil {
+		a.mu.Lock()
+		// alerts raised during the send go after the ones that failed
+		a.queue = append(queue, a.queue...)
+		a.mu.Unlock()
+		return err
+	}
+	a.mu.Lock()
+	a.lastDigest = now
+	a.mu.Unlock()
+	return nil
+}
+
+// Digest renders several alerts as a single message
+func Digest(queue []Alert) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "echopan digest, %d alerts:", len(queue))
+	for _, alert := range queue {
+		fmt.Fprintf(&b, "\n- [%s] %s", alert.Kind, alert.Text)
+	}
+	return b.String()
+}
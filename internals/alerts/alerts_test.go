@@ -0,0 +1,114 @@
+package alerts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	sent []string
+	err  error
+}
+
+func (r *recorder) send(text string) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, text)
+	return nil
+}
+
+func newTestAlerter(opts Options) (*Alerter, *recorder, *time.Time) {
+	r := &recorder{}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a := New(r.send, opts)
+	a.now = func() time.Time { return now }
+	return a, r, &now
+}
+
+func TestRaise_Deduplicates(t *testing.T) {
+	a, r, now := newTestAlerter(Options{Cooldown: time.Hour})
+	alert := Alert{Kind: KindUpload, Key: "upload:1", Text: "Upload of item 1 failed"}
+
+	assert.NoError(t, a.Raise(alert))
+	assert.NoError(t, a.Raise(alert))
+	assert.Len(t, r.sent, 1)
+
+	*now = now.Add(time.Hour)
+	assert.NoError(t, a.Raise(alert))
+	assert.Len(t, r.sent, 2)
+
+	a.Resolve("upload:1")
+	assert.NoError(t, a.Raise(alert))
+	assert.Len(t, r.sent, 3)
+}
+
+func TestFeedFetched_Threshold(t *testing.T) {
+	a, r, _ := newTestAlerter(Options{Cooldown: time.Hour, FetchFailures: 3})
+	fail := errors.New("status 500")
+
+	assert.NoError(t, a.FeedFetched(7, "Feed", 1, fail))
+	assert.NoError(t, a.FeedFetched(7, "Feed", 2, fail))
+	assert.Empty(t, r.sent)
+	assert.NoError(t, a.FeedFetched(7, "Feed", 3, fail))
+	assert.NoError(t, a.FeedFetched(7, "Feed", 4, fail))
+	assert.Equal(t, []string{"Feed 7 Feed failed 3 times in a row: status 500"}, r.sent)
+
+	assert.NoError(t, a.FeedFetched(7, "Feed", 0, nil))
+	assert.NoError(t, a.FeedFetched(7, "Feed", 3, fail))
+	assert.Len(t, r.sent, 2, "a success resolves the alert")
+}
+
+func TestFlush_Digest(t *testing.T) {
+	a, r, now := newTestAlerter(Options{Digest: true, DigestInterval: 24 * time.Hour})
+	assert.NoError(t, a.Flush())
+
+	assert.NoError(t, a.Raise(Alert{Kind: KindUpload, Key: "upload:1", Text: "first"}))
+	assert.NoError(t, a.Raise(Alert{Kind: KindPermission, Key: "permission:5", Text: "second"}))
+	assert.NoError(t, a.Flush())
+	assert.Empty(t, r.sent)
+
+	*now = now.Add(24 * time.Hour)
+	assert.NoError(t, a.Flush())
+	assert.Equal(t, []string{"echopan digest, 2 alerts:\n- [upload] first\n- [permission] second"}, r.sent)
+
+	assert.NoError(t, a.Flush())
+	assert.Len(t, r.sent, 1)
+}
+
+func TestRaise_RetriesFailedSends(t *testing.T) {
+	a, r, _ := newTestAlerter(Options{Cooldown: time.Hour})
+	alert := Alert{Kind: KindUpload, Key: "upload:1", Text: "Upload of item 1 failed"}
+
+	r.err = errors.New("chat not found")
+	assert.Error(t, a.Raise(alert))
+	r.err = nil
+	assert.NoError(t, a.Raise(alert))
+	assert.Len(t, r.sent, 1, "a failed send does not start the cooldown")
+	assert.NoError(t, a.Raise(alert))
+	assert.Len(t, r.sent, 1)
+}
+
+func TestFlush_KeepsQueueOnFailure(t *testing.T) {
+	a, r, now := newTestAlerter(Options{Digest: true, DigestInterval: time.Hour})
+	assert.NoError(t, a.Flush())
+	assert.NoError(t, a.Raise(Alert{Kind: KindUpload, Key: "upload:1", Text: "first"}))
+	*now = now.Add(time.Hour)
+
+	r.err = errors.New("network is unreachable")
+	assert.Error(t, a.Flush())
+	r.err = nil
+	assert.NoError(t, a.Raise(Alert{Kind: KindPermission, Key: "permission:5", Text: "second"}))
+	assert.NoError(t, a.Flush(), "the failed digest is sent again without waiting")
+	assert.Equal(t, []string{"echopan digest, 2 alerts:\n- [upload] first\n- [permission] second"}, r.sent)
+}
+
+func TestNew_NilSender(t *testing.T) {
+	a := New(nil, Options{})
+	assert.False(t, a.Enabled())
+	assert.NoError(t, a.Raise(Alert{Key: "x", Text: "dropped"}))
+	assert.NoError(t, a.Flush())
+}
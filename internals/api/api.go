@@ -0,0 +1,323 @@
+// Package api serves the token-authenticated HTTP API of the service: feeds,
+// items and publishing
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/repository"
+)
+
+// ErrBusy is returned by Service.Publish while a publication is running
+var ErrBusy = errors.New("a publication is already running")
+
+// Service runs the actions the API shares with the publisher
+type Service interface {
+	// AddFeed fetches and stores the feed, created reports whether it is new
+	AddFeed(url string) (feed models.Feed, created bool, err error)
+	// Publish starts publishing the next episode of the feed in the background
+	Publish(feedID uint) error
+	Status() (Status, error)
+}
+
+// Status is the run status of the service
+type Status struct {
+	// SinceLastRound is the time in seconds since the service loop last started a round
+	SinceLastRound float64 `json:"seconds_since_last_round"`
+	// Publishing reports a running publication
+	Publishing bool `json:"publishing"`
+	// Downloads lists the episodes being downloaded
+	Downloads []string `json:"downloads"`
+	Feeds     int      `json:"feeds"`
+	Queued    int64    `json:"queued"`
+}
+
+type server struct {
+	feeds   repository.FeedRepo
+	items   repository.ItemRepo
+	service Service
+	token   string
+}
+
+// New returns the handler of the API, mounted under /api/. Every request
+// needs the header "Authorization: Bearer <token>".
+func New(feedRepo repository.FeedRepo, itemRepo repository.ItemRepo, service Service, token string) http.Handler {
+	s := &server{feeds: feedRepo, items: itemRepo, service: service, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/feeds", s.listFeeds)
+	mux.HandleFunc("POST /api/feeds", s.addFeed)
+	mux.HandleFunc("GET /api/feeds/{id}", s.getFeed)
+	mux.HandleFunc("PATCH /api/feeds/{id}", s.updateFeed)
+	mux.HandleFunc("DELETE /api/feeds/{id}", s.deleteFeed)
+	mux.HandleFunc("POST /api/feeds/{id}/publish", s.publishFeed)
+	mux.HandleFunc("GET /api/items", s.listItems)
+	mux.HandleFunc("GET /api/items/{id}", s.getItem)
+	mux.HandleFunc("POST /api/items/{id}/requeue", s.setItemState(models.ItemPending))
+	mux.HandleFunc("POST /api/items/{id}/skip", s.setItemState(models.ItemSkipped))
+	mux.HandleFunc("GET /api/status", s.status)
+	return s.authenticate(mux)
+}
+
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="echopan"`)
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) listFeeds(w http.ResponseWriter, r *http.Request) {
+	list, err := s.feeds.List(r.URL.Query().Get("deleted") == "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	views := make([]Feed, 0, len(list))
+	for _, feed := range list {
+		views = append(views, newFeed(feed, nil))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (s *server) addFeed(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := decode(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.URL == "" {
+		writeError(w, http.StatusBadRequest, errors.New("url is required"))
+		return
+	}
+	feed, created, err := s.service.AddFeed(body.URL)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	writeJSON(w, code, newFeed(feed, nil))
+}
+
+func (s *server) getFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := s.feed(w, r)
+	if !ok {
+		return
+	}
+	stats, err := s.feeds.Stats(feed.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newFeed(feed, &stats))
+}
+
+func (s *server) updateFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := s.feed(w, r)
+	if !ok {
+		return
+	}
+	var patch FeedPatch
+	if err := decode(r, &patch); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	fields, err := patch.apply(&feed)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if patch.Feed != nil {
+		if err := s.feeds.SetURL(feed.ID, *patch.Feed); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	}
+	if len(fields) > 0 {
+		if err := s.feeds.Update(feed.ID, fields); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	s.getFeed(w, r)
+}
+
+func (s *server) deleteFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := s.feed(w, r)
+	if !ok {
+		return
+	}
+	if err := s.feeds.Delete(feed.ID); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) publishFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := s.feed(w, r)
+	if !ok {
+		return
+	}
+	if feed.TgChannel == 0 {
+		writeError(w, http.StatusConflict, fmt.Errorf("feed %d has no telegram channel", feed.ID))
+		return
+	}
+	err := s.service.Publish(feed.ID)
+	switch {
+	case errors.Is(err, ErrBusy):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "publishing"})
+	}
+}
+
+func (s *server) listItems(w http.ResponseWriter, r *http.Request) {
+	filter, err := itemFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	list, err := s.items.List(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	views := make([]Item, 0, len(list))
+	for _, item := range list {
+		views = append(views, newItem(item))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// itemFilter reads the feed, state and limit query parameters
+func itemFilter(r *http.Request) (items.Filter, error) {
+	var filter items.Filter
+	query := r.URL.Query()
+	if v := query.Get("feed"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid feed id %q", v)
+		}
+		filter.FeedID = uint(id)
+	}
+	if v := query.Get("state"); v != "" {
+		state, err := items.ParseState(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.State = &state
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+func (s *server) getItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	item, err := s.items.Get(id)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newItem(item))
+}
+
+func (s *server) setItemState(state int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		if err := s.items.SetState(id, state); err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		s.getItem(w, r)
+	}
+}
+
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	status, err := s.service.Status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// feed loads the feed named by the id of the path, answering the errors
+func (s *server) feed(w http.ResponseWriter, r *http.Request) (models.Feed, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return models.Feed{}, false
+	}
+	feed, err := s.feeds.Get(id)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return models.Feed{}, false
+	}
+	return feed, true
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func errorStatus(err error) int {
+	if errors.Is(err, feeds.ErrFeedNotFound) || errors.Is(err, items.ErrItemNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func decode(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/repository"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fakeService struct {
+	repos     *repository.Repos
+	published []uint
+	busy      bool
+}
+
+func (s *fakeService) AddFeed(url string) (models.Feed, bool, error) {
+	return s.repos.Feeds.FirstOrCreateByURL(models.Feed{Title: "Added", Feed: url})
+}
+
+func (s *fakeService) Publish(feedID uint) error {
+	if s.busy {
+		return ErrBusy
+	}
+	s.published = append(s.published, feedID)
+	return nil
+}
+
+func (s *fakeService) Status() (Status, error) {
+	return Status{Feeds: 1, Queued: 2}, nil
+}
+
+func newTestAPI(t *testing.T) (func(method, path, body string) *httptest.ResponseRecorder, *fakeService) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{}, &models.Enclosure{}, &models.FeedURLChange{})
+	db.Create(&models.Feed{Title: "Podcast", Feed: "https://example.com/rss", TgChannel: -1001})
+	db.Create(&models.Feed{Title: "Silent", Feed: "https://example.com/silent"})
+	db.Create(&models.Item{Title: "Pilot", FeedId: 1, TgPublished: models.ItemPublished})
+	db.Create(&models.Item{Title: "Second", FeedId: 1})
+	repos := repository.New(db)
+	service := &fakeService{repos: repos}
+	handler := New(repos.Feeds, repos.Items, service, "s3cret")
+
+	return func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}, service
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	handler := New(nil, nil, nil, "s3cret")
+	for _, header := range []string{"", "Bearer wrong", "s3cret"} {
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, header)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	do, _ := newTestAPI(t)
+
+	rec := do("GET", "/api/feeds", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list []Feed
+	decodeBody(t, rec, &list)
+	assert.Len(t, list, 2)
+
+	rec = do("POST", "/api/feeds", `{"url":"https://example.com/new"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = do("POST", "/api/feeds", `{"url":"https://EXAMPLE.com/new"}`)
+	assert.Equal(t, http.StatusOK, rec.Code, "known feeds are returned")
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/api/feeds", `{}`).Code)
+
+	rec = do("PATCH", "/api/feeds/1", `{"schedule":"24h","filter_episode_types":"trailer","publish_ready":true}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var feed Feed
+	decodeBody(t, rec, &feed)
+	assert.Equal(t, "24h", feed.Schedule)
+	assert.Equal(t, "trailer", feed.FilterEpisodeTypes)
+	assert.True(t, feed.PublishReady)
+	if assert.NotNil(t, feed.Stats) {
+		assert.Equal(t, int64(1), feed.Stats.Unpublished)
+	}
+
+	rec = do("PATCH", "/api/feeds/1", `{"schedule":"daily","filter_include":"("}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid schedule")
+	assert.Contains(t, rec.Body.String(), "invalid include rule")
+	assert.Equal(t, http.StatusBadRequest, do("PATCH", "/api/feeds/1", `{"chanel":1}`).Code, "unknown fields are rejected")
+	assert.Equal(t, http.StatusBadRequest, do("PATCH", "/api/feeds/1", `{}`).Code)
+	rec = do("PATCH", "/api/feeds/2", `{"publish_ready":true}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "needs a channel")
+	assert.Equal(t, http.StatusConflict, do("PATCH", "/api/feeds/1", `{"feed":"https://example.com/silent"}`).Code)
+
+	assert.Equal(t, http.StatusNotFound, do("GET", "/api/feeds/42", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/api/feeds/abc", "").Code)
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/api/feeds/2", "").Code)
+	decodeBody(t, do("GET", "/api/feeds", ""), &list)
+	assert.Len(t, list, 2)
+	decodeBody(t, do("GET", "/api/feeds?deleted=true", ""), &list)
+	assert.Len(t, list, 3)
+}
+
+func TestPublish(t *testing.T) {
+	do, service := newTestAPI(t)
+
+	assert.Equal(t, http.StatusAccepted, do("POST", "/api/feeds/1/publish", "").Code)
+	assert.Equal(t, []uint{1}, service.published)
+	assert.Equal(t, http.StatusConflict, do("POST", "/api/feeds/2/publish", "").Code, "the feed has no channel")
+
+	service.busy = true
+	rec := do("POST", "/api/feeds/1/publish", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "already running")
+
+	rec = do("GET", "/api/status", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"queued":2`)
+}
+
+func TestItems(t *testing.T) {
+	do, _ := newTestAPI(t)
+
+	var list []Item
+	decodeBody(t, do("GET", "/api/items?feed=1&state=pending", ""), &list)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "Second", list[0].Title)
+	}
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/api/items?state=gone", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/api/items?limit=-1", "").Code)
+
+	rec := do("POST", "/api/items/2/skip", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var item Item
+	decodeBody(t, rec, &item)
+	assert.Equal(t, "skipped", item.State)
+
+	decodeBody(t, do("POST", "/api/items/1/requeue", ""), &item)
+	assert.Equal(t, "pending", item.State)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/api/items/9/requeue", "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/api/items/9", "").Code)
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tutuna/echopan/internals/caption"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/shownotes"
+)
+
+// Feed is the representation of a feed in the API
+type Feed struct {
+	ID                  uint         `json:"id"`
+	Title               string       `json:"title"`
+	Description         string       `json:"description"`
+	Link                string       `json:"link"`
+	Feed                string       `json:"feed"`
+	PublishReady        bool         `json:"publish_ready"`
+	TgChannel           int          `json:"tg_channel"`
+	Timeout             int          `json:"timeout"`
+	ExtraLinkEnabled    bool         `json:"extra_link_enabled"`
+	ExtraLink           string       `json:"extra_link"`
+	CaptionTemplate     string       `json:"caption_template"`
+	CaptionHideSubtitle bool         `json:"caption_hide_subtitle"`
+	CaptionSource       string       `json:"caption_source"`
+	CaptionMaxLength    int          `json:"caption_max_length"`
+	CaptionStripLinks   bool         `json:"caption_strip_links"`
+	CaptionNumbers      bool         `json:"caption_numbers"`
+	Schedule            string       `json:"schedule"`
+	ShowNotes           string       `json:"show_notes"`
+	FilterInclude       string       `json:"filter_include"`
+	FilterExclude       string       `json:"filter_exclude"`
+	FilterEpisodeTypes  string       `json:"filter_episode_types"`
+	FilterExplicit      bool         `json:"filter_explicit"`
+	FilterMinDuration   string       `json:"filter_min_duration"`
+	FilterMaxDuration   string       `json:"filter_max_duration"`
+	LastFetchAt         *time.Time   `json:"last_fetch_at,omitempty"`
+	LastSuccessAt       *time.Time   `json:"last_success_at,omitempty"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastFetchError      string       `json:"last_fetch_error,omitempty"`
+	Quarantined         bool         `json:"quarantined"`
+	LastPubDate         *time.Time   `json:"last_pub_date,omitempty"`
+	CreatedAt           time.Time    `json:"created_at"`
+	DeletedAt           *time.Time   `json:"deleted_at,omitempty"`
+	Stats               *feeds.Stats `json:"stats,omitempty"`
+}
+
+func newFeed(feed models.Feed, stats *feeds.Stats) Feed {
+	v := Feed{
+		ID:                  feed.ID,
+		Title:               feed.Title,
+		Description:         feed.Description,
+		Link:                feed.Link,
+		Feed:                feed.Feed,
+		PublishReady:        feed.PublishReady,
+		TgChannel:           feed.TgChannel,
+		Timeout:             feed.Timeout,
+		ExtraLinkEnabled:    feed.ExtraLinkEnabled,
+		ExtraLink:           feed.ExtraLink,
+		CaptionTemplate:     feed.CaptionTemplate,
+		CaptionHideSubtitle: feed.CaptionHideSubtitle,
+		CaptionSource:       feed.CaptionSource,
+		CaptionMaxLength:    feed.CaptionMaxLength,
+		CaptionStripLinks:   feed.CaptionStripLinks,
+		CaptionNumbers:      feed.CaptionNumbers,
+		Schedule:            feed.Schedule,
+		ShowNotes:           feed.ShowNotes,
+		FilterInclude:       feed.FilterInclude,
+		FilterExclude:       feed.FilterExclude,
+		FilterEpisodeTypes:  feed.FilterEpisodeTypes,
+		FilterExplicit:      feed.FilterExplicit,
+		FilterMinDuration:   feed.FilterMinDuration,
+		FilterMaxDuration:   feed.FilterMaxDuration,
+		LastFetchAt:         feed.LastFetchAt,
+		LastSuccessAt:       feed.LastSuccessAt,
+		ConsecutiveFailures: feed.ConsecutiveFailures,
+		LastFetchError:      feed.LastFetchError,
+		Quarantined:         feed.Quarantined,
+		LastPubDate:         feed.LastPubDate,
+		CreatedAt:           feed.CreatedAt,
+		Stats:               stats,
+	}
+	if feed.DeletedAt.Valid {
+		v.DeletedAt = &feed.DeletedAt.Time
+	}
+	return v
+}
+
+// FeedPatch lists the feed settings a PATCH may change, absent fields are
+// left alone. The keys are the ones of Feed.
+type FeedPatch struct {
+	Title               *string `json:"title"`
+	Feed                *string `json:"feed"`
+	PublishReady        *bool   `json:"publish_ready"`
+	TgChannel           *int    `json:"tg_channel"`
+	Timeout             *int    `json:"timeout"`
+	ExtraLinkEnabled    *bool   `json:"extra_link_enabled"`
+	ExtraLink           *string `json:"extra_link"`
+	CaptionTemplate     *string `json:"caption_template"`
+	CaptionHideSubtitle *bool   `json:"caption_hide_subtitle"`
+	CaptionSource       *string `json:"caption_source"`
+	CaptionMaxLength    *int    `json:"caption_max_length"`
+	CaptionStripLinks   *bool   `json:"caption_strip_links"`
+	CaptionNumbers      *bool   `json:"caption_numbers"`
+	Schedule            *string `json:"schedule"`
+	ShowNotes           *string `json:"show_notes"`
+	FilterInclude       *string `json:"filter_include"`
+	FilterExclude       *string `json:"filter_exclude"`
+	FilterEpisodeTypes  *string `json:"filter_episode_types"`
+	FilterExplicit      *bool   `json:"filter_explicit"`
+	FilterMinDuration   *string `json:"filter_min_duration"`
+	FilterMaxDuration   *string `json:"filter_max_duration"`
+}
+
+// apply sets the patch on the feed, checks the result and returns the
+// columns to update. The feed URL is left to SetURL.
+func (p FeedPatch) apply(feed *models.Feed) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	setString := func(column string, dst *string, v *string) {
+		if v != nil {
+			*dst = *v
+			fields[column] = *v
+		}
+	}
+	setBool := func(column string, dst *bool, v *bool) {
+		if v != nil {
+			*dst = *v
+			fields[column] = *v
+		}
+	}
+	setInt := func(column string, dst *int, v *int) {
+		if v != nil {
+			*dst = *v
+			fields[column] = *v
+		}
+	}
+	setString("title", &feed.Title, p.Title)
+	setBool("publish_ready", &feed.PublishReady, p.PublishReady)
+	setInt("tg_channel", &feed.TgChannel, p.TgChannel)
+	setInt("timeout", &feed.Timeout, p.Timeout)
+	setBool("extra_link_enabled", &feed.ExtraLinkEnabled, p.ExtraLinkEnabled)
+	setString("extra_link", &feed.ExtraLink, p.ExtraLink)
+	setString("caption_template", &feed.CaptionTemplate, p.CaptionTemplate)
+	setBool("caption_hide_subtitle", &feed.CaptionHideSubtitle, p.CaptionHideSubtitle)
+	setString("caption_source", &feed.CaptionSource, p.CaptionSource)
+	setInt("caption_max_length", &feed.CaptionMaxLength, p.CaptionMaxLength)
+	setBool("caption_strip_links", &feed.CaptionStripLinks, p.CaptionStripLinks)
+	setBool("caption_numbers", &feed.CaptionNumbers, p.CaptionNumbers)
+	setString("schedule", &feed.Schedule, p.Schedule)
+	setString("show_notes", &feed.ShowNotes, p.ShowNotes)
+	setString("filter_include", &feed.FilterInclude, p.FilterInclude)
+	setString("filter_exclude", &feed.FilterExclude, p.FilterExclude)
+	setString("filter_episode_types", &feed.FilterEpisodeTypes, p.FilterEpisodeTypes)
+	setBool("filter_explicit", &feed.FilterExplicit, p.FilterExplicit)
+	setString("filter_min_duration", &feed.FilterMinDuration, p.FilterMinDuration)
+	setString("filter_max_duration", &feed.FilterMaxDuration, p.FilterMaxDuration)
+	if len(fields) == 0 && p.Feed == nil {
+		return nil, errors.New("nothing to update")
+	}
+	return fields, validate(*feed)
+}
+
+// validate checks the settings of a feed the way the feed set command and
+// the dashboard do
+func validate(feed models.Feed) error {
+	var errs []error
+	if _, err := feeds.ParseSchedule(feed.Schedule); err != nil {
+		errs = append(errs, err)
+	}
+	if err := caption.Validate(feed.CaptionTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("invalid caption template: %w", err))
+	}
+	if err := caption.ValidSource(feed.CaptionSource); err != nil {
+		errs = append(errs, err)
+	}
+	if feed.CaptionMaxLength < 0 {
+		errs = append(errs, errors.New("caption_max_length must not be negative"))
+	}
+	if err := shownotes.ValidMode(feed.ShowNotes); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := feeds.ParseRules(feed); err != nil {
+		errs = append(errs, err)
+	}
+	if feed.PublishReady && feed.TgChannel == 0 {
+		errs = append(errs, errors.New("a feed needs a channel to be ready"))
+	}
+	return errors.Join(errs...)
+}
+
+// Item is the representation of an item in the API
+type Item struct {
+	ID          uint       `json:"id"`
+	FeedID      int        `json:"feed_id"`
+	State       string     `json:"state"`
+	Title       string     `json:"title"`
+	Link        string     `json:"link"`
+	Published   *time.Time `json:"published,omitempty"`
+	Duration    string     `json:"duration,omitempty"`
+	Episode     string     `json:"episode,omitempty"`
+	Season      string     `json:"season,omitempty"`
+	EpisodeType string     `json:"episode_type,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	SkipReason  string     `json:"skip_reason,omitempty"`
+	Enclosures  []string   `json:"enclosures,omitempty"`
+}
+
+func newItem(item models.Item) Item {
+	v := Item{
+		ID:          item.ID,
+		FeedID:      item.FeedId,
+		State:       items.StateName(item.TgPublished),
+		Title:       item.Title,
+		Link:        item.Link,
+		Published:   item.PublishedParsed,
+		Duration:    item.ItunesDuration,
+		Episode:     item.ItunesEpisode,
+		Season:      item.ItunesSeason,
+		EpisodeType: item.ItunesEpisodeType,
+		LastError:   item.LastError,
+		SkipReason:  item.SkipReason,
+	}
+	for _, enc := range item.Enclosures {
+		v.Enclosures = append(v.Enclosures, enc.Url)
+	}
+	return v
+}
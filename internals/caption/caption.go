@@ -0,0 +1,79 @@
+package caption
+
+import (
+	"strings"
+	"text/template"
+)
+
+// Data holds the values a caption template can use. Captions are sent as
+// Telegram Markdown and the values are raw feed text, md escapes them
+// outside of bold or italic text, e.g.
+//
+//	*{{.Title}}*{{if .Episode}} (#{{.Episode}}){{end}}
+//
+//	{{md .Subtitle}}
+type Data struct {
+	Title     string
+	Subtitle  string
+	Link      string
+	Season    string
+	Episode   string
+	FeedTitle string
+	ExtraLink string
+	// Podcast namespace of the item and its feed, e.g.
+	//
+	//	{{range .Persons}}{{md .Name}} ({{.Role}}) {{end}}
+	//	{{range .Funding}}{{md .Text}}: {{md .URL}}{{end}}
+	Persons     []Person
+	Transcript  string
+	ChaptersURL string
+	Funding     []Link
+	// NotesURL is the show notes page of the item, for feeds publishing one
+	NotesURL string
+}
+
+// Person is a podcast:person of the item
+type Person struct {
+	Name string
+	Role string
+	Href string
+}
+
+// Link is a podcast:funding link of the feed
+type Link struct {
+	URL  string
+	Text string
+}
+
+// markdownEscaper escapes the characters of the Telegram legacy Markdown
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// Escape escapes the Markdown characters of text, the md function of the
+// templates. Telegram reads the escapes outside of entities only.
+func Escape(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// Parse checks that text is a valid caption template
+func Parse(text string) (*template.Template, error) {
+	return template.New("caption").Funcs(template.FuncMap{"md": Escape}).Option("missingkey=error").Parse(text)
+}
+
+// Render fills the caption template text with data
+func Render(text string, data Data) (string, error) {
+	tmpl, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Validate reports template errors, including references to unknown fields
+func Validate(text string) error {
+	_, err := Render(text, Data{})
+	return err
+}
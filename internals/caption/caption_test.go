@@ -0,0 +1,52 @@
+package caption
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	out, err := Render("*{{.Title}}*{{if .Episode}} #{{.Episode}}{{end}}\n\n{{.Subtitle}}\n", Data{Title: "Pilot", Episode: "1", Subtitle: "First one"})
+	assert.NoError(t, err)
+	assert.Equal(t, "*Pilot* #1\n\nFirst one", out)
+
+	_, err = Render("{{.Title", Data{})
+	assert.Error(t, err)
+	_, err = Render("{{.Unknown}}", Data{})
+	assert.Error(t, err)
+}
+
+func TestRender_Podcast(t *testing.T) {
+	out, err := Render("{{range .Persons}}{{.Name}} ({{.Role}}) {{end}}\n{{range .Funding}}{{.Text}}: {{.URL}}{{end}}", Data{
+		Persons: []Person{{Name: "Jane", Role: "host"}, {Name: "Joe", Role: "guest"}},
+		Funding: []Link{{URL: "https://example.com/donate", Text: "Support"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane (host) Joe (guest) \nSupport: https://example.com/donate", out)
+
+	out, err = Render("{{range .Funding}}{{md .Text}}: {{md .URL}}{{end}}", Data{
+		Funding: []Link{{URL: "https://example.com/tip_jar", Text: "Tip *us*"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Tip \\*us\\*: https://example.com/tip\\_jar", out, "md escapes Markdown")
+}
+
+func TestOptions(t *testing.T) {
+	assert.NoError(t, ValidSource(""))
+	assert.NoError(t, ValidSource(SourceSummary))
+	assert.Error(t, ValidSource("title"))
+
+	assert.Equal(t, "Show notes at and www links", StripLinks("Show notes at https://example.com/ep1?x=1 and www links"))
+	assert.Equal(t, "Visit", StripLinks("Visit www.example.com"))
+
+	assert.Equal(t, "short", Truncate("short", 10))
+	assert.Equal(t, "abc...", Truncate("abcdef", 3))
+	assert.Equal(t, "Привет", Truncate("Привет", 6), "characters are counted, not bytes")
+	assert.Equal(t, "При...", Truncate("Привет", 3))
+
+	assert.Equal(t, "S2E5", Numbers("2", "5"))
+	assert.Equal(t, "#5", Numbers("", "5"))
+	assert.Equal(t, "S2", Numbers("2", ""))
+	assert.Empty(t, Numbers("", ""))
+}
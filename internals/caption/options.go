@@ -0,0 +1,56 @@
+package caption
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sources of the caption text, stored in Feed.CaptionSource
+const (
+	SourceSubtitle    = "subtitle"
+	SourceSummary     = "summary"
+	SourceDescription = "description"
+)
+
+// ValidSource reports an unknown caption source, empty means the subtitle
+func ValidSource(source string) error {
+	switch source {
+	case "", SourceSubtitle, SourceSummary, SourceDescription:
+		return nil
+	}
+	return fmt.Errorf("unknown caption source %q, expected subtitle, summary or description", source)
+}
+
+var (
+	linkPattern  = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+	spacePattern = regexp.MustCompile(`[ \t]{2,}`)
+)
+
+// StripLinks removes the URLs of text
+func StripLinks(text string) string {
+	text = linkPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+}
+
+// Truncate cuts text to at most limit characters and marks the cut with "..."
+func Truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit]) + "..."
+}
+
+// Numbers formats the season and episode numbers, e.g. S2E5 or #5
+func Numbers(season, episode string) string {
+	switch {
+	case season != "" && episode != "":
+		return "S" + season + "E" + episode
+	case episode != "":
+		return "#" + episode
+	case season != "":
+		return "S" + season
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package chapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Chapter is a titled position in an episode
+type Chapter struct {
+	Start time.Duration
+	Title string
+}
+
+// maxJSONSize bounds the chapters documents read by Fetch
+const maxJSONSize = 1 << 20
+
+type jsonChapters struct {
+	Chapters []struct {
+		StartTime float64 `json:"startTime"`
+		Title     string  `json:"title"`
+		TOC       *bool   `json:"toc"`
+	} `json:"chapters"`
+}
+
+// ParseJSON reads a podcast:chapters JSON document. Chapters hidden from the
+// table of contents and chapters without a title are left out.
+func ParseJSON(r io.Reader) ([]Chapter, error) {
+	var doc jsonChapters
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing chapters: %w", err)
+	}
+	var list []Chapter
+	for _, c := range doc.Chapters {
+		title := strings.TrimSpace(c.Title)
+		if title == "" || (c.TOC != nil && !*c.TOC) || c.StartTime < 0 {
+			continue
+		}
+		list = append(list, Chapter{Start: time.Duration(c.StartTime * float64(time.Second)), Title: title})
+	}
+	sortChapters(list)
+	return list, nil
+}
+
+// Fetch downloads and parses the podcast:chapters JSON document at url
+func Fetch(client *http.Client, url string) ([]Chapter, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching chapters: %s", resp.Status)
+	}
+	return ParseJSON(io.LimitReader(resp.Body, maxJSONSize))
+}
+
+// Format renders the chapters as "MM:SS Title" lines, "H:MM:SS Title" past
+// the first hour, which Telegram turns into seek links on the audio
+func Format(list []Chapter) string {
+	lines := make([]string, 0, len(list))
+	for _, c := range list {
+		lines = append(lines, Timestamp(c.Start)+" "+c.Title)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Timestamp formats d as MM:SS, or H:MM:SS from one hour on
+func Timestamp(d time.Duration) string {
+	total := int(d / time.Second)
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
+
+func sortChapters(list []Chapter) {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Start < list[j].Start })
+}
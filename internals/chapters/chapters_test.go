@@ -0,0 +1,110 @@
+package chapters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSON(t *testing.T) {
+	list, err := ParseJSON(strings.NewReader(`{"version":"1.2.0","chapters":[
+		{"startTime":754.5,"title":"Interview"},
+		{"startTime":0,"title":"Intro"},
+		{"startTime":30,"title":"Sponsor","toc":false},
+		{"startTime":3725,"title":" Outro "},
+		{"startTime":40,"img":"https://example.com/art.jpg"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 754500 * time.Millisecond, Title: "Interview"},
+		{Start: 3725 * time.Second, Title: "Outro"},
+	}, list)
+	assert.Equal(t, "00:00 Intro\n12:34 Interview\n1:02:05 Outro", Format(list))
+
+	_, err = ParseJSON(strings.NewReader("<html>"))
+	assert.Error(t, err)
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chapters.json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"chapters":[{"startTime":0,"title":"Intro"}]}`)
+	}))
+	defer srv.Close()
+
+	list, err := Fetch(srv.Client(), srv.URL+"/chapters.json")
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{{Title: "Intro"}}, list)
+	_, err = Fetch(srv.Client(), srv.URL+"/missing.json")
+	assert.Error(t, err)
+}
+
+// id3Frame encodes a frame, with a syncsafe size for ID3v2.4
+func id3Frame(version byte, id string, body []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	size := make([]byte, 4)
+	if version == 4 {
+		n := len(body)
+		size = []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	} else {
+		binary.BigEndian.PutUint32(size, uint32(len(body)))
+	}
+	b.Write(size)
+	b.Write([]byte{0, 0})
+	b.Write(body)
+	return b.Bytes()
+}
+
+func chapFrame(version byte, id string, startMs uint32, title []byte) []byte {
+	var body bytes.Buffer
+	body.WriteString(id)
+	body.WriteByte(0)
+	binary.Write(&body, binary.BigEndian, []uint32{startMs, startMs + 1000, 0xffffffff, 0xffffffff})
+	if title != nil {
+		body.Write(id3Frame(version, "TIT2", title))
+	}
+	return id3Frame(version, "CHAP", body.Bytes())
+}
+
+func id3Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 16)...) // padding
+	n := len(body)
+	header := []byte{'I', 'D', '3', version, 0, 0, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(append(header, body...), 0xff, 0xfb) // followed by audio
+}
+
+func TestReadID3(t *testing.T) {
+	for _, version := range []byte{3, 4} {
+		tag := id3Tag(version,
+			id3Frame(version, "TIT2", append([]byte{3}, "Episode"...)),
+			chapFrame(version, "ch1", 65000, append([]byte{3}, "Second"...)),
+			chapFrame(version, "ch0", 0, append([]byte{0}, "Caf\xe9"...)),
+			chapFrame(version, "ch2", 3600000, []byte{1, 0xff, 0xfe, 'E', 0, 'n', 0, 'd', 0}),
+			chapFrame(version, "ch3", 4000000, nil),
+		)
+		list, err := ReadID3(bytes.NewReader(tag))
+		assert.NoError(t, err, "ID3v2.%d", version)
+		assert.Equal(t, []Chapter{
+			{Start: 0, Title: "Café"},
+			{Start: 65 * time.Second, Title: "Second"},
+			{Start: time.Hour, Title: "End"},
+		}, list, "ID3v2.%d", version)
+	}
+
+	_, err := ReadID3(bytes.NewReader([]byte{0xff, 0xfb, 0x90, 0x00}))
+	assert.ErrorIs(t, err, ErrNoTag)
+	_, err = ReadID3(bytes.NewReader([]byte("ID3\x02\x00\x00\x00\x00\x00\x00")))
+	assert.Error(t, err)
+}
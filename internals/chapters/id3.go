@@ -0,0 +1,157 @@
+package chapters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrNoTag is returned by ReadID3 when the file has no ID3v2 tag
+var ErrNoTag = errors.New("no ID3v2 tag")
+
+// maxTagSize bounds the ID3v2 tags read by ReadID3, cover art included
+const maxTagSize = 16 << 20
+
+// ReadID3 reads the chapters of the CHAP frames of an ID3v2.3 or ID3v2.4
+// tag at the start of r, titled by their TIT2 sub-frame
+func ReadID3(r io.Reader) ([]Chapter, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrNoTag
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, ErrNoTag
+	}
+	version, flags := header[3], header[5]
+	if version != 3 && version != 4 {
+		return nil, fmt.Errorf("unsupported ID3v2.%d tag", version)
+	}
+	size := syncsafe(header[6:10])
+	if size > maxTagSize {
+		return nil, fmt.Errorf("ID3v2 tag of %d bytes is too large", size)
+	}
+	tag := make([]byte, size)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil, fmt.Errorf("reading ID3v2 tag: %w", err)
+	}
+	if flags&0x80 != 0 {
+		// the whole tag is unsynchronised, only done by very old writers
+		tag = bytes.ReplaceAll(tag, []byte{0xff, 0x00}, []byte{0xff})
+	}
+	if flags&0x40 != 0 && len(tag) >= 4 {
+		extended := int(binary.BigEndian.Uint32(tag[:4]))
+		if version == 4 {
+			extended = syncsafe(tag[:4])
+		} else {
+			extended += 4
+		}
+		if extended > len(tag) {
+			return nil, fmt.Errorf("invalid ID3v2 extended header")
+		}
+		tag = tag[extended:]
+	}
+
+	var list []Chapter
+	for _, frame := range frames(tag, version) {
+		if frame.id != "CHAP" {
+			continue
+		}
+		if c, ok := parseCHAP(frame.body, version); ok {
+			list = append(list, c)
+		}
+	}
+	sortChapters(list)
+	return list, nil
+}
+
+type frame struct {
+	id   string
+	body []byte
+}
+
+// frames splits the frames of a tag, stopping at the padding
+func frames(data []byte, version byte) []frame {
+	var list []frame
+	for len(data) >= 10 && data[0] != 0 {
+		id := string(data[:4])
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		if version == 4 {
+			size = syncsafe(data[4:8])
+		}
+		if size < 0 || 10+size > len(data) {
+			break
+		}
+		list = append(list, frame{id: id, body: data[10 : 10+size]})
+		data = data[10+size:]
+	}
+	return list
+}
+
+// parseCHAP reads a CHAP frame: element id, start and end times in
+// milliseconds, start and end offsets, then the sub-frames
+func parseCHAP(body []byte, version byte) (Chapter, bool) {
+	end := bytes.IndexByte(body, 0)
+	if end < 0 || len(body) < end+17 {
+		return Chapter{}, false
+	}
+	start := binary.BigEndian.Uint32(body[end+1 : end+5])
+	c := Chapter{Start: time.Duration(start) * time.Millisecond}
+	for _, sub := range frames(body[end+17:], version) {
+		if sub.id == "TIT2" {
+			c.Title = strings.TrimSpace(decodeText(sub.body))
+		}
+	}
+	return c, c.Title != ""
+}
+
+// decodeText decodes a text frame according to its encoding byte
+func decodeText(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	text := body[1:]
+	switch body[0] {
+	case 0:
+		runes := make([]rune, 0, len(text))
+		for _, b := range text {
+			if b == 0 {
+				break
+			}
+			runes = append(runes, rune(b))
+		}
+		return string(runes)
+	case 1, 2:
+		bigEndian := body[0] == 2
+		if len(text) >= 2 && text[0] == 0xff && text[1] == 0xfe {
+			text, bigEndian = text[2:], false
+		} else if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+			text, bigEndian = text[2:], true
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			var u uint16
+			if bigEndian {
+				u = binary.BigEndian.Uint16(text[i:])
+			} else {
+				u = binary.LittleEndian.Uint16(text[i:])
+			}
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	default:
+		return strings.TrimRight(string(text), "\x00")
+	}
+}
+
+// syncsafe decodes a 28 bit integer stored in 4 bytes of 7 bits
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/tutuna/echopan/internals/database"
+	"github.com/tutuna/echopan/internals/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvFile names the environment variable holding the configuration file path
+const EnvFile = "ECHOPAN_CONFIG"
+
+// redacted replaces secrets in printed configurations
+const redacted = "REDACTED"
+
+// Config holds every setting of echopan. Values are read from the defaults,
+// then the YAML file, then the environment and finally the command line.
+type Config struct {
+	Database DatabaseConfig `yaml:"database"`
+	Telegram TelegramConfig `yaml:"telegram"`
+	Service  ServiceConfig  `yaml:"service"`
+	Feeds    FeedsConfig    `yaml:"feeds"`
+	Publish  PublishConfig  `yaml:"publish"`
+	Log      LogConfig      `yaml:"log"`
+	Alerts   AlertsConfig   `yaml:"alerts"`
+}
+
+type DatabaseConfig struct {
+	Type            database.DbType `yaml:"type"`
+	File            string          `yaml:"file"`
+	DSN             string          `yaml:"dsn"`
+	MaxOpenConns    int             `yaml:"max_open_conns"`
+	MaxIdleConns    int             `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration   `yaml:"conn_max_lifetime"`
+}
+
+type TelegramConfig struct {
+	BotToken string `yaml:"bot_token"`
+	BotURL   string `yaml:"bot_url"`
+}
+
+type ServiceConfig struct {
+	// Listen is the address serving /metrics, /healthz and /readyz, empty disables the HTTP server
+	Listen string `yaml:"listen"`
+	// Interval is the pause between two publishing rounds
+	Interval time.Duration `yaml:"interval"`
+	// StallTimeout is how long a publishing round or a download may run
+	// before /healthz reports the service as wedged
+	StallTimeout time.Duration `yaml:"stall_timeout"`
+	// PublishDelay is the pause after each published episode
+	PublishDelay time.Duration `yaml:"publish_delay"`
+	// PublicURL is where /notes of the HTTP server is reachable from the
+	// Internet, needed by feeds publishing their show notes as a page
+	PublicURL string `yaml:"public_url"`
+	// APIToken enables the HTTP API under /api/, requests must send it as a bearer token
+	APIToken string `yaml:"api_token"`
+	// AdminPassword enables the admin dashboard under /admin/, behind basic
+	// auth as AdminUser
+	AdminUser     string `yaml:"admin_user"`
+	AdminPassword string `yaml:"admin_password"`
+}
+
+type FeedsConfig struct {
+	// ItemLimit caps the number of items ingested per feed, 0 means the whole feed
+	ItemLimit int `yaml:"item_limit"`
+	// Backoff is the wait before fetching a failing feed again, doubled after every failure
+	Backoff time.Duration `yaml:"backoff"`
+	// MaxBackoff caps the wait between two fetches of a failing feed
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// QuarantineAfter is the number of consecutive failures after which a
+	// feed is no longer fetched, 0 never quarantines
+	QuarantineAfter int `yaml:"quarantine_after"`
+	// StaleAfter is how long a feed may go without a new episode before feedHealth reports it
+	StaleAfter time.Duration `yaml:"stale_after"`
+}
+
+type PublishConfig struct {
+	// SubtitleLimit is the number of subtitle characters kept in captions
+	SubtitleLimit int `yaml:"subtitle_limit"`
+	// Chapters lists the episode chapters as timestamps under the caption,
+	// or in a reply when the caption would be too long
+	Chapters bool `yaml:"chapters"`
+	// Explicit is the policy for explicit episodes, see the Explicit constants
+	Explicit string `yaml:"explicit"`
+	// ExplicitChannels overrides Explicit for some Telegram channels
+	ExplicitChannels map[int64]string `yaml:"explicit_channels"`
+}
+
+// Policies for explicit episodes
+const (
+	// ExplicitAllow publishes explicit episodes like the others
+	ExplicitAllow = "allow"
+	// ExplicitMark publishes explicit episodes with a warning in the caption
+	ExplicitMark = "mark"
+	// ExplicitSkip never publishes explicit episodes
+	ExplicitSkip = "skip"
+)
+
+func validExplicit(policy string) bool {
+	return policy == ExplicitAllow || policy == ExplicitMark || policy == ExplicitSkip
+}
+
+// ExplicitPolicy returns the policy for explicit episodes of a channel
+func (p PublishConfig) ExplicitPolicy(channel int64) string {
+	if policy, ok := p.ExplicitChannels[channel]; ok {
+		return policy
+	}
+	return p.Explicit
+}
+
+type LogConfig struct {
+	// Level is the lowest level written: debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is text or json
+	Format string `yaml:"format"`
+}
+
+type AlertsConfig struct {
+	// ChatID is the Telegram chat receiving the alerts, 0 disables them
+	ChatID int64 `yaml:"chat_id"`
+	// Cooldown is how long the same alert is not repeated
+	Cooldown time.Duration `yaml:"cooldown"`
+	// FetchFailures is the number of consecutive fetch failures of a feed before alerting
+	FetchFailures int `yaml:"fetch_failures"`
+	// Digest sends the alerts together once a day instead of one by one
+	Digest bool `yaml:"digest"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Database: DatabaseConfig{Type: database.DbTypeSqlite},
+		Service: ServiceConfig{
+			Listen:       ":9090",
+			Interval:     10 * time.Minute,
+			StallTimeout: 30 * time.Minute,
+			PublishDelay: 5 * time.Second,
+			AdminUser:    "admin",
+		},
+		Feeds: FeedsConfig{
+			Backoff:         10 * time.Minute,
+			MaxBackoff:      24 * time.Hour,
+			QuarantineAfter: 10,
+			StaleAfter:      30 * 24 * time.Hour,
+		},
+		Publish: PublishConfig{SubtitleLimit: 800, Chapters: true, Explicit: ExplicitAllow},
+		Log:     LogConfig{Level: "info", Format: logging.FormatText},
+		Alerts:  AlertsConfig{Cooldown: 6 * time.Hour, FetchFailures: 3},
+	}
+}
+
+// Load builds the configuration from the defaults, the file given with
+// -config or ECHOPAN_CONFIG, the environment and the command line flags.
+// flags may be nil. The result is not validated.
+func Load(flags *Flags) (*Config, error) {
+	cfg := Default()
+	path := os.Getenv(EnvFile)
+	if flags != nil && flags.File != "" {
+		path = flags.File
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.set(cfg, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+	if flags != nil {
+		for _, s := range settings {
+			value, ok := flags.values[s.flag]
+			if !ok {
+				continue
+			}
+			if err := s.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("-%s: %w", s.flag, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	switch c.Database.Type {
+	case database.DbTypeSqlite:
+		if c.Database.File == "" {
+			errs = append(errs, errors.New("database.file is required for sqlite"))
+		}
+	case database.DbTypePostgres, database.DbTypeMysql:
+		if c.Database.DSN == "" {
+			errs = append(errs, fmt.Errorf("database.dsn is required for %s", c.Database.Type))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("database.type %q is not one of sqlite, postgres, mysql", c.Database.Type))
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("database pool settings must not be negative"))
+	}
+	if c.Service.PublicURL != "" {
+		if u, err := url.Parse(c.Service.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("service.public_url %q is not an absolute URL", c.Service.PublicURL))
+		}
+	}
+	if c.Service.AdminPassword != "" && c.Service.AdminUser == "" {
+		errs = append(errs, errors.New("service.admin_user must be set with service.admin_password"))
+	}
+	if c.Telegram.BotURL != "" {
+		if u, err := url.Parse(c.Telegram.BotURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("telegram.bot_url %q is not an absolute URL", c.Telegram.BotURL))
+		}
+	}
+	if c.Service.Interval <= 0 {
+		errs = append(errs, errors.New("service.interval must be positive"))
+	}
+	if c.Service.StallTimeout <= 0 {
+		errs = append(errs, errors.New("service.stall_timeout must be positive"))
+	}
+	if c.Service.PublishDelay < 0 {
+		errs = append(errs, errors.New("service.publish_delay must not be negative"))
+	}
+	if c.Feeds.ItemLimit < 0 {
+		errs = append(errs, errors.New("feeds.item_limit must not be negative"))
+	}
+	if c.Feeds.Backoff < 0 || c.Feeds.MaxBackoff < 0 || c.Feeds.QuarantineAfter < 0 {
+		errs = append(errs, errors.New("feeds backoff and quarantine settings must not be negative"))
+	}
+	if c.Feeds.StaleAfter <= 0 {
+		errs = append(errs, errors.New("feeds.stale_after must be positive"))
+	}
+	if c.Publish.SubtitleLimit <= 0 {
+		errs = append(errs, errors.New("publish.subtitle_limit must be positive"))
+	}
+	if !validExplicit(c.Publish.Explicit) {
+		errs = append(errs, fmt.Errorf("publish.explicit %q is not one of allow, mark, skip", c.Publish.Explicit))
+	}
+	for channel, policy := range c.Publish.ExplicitChannels {
+		if !validExplicit(policy) {
+			errs = append(errs, fmt.Errorf("publish.explicit_channels %d: %q is not one of allow, mark, skip", channel, policy))
+		}
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	if !logging.ValidFormat(c.Log.Format) {
+		errs = append(errs, fmt.Errorf("log.format %q is not one of text, json", c.Log.Format))
+	}
+	if c.Alerts.Cooldown < 0 {
+		errs = append(errs, errors.New("alerts.cooldown must not be negative"))
+	}
+	if c.Alerts.FetchFailures <= 0 {
+		errs = append(errs, errors.New("alerts.fetch_failures must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// DbParams returns the connection parameters of the configured database
+func (c *Config) DbParams() *database.DbParams {
+	return &database.DbParams{
+		Type:            c.Database.Type,
+		File:            c.Database.File,
+		DSN:             c.Database.DSN,
+		MaxOpenConns:    c.Database.MaxOpenConns,
+		MaxIdleConns:    c.Database.MaxIdleConns,
+		ConnMaxLifetime: c.Database.ConnMaxLifetime,
+	}
+}
+
+// Redacted returns a copy of the configuration safe to print
+func (c *Config) Redacted() *Config {
+	r := *c
+	if r.Telegram.BotToken != "" {
+		r.Telegram.BotToken = redacted
+	}
+	if r.Service.APIToken != "" {
+		r.Service.APIToken = redacted
+	}
+	if r.Service.AdminPassword != "" {
+		r.Service.AdminPassword = redacted
+	}
+	r.Database.DSN = redactDSN(r.Database.DSN)
+	return &r
+}
+
+// YAML renders the configuration in the file format
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+var (
+	keywordPassword = regexp.MustCompile(`(?i)(password=)('[^']*'|\S+)`)
+	mysqlPassword   = regexp.MustCompile(`^([^:@/]*):[^@]*@`)
+)
+
+// redactDSN hides the password of URL, keyword/value and mysql style DSNs
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	}
+	dsn = keywordPassword.ReplaceAllString(dsn, "${1}"+redacted)
+	return mysqlPassword.ReplaceAllString(dsn, "${1}:"+redacted+"@")
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tutuna/echopan/internals/database"
+)
+
+// setting maps one value of the configuration to its environment variable
+// and command line flag. Secrets have no flag so they never show up in the
+// process list.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"ECHOPAN_DB_TYPE", "db-type", "Database type: sqlite, postgres or mysql", func(c *Config, v string) error {
+		c.Database.Type = database.DbType(v)
+		return nil
+	}},
+	{"ECHOPAN_DB_FILE", "db-file", "Path of the sqlite database", func(c *Config, v string) error {
+		c.Database.File = v
+		return nil
+	}},
+	{"ECHOPAN_DB_DSN", "", "", func(c *Config, v string) error {
+		c.Database.DSN = v
+		return nil
+	}},
+	{"ECHOPAN_DB_MAX_OPEN_CONNS", "db-max-open-conns", "Maximum number of open database connections", func(c *Config, v string) error {
+		return setInt(&c.Database.MaxOpenConns, v)
+	}},
+	{"ECHOPAN_DB_MAX_IDLE_CONNS", "db-max-idle-conns", "Maximum number of idle database connections", func(c *Config, v string) error {
+		return setInt(&c.Database.MaxIdleConns, v)
+	}},
+	{"ECHOPAN_DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "Maximum lifetime of a database connection", func(c *Config, v string) error {
+		return setDuration(&c.Database.ConnMaxLifetime, v)
+	}},
+	{"EP_TG_BOT_TOKEN", "", "", func(c *Config, v string) error {
+		c.Telegram.BotToken = v
+		return nil
+	}},
+	{"EP_TG_BOT_URL", "bot-url", "Telegram bot API URL", func(c *Config, v string) error {
+		c.Telegram.BotURL = v
+		return nil
+	}},
+	{"ECHOPAN_SERVICE_LISTEN", "listen", "Address of the service HTTP server, empty to disable it", func(c *Config, v string) error {
+		c.Service.Listen = v
+		return nil
+	}},
+	{"ECHOPAN_SERVICE_PUBLIC_URL", "public-url", "Public URL of the service HTTP server, used to link show notes pages", func(c *Config, v string) error {
+		c.Service.PublicURL = v
+		return nil
+	}},
+	{"ECHOPAN_API_TOKEN", "", "", func(c *Config, v string) error {
+		c.Service.APIToken = v
+		return nil
+	}},
+	{"ECHOPAN_ADMIN_USER", "admin-user", "User name of the admin dashboard", func(c *Config, v string) error {
+		c.Service.AdminUser = v
+		return nil
+	}},
+	{"ECHOPAN_ADMIN_PASSWORD", "", "", func(c *Config, v string) error {
+		c.Service.AdminPassword = v
+		return nil
+	}},
+	{"ECHOPAN_SERVICE_INTERVAL", "interval", "Pause between two publishing rounds of the service", func(c *Config, v string) error {
+		return setDuration(&c.Service.Interval, v)
+	}},
+	{"ECHOPAN_SERVICE_STALL_TIMEOUT", "stall-timeout", "Longest publishing round or download before the service reports itself unhealthy", func(c *Config, v string) error {
+		return setDuration(&c.Service.StallTimeout, v)
+	}},
+	{"ECHOPAN_PUBLISH_DELAY", "publish-delay", "Pause after each published episode", func(c *Config, v string) error {
+		return setDuration(&c.Service.PublishDelay, v)
+	}},
+	{"ECHOPAN_FEED_ITEM_LIMIT", "item-limit", "Maximum number of items ingested per feed, 0 for no limit", func(c *Config, v string) error {
+		return setInt(&c.Feeds.ItemLimit, v)
+	}},
+	{"ECHOPAN_FEED_BACKOFF", "feed-backoff", "Wait before fetching a failing feed again, doubled after every failure", func(c *Config, v string) error {
+		return setDuration(&c.Feeds.Backoff, v)
+	}},
+	{"ECHOPAN_FEED_MAX_BACKOFF", "feed-max-backoff", "Longest wait between two fetches of a failing feed", func(c *Config, v string) error {
+		return setDuration(&c.Feeds.MaxBackoff, v)
+	}},
+	{"ECHOPAN_FEED_QUARANTINE_AFTER", "feed-quarantine-after", "Consecutive failures after which a feed is no longer fetched, 0 never quarantines", func(c *Config, v string) error {
+		return setInt(&c.Feeds.QuarantineAfter, v)
+	}},
+	{"ECHOPAN_FEED_STALE_AFTER", "feed-stale-after", "Time without a new episode after which a feed is reported stale", func(c *Config, v string) error {
+		return setDuration(&c.Feeds.StaleAfter, v)
+	}},
+	{"ECHOPAN_SUBTITLE_LIMIT", "subtitle-limit", "Number of subtitle characters kept in captions", func(c *Config, v string) error {
+		return setInt(&c.Publish.SubtitleLimit, v)
+	}},
+	{"ECHOPAN_PUBLISH_CHAPTERS", "publish-chapters", "List the episode chapters as timestamps with the episode", func(c *Config, v string) error {
+		return setBool(&c.Publish.Chapters, v)
+	}},
+	{"ECHOPAN_PUBLISH_EXPLICIT", "publish-explicit", "Policy for explicit episodes: allow, mark or skip", func(c *Config, v string) error {
+		c.Publish.Explicit = v
+		return nil
+	}},
+	{"ECHOPAN_LOG_LEVEL", "log-level", "Lowest log level written: debug, info, warn or error", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"ECHOPAN_LOG_FORMAT", "log-format", "Log format: text or json", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+	{"ECHOPAN_ALERTS_CHAT_ID", "alerts-chat-id", "Telegram chat receiving operator alerts, 0 disables them", func(c *Config, v string) error {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid chat id %q", v)
+		}
+		c.Alerts.ChatID = id
+		return nil
+	}},
+	{"ECHOPAN_ALERTS_COOLDOWN", "alerts-cooldown", "How long the same alert is not repeated", func(c *Config, v string) error {
+		return setDuration(&c.Alerts.Cooldown, v)
+	}},
+	{"ECHOPAN_ALERTS_FETCH_FAILURES", "alerts-fetch-failures", "Consecutive fetch failures of a feed before alerting", func(c *Config, v string) error {
+		return setInt(&c.Alerts.FetchFailures, v)
+	}},
+	{"ECHOPAN_ALERTS_DIGEST", "alerts-digest", "Send the alerts as a daily digest", func(c *Config, v string) error {
+		return setBool(&c.Alerts.Digest, v)
+	}},
+}
+
+func setInt(dst *int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", value)
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", value)
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *time.Duration, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	*dst = d
+	return nil
+}
+
+// Flags holds the configuration given on the command line
+type Flags struct {
+	File   string
+	values map[string]string
+}
+
+// BindFlags registers -config and the configuration override flags on f.
+// The values are only applied by Load, after the file and the environment.
+func BindFlags(f *flag.FlagSet) *Flags {
+	flags := &Flags{values: map[string]string{}}
+	f.StringVar(&flags.File, "config", "", "Path of the YAML configuration file, defaults to $"+EnvFile)
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		name := s.flag
+		f.Func(name, s.usage, func(value string) error {
+			flags.values[name] = value
+			return nil
+		})
+	}
+	return flags
+}
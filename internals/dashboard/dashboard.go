@@ -0,0 +1,264 @@
+// Package dashboard serves the admin dashboard of the service: feed health,
+// recent publications and failed items, with forms to manage them
+package dashboard
+
+import (
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/repository"
+)
+
+// Number of items listed in the recent publications and the failed items
+const listLimit = 20
+
+//go:embed templates/*.html
+var files embed.FS
+
+var pages = template.Must(template.New("").Funcs(template.FuncMap{
+	"time": formatTime,
+}).ParseFS(files, "templates/*.html"))
+
+// Service runs the actions the dashboard shares with the publisher
+type Service interface {
+	// AddFeed fetches and stores the feed, created reports whether it is new
+	AddFeed(url string) (feed models.Feed, created bool, err error)
+}
+
+// Options configures the dashboard
+type Options struct {
+	// User and Password are the basic auth credentials
+	User     string
+	Password string
+	// StaleAfter is the time without a new episode after which a feed is stale
+	StaleAfter time.Duration
+}
+
+type server struct {
+	feeds   repository.FeedRepo
+	items   repository.ItemRepo
+	service Service
+	opts    Options
+}
+
+// New returns the handler of the dashboard, mounted under /admin/. Every
+// request needs the basic auth credentials of opts, and forms are only
+// accepted from the dashboard itself.
+func New(feedRepo repository.FeedRepo, itemRepo repository.ItemRepo, service Service, opts Options) http.Handler {
+	s := &server{feeds: feedRepo, items: itemRepo, service: service, opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/{$}", s.index)
+	mux.HandleFunc("POST /admin/feeds", s.addFeed)
+	mux.HandleFunc("GET /admin/feeds/{id}", s.editFeed)
+	mux.HandleFunc("POST /admin/feeds/{id}", s.saveFeed)
+	mux.HandleFunc("POST /admin/items/{id}/retry", s.retryItem)
+	return s.authenticate(http.NewCrossOriginProtection().Handler(mux))
+}
+
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || s.opts.Password == "" ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(s.opts.User)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(s.opts.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="echopan", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// feedRow is a feed in the feeds table
+type feedRow struct {
+	Feed   models.Feed
+	Health string
+	Queue  int64
+}
+
+// itemRow is an item with the feed it belongs to
+type itemRow struct {
+	Item models.Item
+	Feed string
+	// Link is the Telegram message of a published item
+	Link string
+}
+
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	report, err := s.feeds.Health(s.opts.StaleAfter, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byID := map[int]models.Feed{}
+	rows := make([]feedRow, 0, len(report))
+	for _, h := range report {
+		stats, err := s.feeds.Stats(h.Feed.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		byID[int(h.Feed.ID)] = h.Feed
+		rows = append(rows, feedRow{Feed: h.Feed, Health: h.Status(), Queue: stats.Unpublished})
+	}
+
+	recent, err := s.items.Recent(listLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	failed := models.ItemFailed
+	failures, err := s.items.List(items.Filter{State: &failed, Limit: listLimit})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	itemRows := func(list []models.Item) []itemRow {
+		rows := make([]itemRow, 0, len(list))
+		for _, item := range list {
+			feed := byID[item.FeedId]
+			rows = append(rows, itemRow{Item: item, Feed: feed.Title, Link: messageLink(feed.TgChannel, item.TgMessageId)})
+		}
+		return rows
+	}
+
+	render(w, http.StatusOK, "index.html", map[string]interface{}{
+		"Feeds":        rows,
+		"Publications": itemRows(recent),
+		"Failures":     itemRows(failures),
+	})
+}
+
+func (s *server) addFeed(w http.ResponseWriter, r *http.Request) {
+	url := strings.TrimSpace(r.PostFormValue("url"))
+	if url == "" {
+		http.Error(w, "the feed URL is required", http.StatusBadRequest)
+		return
+	}
+	feed, _, err := s.service.AddFeed(url)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/feeds/%d", feed.ID), http.StatusSeeOther)
+}
+
+func (s *server) editFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := s.feed(w, r)
+	if !ok {
+		return
+	}
+	render(w, http.StatusOK, "feed.html", map[string]interface{}{"Feed": feed})
+}
+
+// saveFeed stores the channel settings of the feed
+func (s *server) saveFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := s.feed(w, r)
+	if !ok {
+		return
+	}
+	var errs []error
+	channel, err := strconv.Atoi(strings.TrimSpace(r.PostFormValue("channel")))
+	if err != nil {
+		errs = append(errs, errors.New("the channel must be a Telegram chat id"))
+	}
+	feed.TgChannel = channel
+	feed.PublishReady = r.PostFormValue("ready") != ""
+	feed.ExtraLinkEnabled = r.PostFormValue("extra_link_enabled") != ""
+	feed.ExtraLink = strings.TrimSpace(r.PostFormValue("extra_link"))
+	feed.Schedule = strings.TrimSpace(r.PostFormValue("schedule"))
+	if _, err := feeds.ParseSchedule(feed.Schedule); err != nil {
+		errs = append(errs, err)
+	}
+	if feed.PublishReady && feed.TgChannel == 0 {
+		errs = append(errs, errors.New("a feed needs a channel to be ready"))
+	}
+	if len(errs) > 0 {
+		render(w, http.StatusBadRequest, "feed.html", map[string]interface{}{"Feed": feed, "Error": errors.Join(errs...)})
+		return
+	}
+
+	err = s.feeds.Update(feed.ID, map[string]interface{}{
+		"tg_channel":         feed.TgChannel,
+		"publish_ready":      feed.PublishReady,
+		"extra_link_enabled": feed.ExtraLinkEnabled,
+		"extra_link":         feed.ExtraLink,
+		"schedule":           feed.Schedule,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+}
+
+// retryItem puts a failed item back in the publishing queue
+func (s *server) retryItem(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	if err := s.items.SetState(uint(id), models.ItemPending); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+}
+
+// feed loads the feed of the {id} path segment, writing the error response
+// when it fails
+func (s *server) feed(w http.ResponseWriter, r *http.Request) (models.Feed, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid feed id", http.StatusBadRequest)
+		return models.Feed{}, false
+	}
+	feed, err := s.feeds.Get(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return models.Feed{}, false
+	}
+	return feed, true
+}
+
+func errorStatus(err error) int {
+	if errors.Is(err, feeds.ErrFeedNotFound) || errors.Is(err, items.ErrItemNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func render(w http.ResponseWriter, code int, page string, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	pages.ExecuteTemplate(w, page, data)
+}
+
+// messageLink returns the t.me link of a message in a channel, empty when
+// the message or the channel is unknown. Channel ids start with -100,
+// links work for the members of the channel.
+func messageLink(channel, messageID int) string {
+	id, ok := strings.CutPrefix(strconv.Itoa(channel), "-100")
+	if !ok || id == "" || messageID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%s/%d", id, messageID)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,130 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/repository"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fakeService struct {
+	repos *repository.Repos
+}
+
+func (s fakeService) AddFeed(url string) (models.Feed, bool, error) {
+	return s.repos.Feeds.FirstOrCreateByURL(models.Feed{Title: "Added", Feed: url})
+}
+
+func newTestDashboard(t *testing.T) (http.Handler, *repository.Repos) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{}, &models.Enclosure{})
+	db.Create(&models.Feed{Title: "Podcast", Feed: "https://example.com/rss", TgChannel: -1001234, ConsecutiveFailures: 2, LastFetchError: "http error: 503"})
+	published := time.Now()
+	db.Create(&models.Item{Title: "Pilot", FeedId: 1, TgPublished: models.ItemPublished, TgMessageId: 42, TgPublishedAt: &published})
+	db.Create(&models.Item{Title: "Second", FeedId: 1, TgPublished: models.ItemFailed, LastError: "Forbidden: bot is not a member"})
+	db.Create(&models.Item{Title: "Third", FeedId: 1})
+	repos := repository.New(db)
+	return New(repos.Feeds, repos.Items, fakeService{repos}, Options{User: "admin", Password: "pa55word", StaleAfter: time.Hour}), repos
+}
+
+func do(handler http.Handler, method, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("admin", "pa55word")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthentication(t *testing.T) {
+	handler, _ := newTestDashboard(t)
+	for _, password := range []string{"", "wrong"} {
+		req := httptest.NewRequest("GET", "/admin/", nil)
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	handler, _ := newTestDashboard(t)
+
+	rec := do(handler, "GET", "/admin/", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `<td class="broken">broken</td>`)
+	assert.Contains(t, body, "<td>1</td>", "the queue holds the pending item")
+	assert.Contains(t, body, `<a href="https://t.me/c/1234/42">Pilot</a>`)
+	assert.Contains(t, body, "Forbidden: bot is not a member")
+	assert.Contains(t, body, `action="/admin/items/2/retry"`)
+	assert.Equal(t, http.StatusNotFound, do(handler, "GET", "/admin/missing", nil).Code)
+}
+
+func TestRetry(t *testing.T) {
+	handler, repos := newTestDashboard(t)
+
+	rec := do(handler, "POST", "/admin/items/2/retry", nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	item, _ := repos.Items.Get(2)
+	assert.Equal(t, models.ItemPending, item.TgPublished)
+	assert.Empty(t, item.LastError)
+	assert.Equal(t, http.StatusNotFound, do(handler, "POST", "/admin/items/9/retry", nil).Code)
+
+	req := httptest.NewRequest("POST", "/admin/items/2/retry", nil)
+	req.SetBasicAuth("admin", "pa55word")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "forms from other sites are refused")
+}
+
+func TestFeedForms(t *testing.T) {
+	handler, repos := newTestDashboard(t)
+
+	rec := do(handler, "POST", "/admin/feeds", url.Values{"url": {"https://example.com/new"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/admin/feeds/2", rec.Header().Get("Location"))
+	assert.Equal(t, http.StatusBadRequest, do(handler, "POST", "/admin/feeds", url.Values{"url": {" "}}).Code)
+
+	rec = do(handler, "GET", "/admin/feeds/2", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "https://example.com/new")
+
+	rec = do(handler, "POST", "/admin/feeds/2", url.Values{"channel": {"-1005"}, "ready": {"on"}, "schedule": {"24h"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	feed, _ := repos.Feeds.Get(2)
+	assert.Equal(t, -1005, feed.TgChannel)
+	assert.True(t, feed.PublishReady)
+	assert.Equal(t, "24h", feed.Schedule)
+
+	rec = do(handler, "POST", "/admin/feeds/2", url.Values{"channel": {"0"}, "ready": {"on"}, "schedule": {"daily"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid schedule")
+	assert.Contains(t, rec.Body.String(), "needs a channel")
+	feed, _ = repos.Feeds.Get(2)
+	assert.Equal(t, "24h", feed.Schedule, "nothing is stored on errors")
+
+	assert.Equal(t, http.StatusNotFound, do(handler, "GET", "/admin/feeds/9", nil).Code)
+}
+
+func TestMessageLink(t *testing.T) {
+	assert.Equal(t, "https://t.me/c/1234/42", messageLink(-1001234, 42))
+	assert.Empty(t, messageLink(-1001234, 0))
+	assert.Empty(t, messageLink(1234, 42), "private chats have no links")
+	assert.Empty(t, messageLink(0, 42))
+}
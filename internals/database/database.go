@@ -1,10 +1,13 @@
 package database
 
 import (
+	"time"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"os"
 )
 
 type DbType string
@@ -12,27 +15,40 @@ type DbType string
 const (
 	DbTypeSqlite   DbType = "sqlite"
 	DbTypePostgres DbType = "postgres"
+	DbTypeMysql    DbType = "mysql"
 )
 
 type DbParams struct {
 	Type DbType
 	File string
-	DSN  string // For postgres or other DBs
+	DSN  string // For postgres and mysql
+
+	// Connection pool tuning, zero values keep the database/sql defaults
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
 }
 
-func InitDbParams() *DbParams {
-	dbType := os.Getenv("ECHOPAN_DB_TYPE")
-	if dbType == "" {
-		dbType = string(DbTypeSqlite)
+// DbConnect opens the database described by params and applies the pool settings
+func DbConnect(params *DbParams) *gorm.DB {
+	db := open(params)
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic("failed to get database pool: " + err.Error())
+	}
+	if params.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(params.MaxOpenConns)
 	}
-	return &DbParams{
-		Type: DbType(dbType),
-		File: os.Getenv("ECHOPAN_DB_FILE"),
-		DSN:  os.Getenv("ECHOPAN_DB_DSN"),
+	if params.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(params.MaxIdleConns)
 	}
+	if params.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(params.ConnMaxLifetime)
+	}
+	return db
 }
 
-func DbConnect(params *DbParams) *gorm.DB {
+func open(params *DbParams) *gorm.DB {
 	switch params.Type {
 	case DbTypeSqlite:
 		if params.File == "" {
@@ -47,12 +63,12 @@ func DbConnect(params *DbParams) *gorm.DB {
 		if params.DSN == "" {
 			panic("DSN is required for postgres")
 		}
-		imported := false
-		// Import driver only if needed
-		if !imported {
-			_ = os.Getenv // dummy usage to avoid unused import error
-		}
 		return openPostgres(params.DSN)
+	case DbTypeMysql:
+		if params.DSN == "" {
+			panic("DSN is required for mysql")
+		}
+		return openMysql(params.DSN)
 	default:
 		panic("unsupported database type: " + string(params.Type))
 	}
@@ -65,3 +81,17 @@ func openPostgres(dsn string) *gorm.DB {
 	}
 	return db
 }
+
+func openMysql(dsn string) *gorm.DB {
+	cfg, err := mysqlDriver.ParseDSN(dsn)
+	if err != nil {
+		panic("invalid mysql DSN: " + err.Error())
+	}
+	// Timestamps are scanned into time.Time, which the driver only does with parseTime
+	cfg.ParseTime = true
+	db, err := gorm.Open(mysql.Open(cfg.FormatDSN()), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect mysql database: " + err.Error())
+	}
+	return db
+}
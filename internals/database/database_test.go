@@ -7,31 +7,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestInitDbParams_WithEnvVar(t *testing.T) {
-	expectedFile := "test.db"
-	if err := os.Setenv("ECHOPAN_DB_FILE", expectedFile); err != nil {
-		t.Fatalf("failed to set env: %v", err)
-	}
-	defer func() {
-		if err := os.Unsetenv("ECHOPAN_DB_FILE"); err != nil {
-			t.Fatalf("failed to unset env: %v", err)
-		}
-	}()
-
-	params := InitDbParams()
-	assert.Equal(t, expectedFile, params.File)
-}
-
-func TestInitDbParams_WithoutEnvVar(t *testing.T) {
-	// Ensure the environment variable is not set
-	if err := os.Unsetenv("ECHOPAN_DB_FILE"); err != nil {
-		t.Fatalf("failed to unset env: %v", err)
-	}
-
-	params := InitDbParams()
-	assert.Equal(t, "", params.File)
-}
-
 func TestDbConnect_InMemory(t *testing.T) {
 	params := &DbParams{Type: DbTypeSqlite, File: ":memory:"} // Use in-memory SQLite database
 	db := DbConnect(params)
@@ -108,3 +83,42 @@ func TestDbConnect_Postgres_ValidDSN(t *testing.T) {
 	assert.NoError(t, err, "Should be able to execute a simple query on Postgres DB")
 	assert.Equal(t, 1, result, "Query result should be 1")
 }
+
+func TestDbConnect_Mysql_EmptyDSN(t *testing.T) {
+	params := &DbParams{Type: DbTypeMysql, DSN: ""}
+	assert.PanicsWithValue(t, "DSN is required for mysql", func() {
+		DbConnect(params)
+	})
+}
+
+func TestDbConnect_Mysql_MalformedDSN(t *testing.T) {
+	params := &DbParams{Type: DbTypeMysql, DSN: "not a dsn"}
+	assert.Panics(t, func() {
+		DbConnect(params)
+	})
+}
+
+// Note: This test requires a running MySQL instance and a valid DSN.
+// You can set ECHOPAN_TEST_MYSQL_DSN to a test database for integration testing.
+func TestDbConnect_Mysql_ValidDSN(t *testing.T) {
+	dsn := os.Getenv("ECHOPAN_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("ECHOPAN_TEST_MYSQL_DSN not set; skipping MySQL integration test")
+	}
+	params := &DbParams{Type: DbTypeMysql, DSN: dsn}
+	db := DbConnect(params)
+	assert.NotNil(t, db, "Database connection should not be nil for valid MySQL DSN")
+
+	var result int
+	err := db.Raw("SELECT 1").Scan(&result).Error
+	assert.NoError(t, err, "Should be able to execute a simple query on MySQL DB")
+	assert.Equal(t, 1, result, "Query result should be 1")
+}
+
+func TestDbConnect_AppliesPool(t *testing.T) {
+	params := &DbParams{Type: DbTypeSqlite, File: ":memory:", MaxOpenConns: 3}
+	db := DbConnect(params)
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+}
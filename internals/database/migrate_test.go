@@ -0,0 +1,294 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/feedurl"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func newMigrationDB(t *testing.T) *gorm.DB {
+	db := DbConnect(&DbParams{Type: DbTypeSqlite, File: filepath.Join(t.TempDir(), "migrate.db")})
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestMigrate_AppliesAllOnce(t *testing.T) {
+	db := newMigrationDB(t)
+
+	applied, err := Migrate(db)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(Migrations()))
+
+	applied, err = Migrate(db)
+	assert.NoError(t, err)
+	assert.Empty(t, applied, "a second run should not apply anything")
+
+	statuses, err := Status(db)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.True(t, s.Applied, "migration %d should be applied", s.Version)
+		assert.NotNil(t, s.AppliedAt)
+	}
+	assert.True(t, db.Migrator().HasIndex("items", "idx_items_feed_state"))
+}
+
+func TestMigrate_SchemaFitsModels(t *testing.T) {
+	db := newMigrationDB(t)
+	_, err := Migrate(db)
+	assert.NoError(t, err)
+
+	feed := models.Feed{Title: "Feed", Feed: "http://example.com/rss"}
+	assert.NoError(t, db.Create(&feed).Error)
+	item := models.Item{Title: "Episode", FeedId: int(feed.ID)}
+	assert.NoError(t, db.Create(&item).Error)
+	assert.NoError(t, db.Create(&models.Enclosure{ItemId: item.ID, Url: "http://example.com/e.mp3"}).Error)
+	assert.NoError(t, db.Create(&models.Image{FeedId: int(feed.ID), Url: "http://example.com/i.png"}).Error)
+	assert.NoError(t, db.Create(&models.Person{ItemId: item.ID, Name: "Host", Role: "host"}).Error)
+	assert.NoError(t, db.Create(&models.Transcript{ItemId: item.ID, Url: "http://example.com/e.vtt"}).Error)
+	assert.NoError(t, db.Create(&models.Funding{FeedId: feed.ID, Url: "http://example.com/donate"}).Error)
+}
+
+func TestMigrate_ExistingAutoMigratedDatabase(t *testing.T) {
+	db := newMigrationDB(t)
+	assert.NoError(t, db.AutoMigrate(&models.Feed{}, &models.Image{}, &models.Item{}, &models.Enclosure{}))
+	db.Create(&models.Feed{Title: "Existing"})
+
+	_, err := Migrate(db)
+	assert.NoError(t, err)
+
+	var count int64
+	db.Model(&models.Feed{}).Count(&count)
+	assert.Equal(t, int64(1), count, "existing rows must survive the baseline migration")
+}
+
+func TestMigrate_BackfillsURLKeys(t *testing.T) {
+	db := newMigrationDB(t)
+	_, err := Migrate(db)
+	assert.NoError(t, err)
+	// back to the feeds without url_key, before feeds_url_identity
+	for {
+		reverted, err := Rollback(db, 1)
+		if !assert.NoError(t, err) || len(reverted) == 0 || reverted[0].Name == "feeds_url_identity" {
+			break
+		}
+	}
+	for _, url := range []string{"https://example.com/rss", "HTTPS://example.com:443/rss", ""} {
+		assert.NoError(t, db.Exec("INSERT INTO feeds (title, feed) VALUES (?, ?)", "Podcast", url).Error)
+	}
+
+	_, err = Migrate(db)
+	assert.NoError(t, err)
+
+	var keys []sql.NullString
+	assert.NoError(t, db.Table("feeds").Order("id asc").Pluck("url_key", &keys).Error)
+	if assert.Len(t, keys, 3) {
+		assert.Equal(t, feedurl.Key("https://example.com/rss"), keys[0].String)
+		assert.False(t, keys[1].Valid, "the duplicate keeps no key")
+		assert.False(t, keys[2].Valid)
+	}
+	assert.True(t, db.Migrator().HasIndex(&models.Feed{}, "idx_feeds_url_key"))
+	assert.Error(t, db.Create(&models.Feed{Title: "Again", Feed: "https://EXAMPLE.com/rss"}).Error)
+}
+
+func TestRollback(t *testing.T) {
+	db := newMigrationDB(t)
+	_, err := Migrate(db)
+	assert.NoError(t, err)
+
+	reverted, err := Rollback(db, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, reverted, 1) {
+		assert.Equal(t, Migrations()[len(Migrations())-1].Version, reverted[0].Version)
+	}
+	assert.False(t, db.Migrator().HasColumn(&models.Item{}, "TgMessageId"))
+	assert.False(t, db.Migrator().HasColumn(&models.Item{}, "TgPublishedAt"))
+	assert.True(t, db.Migrator().HasIndex("items", "idx_items_feed_state"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "CaptionSource"))
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "CaptionHideSubtitle"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "FilterInclude"))
+	assert.False(t, db.Migrator().HasColumn(&models.Item{}, "SkipReason"))
+	assert.True(t, db.Migrator().HasColumn(&models.Feed{}, "ShowNotes"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "ShowNotes"))
+	assert.True(t, db.Migrator().HasIndex(&models.Feed{}, "idx_feeds_url_key"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasTable(&models.Person{}))
+	assert.False(t, db.Migrator().HasTable(&models.Funding{}))
+	assert.False(t, db.Migrator().HasColumn(&models.Item{}, "ChaptersURL"))
+	assert.True(t, db.Migrator().HasIndex("items", "idx_items_feed_state"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "URLKey"))
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "PodcastGUID"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasTable(&models.FeedURLChange{}))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "Quarantined"))
+	assert.True(t, db.Migrator().HasIndex(&models.Feed{}, "idx_feeds_deleted_at"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasColumn(&models.Item{}, "LastError"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasColumn(&models.Feed{}, "Schedule"))
+	assert.True(t, db.Migrator().HasColumn(&models.Feed{}, "Title"))
+	assert.True(t, db.Migrator().HasIndex(&models.Feed{}, "idx_feeds_deleted_at"))
+
+	reverted, err = Rollback(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasIndex("items", "idx_items_feed_state"))
+
+	reverted, err = Rollback(db, len(Migrations()))
+	assert.NoError(t, err)
+	assert.Len(t, reverted, len(Migrations())-11)
+	assert.False(t, db.Migrator().HasTable("feeds"))
+
+	statuses, err := Status(db)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.False(t, s.Applied)
+	}
+}
+
+func TestMigrate_KeepsFeed34WithoutSubtitle(t *testing.T) {
+	db := newMigrationDB(t)
+	_, err := Migrate(db)
+	assert.NoError(t, err)
+	// back to the feeds without caption options
+	for {
+		reverted, err := Rollback(db, 1)
+		if !assert.NoError(t, err) || len(reverted) == 0 || reverted[0].Name == "feeds_caption_options" {
+			break
+		}
+	}
+	for _, id := range []int{33, 34} {
+		assert.NoError(t, db.Exec("INSERT INTO feeds (id, title) VALUES (?, ?)", id, "Podcast").Error)
+	}
+
+	_, err = Migrate(db)
+	assert.NoError(t, err)
+
+	var hidden []bool
+	assert.NoError(t, db.Table("feeds").Order("id asc").Pluck("caption_hide_subtitle", &hidden).Error)
+	assert.Equal(t, []bool{false, true}, hidden)
+}
+
+func TestMigrate_NilDB(t *testing.T) {
+	_, err := Migrate(nil)
+	assert.Error(t, err)
+}
+
+func TestBaselineImage_ColumnTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		open     func(conn *sql.DB) gorm.Dialector
+		expected string
+		indexes  bool
+	}{
+		{
+			name: "mysql",
+			open: func(conn *sql.DB) gorm.Dialector {
+				return mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true})
+			},
+			expected: "CREATE TABLE `images` .*`full_image` longblob",
+		},
+		{
+			name: "postgres",
+			open: func(conn *sql.DB) gorm.Dialector {
+				return postgres.New(postgres.Config{Conn: conn})
+			},
+			expected: `CREATE TABLE "images" .*"full_image" bytea`,
+			indexes:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock database: %v", err)
+			}
+			defer conn.Close()
+			db, err := gorm.Open(tt.open(conn), &gorm.Config{})
+			if err != nil {
+				t.Fatalf("Failed to open GORM DB: %v", err)
+			}
+
+			mock.ExpectExec(tt.expected).WillReturnResult(sqlmock.NewResult(0, 0))
+			if tt.indexes {
+				mock.ExpectExec("CREATE INDEX").WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			err = db.Migrator().CreateTable(baselineImage(db))
+			assert.NoError(t, err)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+// Note: These tests require running MySQL and PostgreSQL instances. Set
+// ECHOPAN_TEST_MYSQL_DSN and ECHOPAN_TEST_POSTGRES_DSN to empty test databases,
+// every table is dropped at the end.
+func TestMigrate_Integration(t *testing.T) {
+	backends := map[DbType]string{
+		DbTypeMysql:    os.Getenv("ECHOPAN_TEST_MYSQL_DSN"),
+		DbTypePostgres: os.Getenv("ECHOPAN_TEST_POSTGRES_DSN"),
+	}
+	for dbType, dsn := range backends {
+		t.Run(string(dbType), func(t *testing.T) {
+			if dsn == "" {
+				t.Skipf("no DSN for %s; skipping migration integration test", dbType)
+			}
+			db := DbConnect(&DbParams{Type: dbType, DSN: dsn})
+
+			_, err := Migrate(db)
+			assert.NoError(t, err)
+			assert.NoError(t, db.Create(&models.Image{Url: "http://example.com/i.png", FullImage: []byte{0, 1, 2}}).Error)
+
+			_, err = Rollback(db, len(Migrations()))
+			assert.NoError(t, err)
+			assert.False(t, db.Migrator().HasTable("images"))
+		})
+	}
+}
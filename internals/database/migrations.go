@@ -0,0 +1,535 @@
+package database
+
+import (
+	"time"
+
+	"github.com/tutuna/echopan/internals/feedurl"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Every migration works on its own snapshot of the tables it touches, so that
+// later changes to internals/models never alter what an old migration does.
+// New migrations are appended with the next version number.
+var migrations = []Migration{
+	{Version: 1, Name: "baseline", Up: baselineUp, Down: baselineDown},
+	{Version: 2, Name: "items_feed_state_index", Up: itemsFeedStateIndexUp, Down: itemsFeedStateIndexDown},
+	{Version: 3, Name: "feeds_caption_template_schedule", Up: feedsCaptionScheduleUp, Down: feedsCaptionScheduleDown},
+	{Version: 4, Name: "items_last_error", Up: itemsLastErrorUp, Down: itemsLastErrorDown},
+	{Version: 5, Name: "feeds_fetch_health", Up: feedsFetchHealthUp, Down: feedsFetchHealthDown},
+	{Version: 6, Name: "feed_url_changes", Up: feedURLChangesUp, Down: feedURLChangesDown},
+	{Version: 7, Name: "feeds_url_identity", Up: feedsURLIdentityUp, Down: feedsURLIdentityDown},
+	{Version: 8, Name: "podcast_namespace", Up: podcastNamespaceUp, Down: podcastNamespaceDown},
+	{Version: 9, Name: "feeds_show_notes", Up: feedsShowNotesUp, Down: feedsShowNotesDown},
+	{Version: 10, Name: "feeds_filter_rules", Up: feedsFilterRulesUp, Down: feedsFilterRulesDown},
+	{Version: 11, Name: "feeds_caption_options", Up: feedsCaptionOptionsUp, Down: feedsCaptionOptionsDown},
+	{Version: 12, Name: "items_telegram_message", Up: itemsTelegramMessageUp, Down: itemsTelegramMessageDown},
+}
+
+type feedV1 struct {
+	gorm.Model
+	Title            string
+	Description      string
+	Link             string
+	Feed             string
+	PublishReady     bool `gorm:"default:false"`
+	TgChannel        int  `gorm:"default:0"`
+	Timeout          int  `gorm:"default:0"`
+	LastPubDate      *time.Time
+	ExtraLinkEnabled bool `gorm:"default:false"`
+	ExtraLink        string
+}
+
+func (feedV1) TableName() string { return "feeds" }
+
+type imageV1 struct {
+	gorm.Model
+	Url        string
+	Title      string
+	FeedId     int
+	FullImage  []byte `gorm:"type:bytea"`
+	SmallImage []byte `gorm:"type:bytea"`
+}
+
+func (imageV1) TableName() string { return "images" }
+
+// imageV1MySQL is imageV1 for MySQL, which has no bytea type
+type imageV1MySQL struct {
+	gorm.Model
+	Url        string
+	Title      string
+	FeedId     int
+	FullImage  []byte `gorm:"type:longblob"`
+	SmallImage []byte `gorm:"type:longblob"`
+}
+
+func (imageV1MySQL) TableName() string { return "images" }
+
+func baselineImage(tx *gorm.DB) interface{} {
+	if tx.Dialector.Name() == string(DbTypeMysql) {
+		return &imageV1MySQL{}
+	}
+	return &imageV1{}
+}
+
+type itemV1 struct {
+	gorm.Model
+	Title                   string
+	Description             string
+	Content                 string
+	Link                    string
+	Updated                 string
+	UpdatedParsed           *time.Time
+	Published               string
+	PublishedParsed         *time.Time `gorm:"index"`
+	TgPublished             int
+	FeedId                  int
+	ItunesAuthor            string
+	ItunesBlock             string
+	ItunesDuration          string
+	ItunesExplicit          string
+	ItunesKeywords          string
+	ItunesSubtitle          string
+	ItunesSummary           string
+	ItunesImage             string
+	ItunesIsClosedCaptioned string
+	ItunesEpisode           string
+	ItunesSeason            string
+	ItunesOrder             string
+	ItunesEpisodeType       string
+}
+
+func (itemV1) TableName() string { return "items" }
+
+type enclosureV1 struct {
+	gorm.Model
+	Url    string `gorm:"not null;size:2048"`
+	Length uint64 `gorm:"not null"`
+	Type   string `gorm:"size:255"`
+	ItemId uint   `gorm:"not null;index"`
+}
+
+func (enclosureV1) TableName() string { return "enclosures" }
+
+// baselineUp creates the schema previously maintained by AutoMigrate. On
+// databases created before migrations existed it only fills in what is missing.
+func baselineUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&feedV1{}, baselineImage(tx), &itemV1{}, &enclosureV1{})
+}
+
+func baselineDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&enclosureV1{}, &itemV1{}, baselineImage(tx), &feedV1{})
+}
+
+type itemV2 struct {
+	FeedId      int `gorm:"index:idx_items_feed_state,priority:1"`
+	TgPublished int `gorm:"index:idx_items_feed_state,priority:2"`
+}
+
+func (itemV2) TableName() string { return "items" }
+
+// itemsFeedStateIndexUp speeds up the per feed publishing queue lookups
+func itemsFeedStateIndexUp(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(&itemV2{}, "idx_items_feed_state") {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(&itemV2{}, "idx_items_feed_state")
+}
+
+func itemsFeedStateIndexDown(tx *gorm.DB) error {
+	return tx.Migrator().DropIndex(&itemV2{}, "idx_items_feed_state")
+}
+
+type feedV3 struct {
+	CaptionTemplate string
+	Schedule        string `gorm:"size:64"`
+}
+
+func (feedV3) TableName() string { return "feeds" }
+
+// feedsCaptionScheduleUp adds the per feed caption template and publishing
+// schedule managed by the sync command
+func feedsCaptionScheduleUp(tx *gorm.DB) error {
+	for _, column := range []string{"CaptionTemplate", "Schedule"} {
+		if tx.Migrator().HasColumn(&feedV3{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&feedV3{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func feedsCaptionScheduleDown(tx *gorm.DB) error {
+	for _, column := range []string{"schedule", "caption_template"} {
+		if err := dropColumn(tx, &feedV3{}, "feeds", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type itemV4 struct {
+	LastError string
+}
+
+func (itemV4) TableName() string { return "items" }
+
+// itemsLastErrorUp keeps the reason of failed publications
+func itemsLastErrorUp(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&itemV4{}, "LastError") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&itemV4{}, "LastError")
+}
+
+func itemsLastErrorDown(tx *gorm.DB) error {
+	return dropColumn(tx, &itemV4{}, "items", "last_error")
+}
+
+// dropColumn drops a column in place. On sqlite the gorm migrator recreates
+// the table instead, which loses its indexes.
+func dropColumn(tx *gorm.DB, model interface{}, table, column string) error {
+	if tx.Dialector.Name() != string(DbTypeSqlite) {
+		return tx.Migrator().DropColumn(model, column)
+	}
+	return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: column}).Error
+}
+
+type feedV5 struct {
+	LastFetchAt         *time.Time
+	LastSuccessAt       *time.Time
+	ConsecutiveFailures int `gorm:"default:0"`
+	LastStatus          int `gorm:"default:0"`
+	LastFetchError      string
+	Quarantined         bool `gorm:"default:false"`
+}
+
+func (feedV5) TableName() string { return "feeds" }
+
+var feedV5Columns = []string{"LastFetchAt", "LastSuccessAt", "ConsecutiveFailures", "LastStatus", "LastFetchError", "Quarantined"}
+
+// feedsFetchHealthUp records the outcome of feed fetches, used for the
+// backoff and quarantine of broken feeds
+func feedsFetchHealthUp(tx *gorm.DB) error {
+	for _, column := range feedV5Columns {
+		if tx.Migrator().HasColumn(&feedV5{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&feedV5{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func feedsFetchHealthDown(tx *gorm.DB) error {
+	for _, column := range []string{"last_fetch_at", "last_success_at", "consecutive_failures", "last_status", "last_fetch_error", "quarantined"} {
+		if err := dropColumn(tx, &feedV5{}, "feeds", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type feedURLChangeV6 struct {
+	gorm.Model
+	FeedId uint   `gorm:"not null;index"`
+	OldURL string `gorm:"size:2048"`
+	NewURL string `gorm:"size:2048"`
+	Reason string `gorm:"size:32"`
+}
+
+func (feedURLChangeV6) TableName() string { return "feed_url_changes" }
+
+// feedURLChangesUp keeps the history of the feed URLs, changed by hand or
+// followed after a move of the podcast
+func feedURLChangesUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&feedURLChangeV6{})
+}
+
+func feedURLChangesDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&feedURLChangeV6{})
+}
+
+type feedV7 struct {
+	ID          uint
+	Feed        string
+	URLKey      *string `gorm:"size:64;uniqueIndex:idx_feeds_url_key"`
+	PodcastGUID string  `gorm:"size:64;index"`
+}
+
+func (feedV7) TableName() string { return "feeds" }
+
+// feedsURLIdentityUp identifies feeds by their normalized URL instead of
+// their title. When several stored feeds share a URL, the oldest one keeps
+// the key and the others are left without one.
+func feedsURLIdentityUp(tx *gorm.DB) error {
+	for _, column := range []string{"URLKey", "PodcastGUID"} {
+		if tx.Migrator().HasColumn(&feedV7{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&feedV7{}, column); err != nil {
+			return err
+		}
+	}
+
+	var stored []feedV7
+	if err := tx.Order("id asc").Find(&stored).Error; err != nil {
+		return err
+	}
+	taken := map[string]bool{}
+	for _, feed := range stored {
+		if feed.URLKey != nil {
+			taken[*feed.URLKey] = true
+		}
+	}
+	for _, feed := range stored {
+		if feed.URLKey != nil || feed.Feed == "" {
+			continue
+		}
+		key := feedurl.Key(feed.Feed)
+		if taken[key] {
+			continue
+		}
+		taken[key] = true
+		if err := tx.Model(&feedV7{}).Where("id = ?", feed.ID).Update("url_key", key).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, index := range []string{"idx_feeds_url_key", "idx_feeds_podcast_guid"} {
+		if tx.Migrator().HasIndex(&feedV7{}, index) {
+			continue
+		}
+		if err := tx.Migrator().CreateIndex(&feedV7{}, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func feedsURLIdentityDown(tx *gorm.DB) error {
+	for _, index := range []string{"idx_feeds_url_key", "idx_feeds_podcast_guid"} {
+		if !tx.Migrator().HasIndex(&feedV7{}, index) {
+			continue
+		}
+		if err := tx.Migrator().DropIndex(&feedV7{}, index); err != nil {
+			return err
+		}
+	}
+	for _, column := range []string{"url_key", "podcast_guid"} {
+		if err := dropColumn(tx, &feedV7{}, "feeds", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type itemV8 struct {
+	ChaptersURL    string `gorm:"size:2048"`
+	ChaptersType   string `gorm:"size:255"`
+	PodcastSeason  string
+	PodcastEpisode string
+}
+
+func (itemV8) TableName() string { return "items" }
+
+type transcriptV8 struct {
+	gorm.Model
+	ItemId   uint   `gorm:"not null;index"`
+	Url      string `gorm:"not null;size:2048"`
+	Type     string `gorm:"size:255"`
+	Language string `gorm:"size:64"`
+	Rel      string `gorm:"size:32"`
+}
+
+func (transcriptV8) TableName() string { return "transcripts" }
+
+type personV8 struct {
+	gorm.Model
+	ItemId uint   `gorm:"not null;index"`
+	Name   string `gorm:"not null"`
+	Role   string `gorm:"size:64"`
+	Group  string `gorm:"size:64"`
+	Href   string `gorm:"size:2048"`
+	Img    string `gorm:"size:2048"`
+}
+
+func (personV8) TableName() string { return "people" }
+
+type fundingV8 struct {
+	gorm.Model
+	FeedId uint   `gorm:"not null;index"`
+	Url    string `gorm:"not null;size:2048"`
+	Text   string
+}
+
+func (fundingV8) TableName() string { return "fundings" }
+
+// podcastNamespaceUp stores the podcast namespace of items and feeds:
+// chapters, season and episode on the items, transcripts and persons of the
+// items and funding links of the feeds
+func podcastNamespaceUp(tx *gorm.DB) error {
+	for _, column := range []string{"ChaptersURL", "ChaptersType", "PodcastSeason", "PodcastEpisode"} {
+		if tx.Migrator().HasColumn(&itemV8{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&itemV8{}, column); err != nil {
+			return err
+		}
+	}
+	return tx.AutoMigrate(&transcriptV8{}, &personV8{}, &fundingV8{})
+}
+
+func podcastNamespaceDown(tx *gorm.DB) error {
+	if err := tx.Migrator().DropTable(&transcriptV8{}, &personV8{}, &fundingV8{}); err != nil {
+		return err
+	}
+	for _, column := range []string{"chapters_url", "chapters_type", "podcast_season", "podcast_episode"} {
+		if err := dropColumn(tx, &itemV8{}, "items", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type feedV9 struct {
+	ShowNotes string `gorm:"size:16"`
+}
+
+func (feedV9) TableName() string { return "feeds" }
+
+// feedsShowNotesUp lets feeds post their full show notes
+func feedsShowNotesUp(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&feedV9{}, "ShowNotes") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&feedV9{}, "ShowNotes")
+}
+
+func feedsShowNotesDown(tx *gorm.DB) error {
+	return dropColumn(tx, &feedV9{}, "feeds", "show_notes")
+}
+
+type feedV10 struct {
+	FilterInclude      string
+	FilterExclude      string
+	FilterEpisodeTypes string
+	FilterExplicit     bool   `gorm:"default:false"`
+	FilterMinDuration  string `gorm:"size:64"`
+	FilterMaxDuration  string `gorm:"size:64"`
+}
+
+func (feedV10) TableName() string { return "feeds" }
+
+type itemV10 struct {
+	SkipReason string
+}
+
+func (itemV10) TableName() string { return "items" }
+
+var feedV10Columns = []string{"FilterInclude", "FilterExclude", "FilterEpisodeTypes", "FilterExplicit", "FilterMinDuration", "FilterMaxDuration"}
+
+// feedsFilterRulesUp adds the filter rules of the feeds and the reason
+// recorded on the items they skip
+func feedsFilterRulesUp(tx *gorm.DB) error {
+	for _, column := range feedV10Columns {
+		if tx.Migrator().HasColumn(&feedV10{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&feedV10{}, column); err != nil {
+			return err
+		}
+	}
+	if tx.Migrator().HasColumn(&itemV10{}, "SkipReason") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&itemV10{}, "SkipReason")
+}
+
+func feedsFilterRulesDown(tx *gorm.DB) error {
+	if err := dropColumn(tx, &itemV10{}, "items", "skip_reason"); err != nil {
+		return err
+	}
+	for _, column := range []string{"filter_include", "filter_exclude", "filter_episode_types", "filter_explicit", "filter_min_duration", "filter_max_duration"} {
+		if err := dropColumn(tx, &feedV10{}, "feeds", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type feedV11 struct {
+	CaptionHideSubtitle bool   `gorm:"default:false"`
+	CaptionSource       string `gorm:"size:16"`
+	CaptionMaxLength    int    `gorm:"default:0"`
+	CaptionStripLinks   bool   `gorm:"default:false"`
+	CaptionNumbers      bool   `gorm:"default:false"`
+}
+
+func (feedV11) TableName() string { return "feeds" }
+
+var feedV11Columns = []string{"CaptionHideSubtitle", "CaptionSource", "CaptionMaxLength", "CaptionStripLinks", "CaptionNumbers"}
+
+// feedsCaptionOptionsUp adds the caption options of the feeds. Feed 34 had
+// its subtitle left out by the publisher, it keeps that as an option.
+func feedsCaptionOptionsUp(tx *gorm.DB) error {
+	for _, column := range feedV11Columns {
+		if tx.Migrator().HasColumn(&feedV11{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&feedV11{}, column); err != nil {
+			return err
+		}
+	}
+	return tx.Table("feeds").Where("id = ?", 34).Update("caption_hide_subtitle", true).Error
+}
+
+func feedsCaptionOptionsDown(tx *gorm.DB) error {
+	for _, column := range []string{"caption_hide_subtitle", "caption_source", "caption_max_length", "caption_strip_links", "caption_numbers"} {
+		if err := dropColumn(tx, &feedV11{}, "feeds", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type itemV12 struct {
+	TgMessageId   int        `gorm:"default:0"`
+	TgPublishedAt *time.Time `gorm:"index"`
+}
+
+func (itemV12) TableName() string { return "items" }
+
+// itemsTelegramMessageUp keeps the Telegram message and the time of every
+// publication, for the links of the dashboard
+func itemsTelegramMessageUp(tx *gorm.DB) error {
+	for _, column := range []string{"TgMessageId", "TgPublishedAt"} {
+		if tx.Migrator().HasColumn(&itemV12{}, column) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(&itemV12{}, column); err != nil {
+			return err
+		}
+	}
+	if tx.Migrator().HasIndex(&itemV12{}, "TgPublishedAt") {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(&itemV12{}, "TgPublishedAt")
+}
+
+func itemsTelegramMessageDown(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(&itemV12{}, "TgPublishedAt") {
+		if err := tx.Migrator().DropIndex(&itemV12{}, "TgPublishedAt"); err != nil {
+			return err
+		}
+	}
+	for _, column := range []string{"tg_message_id", "tg_published_at"} {
+		if err := dropColumn(tx, &itemV12{}, "items", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
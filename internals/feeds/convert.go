@@ -0,0 +1,82 @@
+package feeds
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+// ParseLength reads an enclosure length attribute. Publishers leave it
+// empty, put 0 as a placeholder or write it as a float; ok is false when
+// the attribute does not carry a usable size.
+func ParseLength(raw string) (length uint64, ok bool) {
+	raw = strings.TrimSpace(raw)
+	if n, err := strconv.ParseUint(raw, 10, 64); err == nil {
+		return n, n > 0
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f < 1 || f > math.MaxUint64 || math.IsNaN(f) {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
+// NewFeed converts a fetched feed into a feed stored under feedURL
+func NewFeed(v *gofeed.Feed, feedURL string) models.Feed {
+	return models.Feed{
+		Title:       v.Title,
+		Description: v.Description,
+		Link:        v.Link,
+		Feed:        feedURL,
+		PodcastGUID: PodcastGUID(v),
+	}
+}
+
+// NewItem converts a fetched item into a pending item of the feed with its
+// enclosures. Enclosures without a usable length get a length of 0, see
+// items.IngestReport.Unsized.
+func NewItem(v *gofeed.Item, feedID int) models.Item {
+	item := models.Item{
+		Title:           v.Title,
+		Description:     v.Description,
+		Content:         v.Content,
+		Link:            v.Link,
+		Updated:         v.Updated,
+		UpdatedParsed:   v.UpdatedParsed,
+		Published:       v.Published,
+		PublishedParsed: v.PublishedParsed,
+		FeedId:          feedID,
+		TgPublished:     models.ItemPending,
+	}
+	if v.ITunesExt != nil {
+		item.ItunesAuthor = v.ITunesExt.Author
+		item.ItunesBlock = v.ITunesExt.Block
+		item.ItunesDuration = v.ITunesExt.Duration
+		item.ItunesExplicit = v.ITunesExt.Explicit
+		item.ItunesKeywords = v.ITunesExt.Keywords
+		item.ItunesSubtitle = v.ITunesExt.Subtitle
+		item.ItunesSummary = v.ITunesExt.Summary
+		item.ItunesImage = v.ITunesExt.Image
+		item.ItunesIsClosedCaptioned = v.ITunesExt.IsClosedCaptioned
+		item.ItunesEpisode = v.ITunesExt.Episode
+		item.ItunesSeason = v.ITunesExt.Season
+		item.ItunesOrder = v.ITunesExt.Order
+		item.ItunesEpisodeType = v.ITunesExt.EpisodeType
+	}
+	applyPodcast(&item, v)
+	for _, enc := range v.Enclosures {
+		if enc == nil || strings.TrimSpace(enc.URL) == "" {
+			continue
+		}
+		length, _ := ParseLength(enc.Length)
+		item.Enclosures = append(item.Enclosures, models.Enclosure{
+			Url:    strings.TrimSpace(enc.URL),
+			Length: length,
+			Type:   enc.Type,
+		})
+	}
+	return item
+}
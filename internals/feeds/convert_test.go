@@ -0,0 +1,94 @@
+package feeds
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+func TestParseLength(t *testing.T) {
+	for raw, want := range map[string]uint64{"1234": 1234, " 42 ": 42, "1.5e3": 1500} {
+		length, ok := ParseLength(raw)
+		assert.True(t, ok, raw)
+		assert.Equal(t, want, length, raw)
+	}
+	for _, raw := range []string{"", "0", "-1", "unknown", "NaN"} {
+		_, ok := ParseLength(raw)
+		assert.False(t, ok, raw)
+	}
+}
+
+func TestNewItem(t *testing.T) {
+	v := &gofeed.Item{
+		Title:     "Episode",
+		ITunesExt: &ext.ITunesItemExtension{Subtitle: "Sub", Duration: "10:00"},
+		Enclosures: []*gofeed.Enclosure{
+			{URL: "http://example.com/sized.mp3", Length: "20", Type: "audio/mpeg"},
+			{URL: "http://example.com/unsized.mp3", Length: "", Type: "audio/mpeg"},
+			{URL: " ", Length: "20"},
+		},
+	}
+	item := NewItem(v, 3)
+
+	assert.Equal(t, "Episode", item.Title)
+	assert.Equal(t, 3, item.FeedId)
+	assert.Equal(t, models.ItemPending, item.TgPublished)
+	assert.Equal(t, "Sub", item.ItunesSubtitle)
+	if assert.Len(t, item.Enclosures, 2) {
+		assert.Equal(t, uint64(20), item.Enclosures[0].Length)
+		assert.Equal(t, uint64(0), item.Enclosures[1].Length)
+	}
+}
+
+func TestNewFeed(t *testing.T) {
+	parsed, err := gofeed.NewParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:podcast="https://podcastindex.org/namespace/1.0"><channel>
+<title>Podcast</title><link>https://example.com</link><description>About</description>
+<podcast:guid> ead4c236-bf58-58c6-a2c6-a6b28d128cb6 </podcast:guid>
+</channel></rss>`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	feed := NewFeed(parsed, "https://example.com/rss")
+	assert.Equal(t, "Podcast", feed.Title)
+	assert.Equal(t, "https://example.com", feed.Link)
+	assert.Equal(t, "https://example.com/rss", feed.Feed)
+	assert.Equal(t, "ead4c236-bf58-58c6-a2c6-a6b28d128cb6", feed.PodcastGUID)
+
+	assert.Empty(t, PodcastGUID(&gofeed.Feed{}))
+}
+
+func TestNewItem_PodcastNamespace(t *testing.T) {
+	parsed, err := gofeed.NewParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:podcast="https://podcastindex.org/namespace/1.0"><channel>
+<title>Podcast</title>
+<podcast:funding url="https://example.com/donate">Support the show</podcast:funding>
+<podcast:funding url=" "></podcast:funding>
+<item><title>Episode</title>
+<podcast:chapters url="https://example.com/e1.json" type="application/json+chapters"/>
+<podcast:season name="Origins">2</podcast:season>
+<podcast:episode display="Ch.3">3</podcast:episode>
+<podcast:transcript url="https://example.com/e1.vtt" type="text/vtt" language="en" rel="captions"/>
+<podcast:person href="https://example.com/jane">Jane Host</podcast:person>
+<podcast:person role="Guest" img="https://example.com/joe.jpg">Joe Guest</podcast:person>
+</item></channel></rss>`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []models.Funding{{Url: "https://example.com/donate", Text: "Support the show"}}, NewFunding(parsed))
+
+	item := NewItem(parsed.Items[0], 1)
+	assert.Equal(t, "https://example.com/e1.json", item.ChaptersURL)
+	assert.Equal(t, "application/json+chapters", item.ChaptersType)
+	assert.Equal(t, "2", item.PodcastSeason)
+	assert.Equal(t, "3", item.PodcastEpisode)
+	assert.Equal(t, []models.Transcript{{Url: "https://example.com/e1.vtt", Type: "text/vtt", Language: "en", Rel: "captions"}}, item.Transcripts)
+	assert.Equal(t, []models.Person{
+		{Name: "Jane Host", Role: "host", Group: "cast", Href: "https://example.com/jane"},
+		{Name: "Joe Guest", Role: "guest", Group: "cast", Img: "https://example.com/joe.jpg"},
+	}, item.Persons)
+}
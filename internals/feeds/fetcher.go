@@ -0,0 +1,267 @@
+package feeds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	"github.com/tutuna/echopan/internals/feedurl"
+)
+
+// DefaultMaxPages bounds how many RFC 5005 pages are followed for a single feed
+const DefaultMaxPages = 100
+
+// FetchOptions controls how much of a feed is walked
+type FetchOptions struct {
+	// MaxItems caps the number of collected items, 0 means no cap
+	MaxItems int
+	// MaxPages caps the number of followed pages, 0 means DefaultMaxPages
+	MaxPages int
+	// Known reports whether an item is already stored. Known items are not
+	// collected and no further pages are fetched once a page contains one.
+	Known func(item *gofeed.Item) bool
+}
+
+// Reasons of a feed URL change
+const (
+	MoveRedirect   = "redirect"
+	MoveNewFeedURL = "new-feed-url"
+	MoveManual     = "manual"
+)
+
+// FetchResult holds the first page of the feed and every collected item
+type FetchResult struct {
+	Feed  *gofeed.Feed
+	Items []*gofeed.Item
+	Pages int
+	// MovedTo is the new location of the feed when it answered with a
+	// permanent redirect or announced one with itunes:new-feed-url
+	MovedTo string
+	// MovedBy is MoveRedirect or MoveNewFeedURL
+	MovedBy string
+}
+
+// Fetcher downloads and parses feeds, following RFC 5005 paged and archived feeds
+type Fetcher struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+// NewFetcher creates a fetcher with a default HTTP client
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:    &http.Client{Timeout: time.Minute},
+		UserAgent: "echopan",
+	}
+}
+
+// Fetch walks the feed at feedURL and returns its items, newest pages first
+func (f *Fetcher) Fetch(feedURL string, opts FetchOptions) (*FetchResult, error) {
+	maxPages := opts.MaxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	result := &FetchResult{}
+	visited := map[string]bool{}
+	queue := []string{feedURL}
+	for len(queue) > 0 && result.Pages < maxPages {
+		pageURL := queue[0]
+		queue = queue[1:]
+		if visited[pageURL] {
+			continue
+		}
+		visited[pageURL] = true
+
+		body, movedTo, err := f.get(pageURL)
+		if err != nil {
+			if result.Feed == nil {
+				return nil, err
+			}
+			// Later pages are best effort, keep what was already collected
+			break
+		}
+		feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+		if err != nil {
+			if result.Feed == nil {
+				return nil, err
+			}
+			break
+		}
+		if result.Feed == nil {
+			result.Feed = feed
+			result.MovedTo, result.MovedBy = movedLocation(pageURL, movedTo, feed)
+		}
+		result.Pages++
+
+		hitKnown := false
+		for _, item := range feed.Items {
+			if opts.Known != nil && opts.Known(item) {
+				hitKnown = true
+				continue
+			}
+			result.Items = append(result.Items, item)
+			if opts.MaxItems > 0 && len(result.Items) >= opts.MaxItems {
+				return result, nil
+			}
+		}
+		if hitKnown {
+			break
+		}
+
+		for _, link := range pagingLinks(feed, body) {
+			next, err := resolveURL(pageURL, link)
+			if err != nil || visited[next] {
+				continue
+			}
+			queue = append(queue, next)
+		}
+	}
+	return result, nil
+}
+
+// get downloads a page. When every redirect followed on the way was
+// permanent it also returns the final URL.
+func (f *Fetcher) get(pageURL string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	client := http.DefaultClient
+	if f.Client != nil {
+		client = f.Client
+	}
+	redirected, permanent := false, true
+	tracking := *client
+	tracking.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		redirected = true
+		if req.Response == nil || !isPermanentRedirect(req.Response.StatusCode) {
+			permanent = false
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	resp, err := tracking.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	movedTo := ""
+	if redirected && permanent {
+		movedTo = resp.Request.URL.String()
+	}
+	return body, movedTo, nil
+}
+
+func isPermanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// movedLocation picks the new location of a feed: the itunes:new-feed-url
+// announced by the feed first, then the target of a permanent redirect. URLs
+// differing only in form are the same feed.
+func movedLocation(feedURL, redirectedTo string, feed *gofeed.Feed) (string, string) {
+	if feed.ITunesExt != nil && feed.ITunesExt.NewFeedURL != "" {
+		newURL, err := resolveURL(feedURL, strings.TrimSpace(feed.ITunesExt.NewFeedURL))
+		if err == nil && !feedurl.Same(newURL, feedURL) && (redirectedTo == "" || !feedurl.Same(newURL, redirectedTo)) {
+			return newURL, MoveNewFeedURL
+		}
+	}
+	if redirectedTo != "" && !feedurl.Same(redirectedTo, feedURL) {
+		return redirectedTo, MoveRedirect
+	}
+	return "", ""
+}
+
+// pagingLinks returns the RFC 5005 "next" and "prev-archive" links of a feed document
+func pagingLinks(feed *gofeed.Feed, body []byte) []string {
+	var links []string
+	switch feed.FeedType {
+	case "rss":
+		for _, ns := range []string{"atom", "atom10"} {
+			for _, l := range feed.Extensions[ns]["link"] {
+				if isPagingRel(l.Attrs["rel"]) && l.Attrs["href"] != "" {
+					links = append(links, l.Attrs["href"])
+				}
+			}
+		}
+	case "atom":
+		af, err := (&atom.Parser{}).Parse(bytes.NewReader(body))
+		if err != nil {
+			return nil
+		}
+		for _, l := range af.Links {
+			if isPagingRel(l.Rel) && l.Href != "" {
+				links = append(links, l.Href)
+			}
+		}
+	}
+	return links
+}
+
+func isPagingRel(rel string) bool {
+	return rel == "next" || rel == "prev-archive"
+}
+
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	resolved := b.ResolveReference(r)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", fmt.Errorf("unsupported page url: %s", resolved)
+	}
+	return resolved.String(), nil
+}
+
+// ContentLength asks the server for the size of the file at fileURL with a
+// HEAD request, it returns 0 when the size is unknown
+func (f *Fetcher) ContentLength(fileURL string) uint64 {
+	req, err := http.NewRequest(http.MethodHead, fileURL, nil)
+	if err != nil {
+		return 0
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.ContentLength < 0 {
+		return 0
+	}
+	return uint64(resp.ContentLength)
+}
@@ -0,0 +1,211 @@
+package feeds
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func rssPage(next string, titles ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><title>Paged</title>`)
+	if next != "" {
+		fmt.Fprintf(&b, `<atom:link rel="next" href="%s"/>`, next)
+	}
+	for _, t := range titles {
+		fmt.Fprintf(&b, `<item><title>%s</title></item>`, t)
+	}
+	b.WriteString(`</channel></rss>`)
+	return b.String()
+}
+
+func newPagedServer(pages map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+}
+
+func titlesOf(items []*gofeed.Item) []string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+func TestFetch_FewerItemsThanOldWindow(t *testing.T) {
+	srv := newPagedServer(map[string]string{"/feed": rssPage("", "Episode 2", "Episode 1")})
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Paged", result.Feed.Title)
+	assert.Equal(t, []string{"Episode 2", "Episode 1"}, titlesOf(result.Items))
+	assert.Equal(t, 1, result.Pages)
+}
+
+func TestFetch_FollowsNextPages(t *testing.T) {
+	srv := newPagedServer(map[string]string{
+		"/feed":   rssPage("/feed/2", "Episode 4", "Episode 3"),
+		"/feed/2": rssPage("/feed/3", "Episode 2"),
+		"/feed/3": rssPage("/feed", "Episode 1"),
+	})
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Episode 4", "Episode 3", "Episode 2", "Episode 1"}, titlesOf(result.Items))
+	assert.Equal(t, 3, result.Pages, "the loop back to the first page must not be followed")
+}
+
+func TestFetch_FollowsAtomPrevArchive(t *testing.T) {
+	srv := newPagedServer(map[string]string{
+		"/feed": `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Archived</title>
+<link rel="prev-archive" href="/archive/1"/><entry><title>Current</title></entry></feed>`,
+		"/archive/1": `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Archived</title>
+<link rel="next-archive" href="/feed"/><entry><title>Archived</title></entry></feed>`,
+	})
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Current", "Archived"}, titlesOf(result.Items))
+}
+
+func TestFetch_StopsAtKnownItems(t *testing.T) {
+	srv := newPagedServer(map[string]string{
+		"/feed":   rssPage("/feed/2", "Episode 4", "Episode 3"),
+		"/feed/2": rssPage("", "Episode 2", "Episode 1"),
+	})
+	defer srv.Close()
+
+	known := func(item *gofeed.Item) bool { return item.Title == "Episode 3" }
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{Known: known})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Episode 4"}, titlesOf(result.Items))
+	assert.Equal(t, 1, result.Pages)
+}
+
+func TestFetch_MaxItems(t *testing.T) {
+	srv := newPagedServer(map[string]string{
+		"/feed":   rssPage("/feed/2", "Episode 4", "Episode 3"),
+		"/feed/2": rssPage("", "Episode 2", "Episode 1"),
+	})
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{MaxItems: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Episode 4", "Episode 3", "Episode 2"}, titlesOf(result.Items))
+}
+
+func TestFetch_BrokenLaterPageKeepsCollectedItems(t *testing.T) {
+	srv := newPagedServer(map[string]string{"/feed": rssPage("/missing", "Episode 1")})
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Episode 1"}, titlesOf(result.Items))
+}
+
+func TestFetch_PermanentRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/moved", http.StatusMovedPermanently))
+	mux.Handle("/moved", http.RedirectHandler("/new", http.StatusPermanentRedirect))
+	mux.Handle("/temporary", http.RedirectHandler("/new", http.StatusFound))
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, rssPage("", "Episode 1"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/old", FetchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Episode 1"}, titlesOf(result.Items))
+	assert.Equal(t, srv.URL+"/new", result.MovedTo)
+	assert.Equal(t, MoveRedirect, result.MovedBy)
+
+	result, err = NewFetcher().Fetch(srv.URL+"/temporary", FetchOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.MovedTo, "temporary redirects are not followed")
+}
+
+func TestFetch_NewFeedURL(t *testing.T) {
+	srv := newPagedServer(map[string]string{
+		"/feed": `<?xml version="1.0"?><rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel>
+<title>Moving</title><itunes:new-feed-url>https://new.example.com/feed.xml</itunes:new-feed-url>
+<item><title>Episode 1</title></item></channel></rss>`,
+	})
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://new.example.com/feed.xml", result.MovedTo)
+	assert.Equal(t, MoveNewFeedURL, result.MovedBy)
+}
+
+func TestMovedLocation_SameFeed(t *testing.T) {
+	feed := &gofeed.Feed{ITunesExt: &ext.ITunesFeedExtension{NewFeedURL: "HTTPS://Example.com:443/feed"}}
+	movedTo, movedBy := movedLocation("https://example.com/feed", "", feed)
+	assert.Empty(t, movedTo, "a new-feed-url differing only in form is not a move")
+	assert.Empty(t, movedBy)
+
+	feed.ITunesExt.NewFeedURL = "https://example.com/other"
+	movedTo, movedBy = movedLocation("https://example.com/feed", "", feed)
+	assert.Equal(t, "https://example.com/other", movedTo)
+	assert.Equal(t, MoveNewFeedURL, movedBy)
+}
+
+func TestFetch_HTTPError(t *testing.T) {
+	srv := newPagedServer(map[string]string{})
+	defer srv.Close()
+
+	result, err := NewFetcher().Fetch(srv.URL+"/feed", FetchOptions{})
+	assert.Error(t, err)
+	assert.Nil(t, result)
+}
+
+func TestKnownItem(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Item{})
+	db.Create(&models.Item{Title: "Stored", FeedId: 1})
+
+	known := KnownItem(db, models.Feed{Model: gorm.Model{ID: 1}})
+	assert.True(t, known(&gofeed.Item{Title: "Stored"}))
+	assert.False(t, known(&gofeed.Item{Title: "New"}))
+
+	other := KnownItem(db, models.Feed{Model: gorm.Model{ID: 2}})
+	assert.False(t, other(&gofeed.Item{Title: "Stored"}))
+}
+
+func TestContentLength(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path == "/missing.mp3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "1234")
+	}))
+	defer srv.Close()
+
+	f := NewFetcher()
+	assert.Equal(t, uint64(1234), f.ContentLength(srv.URL+"/episode.mp3"))
+	assert.Equal(t, uint64(0), f.ContentLength(srv.URL+"/missing.mp3"))
+	assert.Equal(t, uint64(0), f.ContentLength("://bad"))
+}
@@ -0,0 +1,146 @@
+package feeds
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tutuna/echopan/internals/models"
+)
+
+// Rules are the filter rules of a feed. Items they reject are skipped
+// instead of published, with the rule as the reason.
+type Rules struct {
+	// Include keeps only the items whose title or description matches
+	Include *regexp.Regexp
+	// Exclude skips the items whose title or description matches
+	Exclude *regexp.Regexp
+	// EpisodeTypes lists the itunes:episodeType values to skip, e.g. trailer
+	EpisodeTypes []string
+	Explicit     bool
+	// MinDuration and MaxDuration bound the itunes:duration, 0 means no bound.
+	// Items without a readable duration are kept.
+	MinDuration time.Duration
+	MaxDuration time.Duration
+}
+
+// ParseRules reads the filter rules stored on the feed
+func ParseRules(feed models.Feed) (Rules, error) {
+	rules := Rules{Explicit: feed.FilterExplicit}
+	var err error
+	if rules.Include, err = compileRule("include", feed.FilterInclude); err != nil {
+		return Rules{}, err
+	}
+	if rules.Exclude, err = compileRule("exclude", feed.FilterExclude); err != nil {
+		return Rules{}, err
+	}
+	for _, t := range strings.Split(feed.FilterEpisodeTypes, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			rules.EpisodeTypes = append(rules.EpisodeTypes, t)
+		}
+	}
+	if rules.MinDuration, err = parseBound("min duration", feed.FilterMinDuration); err != nil {
+		return Rules{}, err
+	}
+	if rules.MaxDuration, err = parseBound("max duration", feed.FilterMaxDuration); err != nil {
+		return Rules{}, err
+	}
+	if rules.MaxDuration > 0 && rules.MinDuration > rules.MaxDuration {
+		return Rules{}, fmt.Errorf("min duration %s is over max duration %s", rules.MinDuration, rules.MaxDuration)
+	}
+	return rules, nil
+}
+
+func compileRule(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s rule %q: %w", name, expr, err)
+	}
+	return re, nil
+}
+
+func parseBound(name, bound string) (time.Duration, error) {
+	if bound == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(bound)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration such as 5m", name, bound)
+	}
+	return d, nil
+}
+
+// Skip returns the rule rejecting the item, empty when the item is kept
+func (r Rules) Skip(item models.Item) string {
+	text := item.Title + "\n" + item.Description
+	if r.Include != nil && !r.Include.MatchString(text) {
+		return fmt.Sprintf("does not match include rule %q", r.Include)
+	}
+	if r.Exclude != nil && r.Exclude.MatchString(text) {
+		return fmt.Sprintf("matches exclude rule %q", r.Exclude)
+	}
+	episodeType := strings.ToLower(strings.TrimSpace(item.ItunesEpisodeType))
+	for _, t := range r.EpisodeTypes {
+		if t == episodeType {
+			return fmt.Sprintf("episode type %s", t)
+		}
+	}
+	if r.Explicit && Explicit(item) {
+		return "explicit"
+	}
+	if r.MinDuration == 0 && r.MaxDuration == 0 {
+		return ""
+	}
+	d, ok := ParseItunesDuration(item.ItunesDuration)
+	switch {
+	case !ok:
+		return ""
+	case d < r.MinDuration:
+		return fmt.Sprintf("duration %s under min duration %s", d, r.MinDuration)
+	case r.MaxDuration > 0 && d > r.MaxDuration:
+		return fmt.Sprintf("duration %s over max duration %s", d, r.MaxDuration)
+	}
+	return ""
+}
+
+// Explicit reports whether the item is marked itunes:explicit
+func Explicit(item models.Item) bool {
+	switch strings.ToLower(strings.TrimSpace(item.ItunesExplicit)) {
+	case "yes", "true", "explicit":
+		return true
+	}
+	return false
+}
+
+// Blocked reports whether the item is marked itunes:block, which only
+// the value yes sets. Blocked items are never published.
+func Blocked(item models.Item) bool {
+	return strings.EqualFold(strings.TrimSpace(item.ItunesBlock), "yes")
+}
+
+// ParseItunesDuration reads an itunes:duration, given in seconds or as
+// [[HH:]MM:]SS
+func ParseItunesDuration(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	var total float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 || (i < len(parts)-1 && v != float64(int(v))) {
+			return 0, false
+		}
+		total = total*60 + v
+	}
+	return time.Duration(total * float64(time.Second)), true
+}
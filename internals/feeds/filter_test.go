@@ -0,0 +1,70 @@
+package feeds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(models.Feed{FilterEpisodeTypes: " Trailer, bonus,", FilterMinDuration: "5m"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"trailer", "bonus"}, rules.EpisodeTypes)
+	assert.Equal(t, 5*time.Minute, rules.MinDuration)
+
+	_, err = ParseRules(models.Feed{FilterInclude: "("})
+	assert.ErrorContains(t, err, "invalid include rule")
+	_, err = ParseRules(models.Feed{FilterMaxDuration: "long"})
+	assert.ErrorContains(t, err, "invalid max duration")
+	_, err = ParseRules(models.Feed{FilterMinDuration: "1h", FilterMaxDuration: "30m"})
+	assert.Error(t, err)
+}
+
+func TestRulesSkip(t *testing.T) {
+	rules, err := ParseRules(models.Feed{
+		FilterInclude:      "(?i)episode",
+		FilterExclude:      `(?i)\brerun\b`,
+		FilterEpisodeTypes: "trailer",
+		FilterExplicit:     true,
+		FilterMinDuration:  "5m",
+		FilterMaxDuration:  "2h",
+	})
+	assert.NoError(t, err)
+
+	assert.Empty(t, rules.Skip(models.Item{Title: "Episode 1", ItunesDuration: "45:00"}))
+	assert.Empty(t, rules.Skip(models.Item{Title: "Pilot", Description: "The first episode"}), "the description matches too")
+	assert.Empty(t, rules.Skip(models.Item{Title: "Episode 2", ItunesDuration: "soon"}), "unreadable durations are kept")
+	assert.Equal(t, `does not match include rule "(?i)episode"`, rules.Skip(models.Item{Title: "Announcement"}))
+	assert.Equal(t, `matches exclude rule "(?i)\\brerun\\b"`, rules.Skip(models.Item{Title: "Episode 1 (Rerun)"}))
+	assert.Equal(t, "episode type trailer", rules.Skip(models.Item{Title: "Episode 0", ItunesEpisodeType: "Trailer"}))
+	assert.Equal(t, "explicit", rules.Skip(models.Item{Title: "Episode 3", ItunesExplicit: "true"}))
+	assert.Equal(t, "duration 1m30s under min duration 5m0s", rules.Skip(models.Item{Title: "Episode 5", ItunesDuration: "90"}))
+	assert.Equal(t, "duration 3h0m0s over max duration 2h0m0s", rules.Skip(models.Item{Title: "Episode 6", ItunesDuration: "3:00:00"}))
+
+	assert.Empty(t, Rules{}.Skip(models.Item{ItunesEpisodeType: "trailer", ItunesExplicit: "yes"}))
+}
+
+func TestBlocked(t *testing.T) {
+	assert.True(t, Blocked(models.Item{ItunesBlock: "Yes"}))
+	assert.False(t, Blocked(models.Item{ItunesBlock: "no"}))
+	assert.False(t, Blocked(models.Item{}))
+}
+
+func TestParseItunesDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"3600":     time.Hour,
+		"90.5":     90*time.Second + 500*time.Millisecond,
+		"45:07":    45*time.Minute + 7*time.Second,
+		"01:02:03": time.Hour + 2*time.Minute + 3*time.Second,
+	} {
+		got, ok := ParseItunesDuration(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "soon", "1:2:3:4", "-5", "1.5:00"} {
+		_, ok := ParseItunesDuration(in)
+		assert.False(t, ok, in)
+	}
+}
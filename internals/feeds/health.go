@@ -0,0 +1,161 @@
+package feeds
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+// HealthPolicy decides when failing feeds are fetched again
+type HealthPolicy struct {
+	// Backoff is the wait after the first failure, it doubles with every
+	// following one
+	Backoff time.Duration
+	// MaxBackoff caps the wait, 0 means no cap
+	MaxBackoff time.Duration
+	// QuarantineAfter is the number of consecutive failures after which the
+	// feed is no longer fetched, 0 never quarantines
+	QuarantineAfter int
+}
+
+// Wait returns the backoff after the given number of consecutive failures
+func (p HealthPolicy) Wait(failures int) time.Duration {
+	if failures <= 0 || p.Backoff <= 0 {
+		return 0
+	}
+	wait := p.Backoff
+	for i := 1; i < failures; i++ {
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			break
+		}
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return wait
+}
+
+// ShouldFetch reports whether the feed may be fetched at now. Quarantined
+// feeds are never fetched, failing ones wait for their backoff.
+func (p HealthPolicy) ShouldFetch(feed models.Feed, now time.Time) bool {
+	if feed.Quarantined {
+		return false
+	}
+	if feed.ConsecutiveFailures == 0 || feed.LastFetchAt == nil {
+		return true
+	}
+	return !now.Before(feed.LastFetchAt.Add(p.Wait(feed.ConsecutiveFailures)))
+}
+
+// FetchStatus returns the HTTP status of a fetch: 200 on success, the status
+// of HTTP errors and 0 when no response was received
+func FetchStatus(err error) int {
+	if err == nil {
+		return 200
+	}
+	var httpErr gofeed.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+	return 0
+}
+
+// RecordFetch stores the outcome of a fetch made at now and quarantines the
+// feed once it failed too many times in a row. It returns the updated feed.
+func RecordFetch(db *gorm.DB, id uint, fetchErr error, now time.Time, policy HealthPolicy) (models.Feed, error) {
+	feed, err := GetFeed(db, id)
+	if err != nil {
+		return models.Feed{}, err
+	}
+
+	fields := map[string]interface{}{
+		"last_fetch_at": now,
+		"last_status":   FetchStatus(fetchErr),
+	}
+	if fetchErr == nil {
+		fields["last_success_at"] = now
+		fields["consecutive_failures"] = 0
+		fields["last_fetch_error"] = ""
+	} else {
+		failures := feed.ConsecutiveFailures + 1
+		fields["consecutive_failures"] = failures
+		fields["last_fetch_error"] = fetchErr.Error()
+		if policy.QuarantineAfter > 0 && failures >= policy.QuarantineAfter {
+			fields["quarantined"] = true
+		}
+	}
+	if err := UpdateFeed(db, id, fields); err != nil {
+		return models.Feed{}, err
+	}
+	return GetFeed(db, id)
+}
+
+// Release lifts the quarantine of a feed and resets its failure count
+func Release(db *gorm.DB, id uint) error {
+	return UpdateFeed(db, id, map[string]interface{}{"quarantined": false, "consecutive_failures": 0})
+}
+
+// Health statuses, see Health.Status
+const (
+	HealthOK          = "ok"
+	HealthStale       = "stale"
+	HealthBroken      = "broken"
+	HealthQuarantined = "quarantined"
+)
+
+// Health is the state of a feed reported by the feedHealth command
+type Health struct {
+	Feed models.Feed
+	// LastEpisode is the publication date of the newest stored item
+	LastEpisode *time.Time
+	// Stale is set when the feed had no new episode for the stale period
+	Stale bool
+	// Broken is set when the last fetch failed or the feed is quarantined
+	Broken bool
+}
+
+// Status names the worst problem of the feed
+func (h Health) Status() string {
+	switch {
+	case h.Feed.Quarantined:
+		return HealthQuarantined
+	case h.Broken:
+		return HealthBroken
+	case h.Stale:
+		return HealthStale
+	default:
+		return HealthOK
+	}
+}
+
+// CheckHealth reports the health of every feed. A feed is stale when its
+// newest episode is older than staleAfter, or when it has none.
+func CheckHealth(db *gorm.DB, staleAfter time.Duration, now time.Time) ([]Health, error) {
+	all, err := ListFeeds(db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]Health, 0, len(all))
+	for _, feed := range all {
+		var last models.Item
+		// undated items are left out, PostgreSQL sorts NULLs first in descending order
+		err := db.Where("feed_id = ? AND published_parsed IS NOT NULL", feed.ID).
+			Order("published_parsed desc").Limit(1).Find(&last).Error
+		if err != nil {
+			return nil, err
+		}
+		h := Health{
+			Feed:        feed,
+			LastEpisode: last.PublishedParsed,
+			Broken:      feed.Quarantined || feed.ConsecutiveFailures > 0,
+		}
+		h.Stale = h.LastEpisode == nil || now.Sub(*h.LastEpisode) > staleAfter
+		report = append(report, h)
+	}
+	return report, nil
+}
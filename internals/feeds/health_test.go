@@ -0,0 +1,100 @@
+package feeds
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+func TestHealthPolicy_Wait(t *testing.T) {
+	p := HealthPolicy{Backoff: 10 * time.Minute, MaxBackoff: time.Hour}
+	assert.Equal(t, time.Duration(0), p.Wait(0))
+	assert.Equal(t, 10*time.Minute, p.Wait(1))
+	assert.Equal(t, 20*time.Minute, p.Wait(2))
+	assert.Equal(t, 40*time.Minute, p.Wait(3))
+	assert.Equal(t, time.Hour, p.Wait(4))
+	assert.Equal(t, time.Hour, p.Wait(100))
+}
+
+func TestHealthPolicy_ShouldFetch(t *testing.T) {
+	p := HealthPolicy{Backoff: 10 * time.Minute}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	last := now.Add(-15 * time.Minute)
+
+	assert.True(t, p.ShouldFetch(models.Feed{}, now))
+	assert.True(t, p.ShouldFetch(models.Feed{ConsecutiveFailures: 1, LastFetchAt: &last}, now))
+	assert.False(t, p.ShouldFetch(models.Feed{ConsecutiveFailures: 2, LastFetchAt: &last}, now))
+	assert.False(t, p.ShouldFetch(models.Feed{Quarantined: true}, now))
+}
+
+func TestFetchStatus(t *testing.T) {
+	assert.Equal(t, 200, FetchStatus(nil))
+	assert.Equal(t, 404, FetchStatus(gofeed.HTTPError{StatusCode: 404, Status: "404 Not Found"}))
+	assert.Equal(t, 0, FetchStatus(errors.New("connection refused")))
+}
+
+func TestRecordFetch(t *testing.T) {
+	db := newStoreDB(t)
+	feed := models.Feed{Title: "Feed"}
+	db.Create(&feed)
+	policy := HealthPolicy{Backoff: time.Minute, QuarantineAfter: 2}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	got, err := RecordFetch(db, feed.ID, gofeed.HTTPError{StatusCode: 500, Status: "500 Internal Server Error"}, now, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, got.ConsecutiveFailures)
+	assert.Equal(t, 500, got.LastStatus)
+	assert.Equal(t, "http error: 500 Internal Server Error", got.LastFetchError)
+	assert.False(t, got.Quarantined)
+	assert.Nil(t, got.LastSuccessAt)
+
+	got, err = RecordFetch(db, feed.ID, errors.New("timeout"), now, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, got.ConsecutiveFailures)
+	assert.True(t, got.Quarantined)
+
+	assert.NoError(t, Release(db, feed.ID))
+	got, err = RecordFetch(db, feed.ID, nil, now, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, got.ConsecutiveFailures)
+	assert.Equal(t, 200, got.LastStatus)
+	assert.Empty(t, got.LastFetchError)
+	assert.False(t, got.Quarantined)
+	assert.NotNil(t, got.LastSuccessAt)
+
+	_, err = RecordFetch(db, feed.ID+1, nil, now, policy)
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+}
+
+func TestCheckHealth(t *testing.T) {
+	db := newStoreDB(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	recent, old := now.Add(-24*time.Hour), now.Add(-60*24*time.Hour)
+
+	fresh := models.Feed{Title: "Fresh"}
+	stale := models.Feed{Title: "Stale"}
+	broken := models.Feed{Title: "Broken", ConsecutiveFailures: 3}
+	db.Create(&fresh)
+	db.Create(&stale)
+	db.Create(&broken)
+	db.Create(&models.Item{Title: "New", FeedId: int(fresh.ID), PublishedParsed: &recent})
+	db.Create(&models.Item{Title: "Old", FeedId: int(fresh.ID), PublishedParsed: &old})
+	db.Create(&models.Item{Title: "Undated", FeedId: int(fresh.ID)})
+	db.Create(&models.Item{Title: "Old", FeedId: int(stale.ID), PublishedParsed: &old})
+
+	report, err := CheckHealth(db, 30*24*time.Hour, now)
+	assert.NoError(t, err)
+	if assert.Len(t, report, 3) {
+		assert.False(t, report[0].Stale)
+		assert.False(t, report[0].Broken)
+		assert.Equal(t, recent, report[0].LastEpisode.UTC())
+		assert.True(t, report[1].Stale)
+		assert.False(t, report[1].Broken)
+		assert.True(t, report[2].Stale, "a feed without episodes is stale")
+		assert.True(t, report[2].Broken)
+	}
+}
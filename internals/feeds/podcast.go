@@ -0,0 +1,94 @@
+package feeds
+
+import (
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+// podcastPrefix is the usual prefix of the podcast namespace,
+// https://podcastindex.org/namespace/1.0
+const podcastPrefix = "podcast"
+
+// podcastTags returns the podcast namespace elements called name
+func podcastTags(extensions ext.Extensions, name string) []ext.Extension {
+	return extensions[podcastPrefix][name]
+}
+
+// podcastValue returns the text of the first podcast namespace element
+// called name, or "" when there is none
+func podcastValue(extensions ext.Extensions, name string) string {
+	for _, tag := range podcastTags(extensions, name) {
+		if value := strings.TrimSpace(tag.Value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// PodcastGUID returns the podcast:guid of the feed, or "" when it has none
+func PodcastGUID(v *gofeed.Feed) string {
+	return podcastValue(v.Extensions, "guid")
+}
+
+// NewFunding converts the podcast:funding links of the feed
+func NewFunding(v *gofeed.Feed) []models.Funding {
+	var funding []models.Funding
+	for _, tag := range podcastTags(v.Extensions, "funding") {
+		url := strings.TrimSpace(tag.Attrs["url"])
+		if url == "" {
+			continue
+		}
+		funding = append(funding, models.Funding{Url: url, Text: strings.TrimSpace(tag.Value)})
+	}
+	return funding
+}
+
+// applyPodcast copies the podcast namespace of a fetched item: chapters,
+// season, episode, transcripts and persons
+func applyPodcast(item *models.Item, v *gofeed.Item) {
+	for _, tag := range podcastTags(v.Extensions, "chapters") {
+		if url := strings.TrimSpace(tag.Attrs["url"]); url != "" {
+			item.ChaptersURL = url
+			item.ChaptersType = tag.Attrs["type"]
+			break
+		}
+	}
+	item.PodcastSeason = podcastValue(v.Extensions, "season")
+	item.PodcastEpisode = podcastValue(v.Extensions, "episode")
+	for _, tag := range podcastTags(v.Extensions, "transcript") {
+		url := strings.TrimSpace(tag.Attrs["url"])
+		if url == "" {
+			continue
+		}
+		item.Transcripts = append(item.Transcripts, models.Transcript{
+			Url:      url,
+			Type:     tag.Attrs["type"],
+			Language: tag.Attrs["language"],
+			Rel:      tag.Attrs["rel"],
+		})
+	}
+	for _, tag := range podcastTags(v.Extensions, "person") {
+		name := strings.TrimSpace(tag.Value)
+		if name == "" {
+			continue
+		}
+		// role and group default to host and cast
+		role, group := strings.ToLower(tag.Attrs["role"]), strings.ToLower(tag.Attrs["group"])
+		if role == "" {
+			role = "host"
+		}
+		if group == "" {
+			group = "cast"
+		}
+		item.Persons = append(item.Persons, models.Person{
+			Name:  name,
+			Role:  role,
+			Group: group,
+			Href:  tag.Attrs["href"],
+			Img:   tag.Attrs["img"],
+		})
+	}
+}
@@ -2,6 +2,7 @@ package feeds
 
 import (
 	"errors"
+	"github.com/mmcdole/gofeed"
 	"github.com/tutuna/echopan/internals/models"
 	"gorm.io/gorm"
 )
@@ -32,3 +33,12 @@ func GetReadyFeeds(db *gorm.DB) ([]models.Feed, error) {
 	}
 	return feeds, nil
 }
+
+// KnownItem returns a predicate reporting whether an item is already stored for the feed
+func KnownItem(db *gorm.DB, feed models.Feed) func(item *gofeed.Item) bool {
+	return func(item *gofeed.Item) bool {
+		var count int64
+		err := db.Model(&models.Item{}).Where("feed_id = ? AND title = ?", feed.ID, item.Title).Count(&count).Error
+		return err == nil && count > 0
+	}
+}
@@ -0,0 +1,34 @@
+package feeds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tutuna/echopan/internals/models"
+)
+
+// ParseSchedule reads Feed.Schedule, the minimum time between two
+// publications. An empty schedule means no limit.
+func ParseSchedule(schedule string) (time.Duration, error) {
+	if schedule == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(schedule)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid schedule %q, expected a duration such as 24h", schedule)
+	}
+	return d, nil
+}
+
+// Due reports whether the schedule of the feed allows publishing at now.
+// Feeds with an invalid schedule are never due.
+func Due(feed models.Feed, now time.Time) bool {
+	every, err := ParseSchedule(feed.Schedule)
+	if err != nil {
+		return false
+	}
+	if every == 0 || feed.LastPubDate == nil {
+		return true
+	}
+	return !now.Before(feed.LastPubDate.Add(every))
+}
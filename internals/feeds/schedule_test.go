@@ -0,0 +1,23 @@
+package feeds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+)
+
+func TestDue(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-2 * time.Hour)
+
+	assert.True(t, Due(models.Feed{}, now))
+	assert.True(t, Due(models.Feed{Schedule: "24h"}, now), "never published")
+	assert.False(t, Due(models.Feed{Schedule: "24h", LastPubDate: &recent}, now))
+	assert.True(t, Due(models.Feed{Schedule: "1h", LastPubDate: &recent}, now))
+	assert.False(t, Due(models.Feed{Schedule: "daily"}, now))
+
+	_, err := ParseSchedule("-1h")
+	assert.Error(t, err)
+}
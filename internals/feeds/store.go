@@ -0,0 +1,288 @@
+package feeds
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tutuna/echopan/internals/feedurl"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+// ErrFeedNotFound is returned when no feed matches the given id
+var ErrFeedNotFound = errors.New("feed not found")
+
+// Stats summarises the items stored for a feed
+type Stats struct {
+	Items         int64      `json:"items"`
+	Published     int64      `json:"published"`
+	Unpublished   int64      `json:"unpublished"`
+	Enclosures    int64      `json:"enclosures"`
+	LastPublished *time.Time `json:"last_published,omitempty"`
+}
+
+// ListFeeds retrieves all feeds ordered by id, optionally including soft deleted ones
+func ListFeeds(db *gorm.DB, withDeleted bool) ([]models.Feed, error) {
+	if db == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var feeds []models.Feed
+	query := db.Order("id asc")
+	if withDeleted {
+		query = query.Unscoped()
+	}
+	if err := query.Find(&feeds).Error; err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// GetFeed retrieves a feed by id, soft deleted feeds included
+func GetFeed(db *gorm.DB, id uint) (models.Feed, error) {
+	if db == nil {
+		return models.Feed{}, errors.New("database connection is nil")
+	}
+
+	var feed models.Feed
+	err := db.Unscoped().First(&feed, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Feed{}, ErrFeedNotFound
+	}
+	return feed, err
+}
+
+// UpdateFeed sets the given columns on a feed
+func UpdateFeed(db *gorm.DB, id uint, fields map[string]interface{}) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	result := db.Unscoped().Model(&models.Feed{}).Where("id = ?", id).Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
+// SetPublishReady pauses or resumes publishing of a feed
+func SetPublishReady(db *gorm.DB, id uint, ready bool) error {
+	return UpdateFeed(db, id, map[string]interface{}{"publish_ready": ready})
+}
+
+// SetFeedURL changes the URL the feed is fetched from
+func SetFeedURL(db *gorm.DB, id uint, url string) error {
+	if url == "" {
+		return errors.New("feed url is empty")
+	}
+	other, err := FindByURL(db, url)
+	switch {
+	case err == nil && other.ID != id:
+		return fmt.Errorf("feed %d already uses %s", other.ID, url)
+	case err != nil && !errors.Is(err, ErrFeedNotFound):
+		return err
+	}
+	return UpdateFeed(db, id, map[string]interface{}{"feed": url, "url_key": feedurl.Key(url)})
+}
+
+// FindByURL retrieves the feed with the same normalized URL, soft deleted
+// feeds included
+func FindByURL(db *gorm.DB, url string) (models.Feed, error) {
+	if db == nil {
+		return models.Feed{}, errors.New("database connection is nil")
+	}
+
+	var feed models.Feed
+	err := db.Unscoped().Where("url_key = ?", feedurl.Key(url)).First(&feed).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Feed{}, ErrFeedNotFound
+	}
+	return feed, err
+}
+
+// AmbiguousError is returned when a selector matches several feeds
+type AmbiguousError struct {
+	Selector string
+	Matches  []uint
+}
+
+func (e *AmbiguousError) Error() string {
+	ids := make([]string, len(e.Matches))
+	for i, id := range e.Matches {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return fmt.Sprintf("%q matches feeds %s, use an id or url instead", e.Selector, strings.Join(ids, ", "))
+}
+
+// Resolve finds the feed designated by selector, which is a feed id, a feed
+// URL, a podcast:guid or a title, tried in that order. Soft deleted feeds are
+// included.
+func Resolve(db *gorm.DB, selector string) (models.Feed, error) {
+	if db == nil {
+		return models.Feed{}, errors.New("database connection is nil")
+	}
+
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return models.Feed{}, errors.New("feed selector is empty")
+	}
+	if id, err := strconv.ParseUint(selector, 10, 0); err == nil {
+		return GetFeed(db, uint(id))
+	}
+	if strings.Contains(selector, "://") {
+		return FindByURL(db, selector)
+	}
+	for _, column := range []string{"podcast_guid", "title"} {
+		var matches []models.Feed
+		if err := db.Unscoped().Where(column+" = ?", selector).Order("id asc").Find(&matches).Error; err != nil {
+			return models.Feed{}, err
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0], nil
+		}
+		ambiguous := &AmbiguousError{Selector: selector}
+		for _, feed := range matches {
+			ambiguous.Matches = append(ambiguous.Matches, feed.ID)
+		}
+		return models.Feed{}, ambiguous
+	}
+	return models.Feed{}, ErrFeedNotFound
+}
+
+// MoveFeed changes the URL of a feed and records the change with its reason
+func MoveFeed(db *gorm.DB, id uint, newURL, reason string) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		feed, err := GetFeed(tx, id)
+		if err != nil {
+			return err
+		}
+		if feed.Feed == newURL {
+			return nil
+		}
+		if err := SetFeedURL(tx, id, newURL); err != nil {
+			return err
+		}
+		return tx.Create(&models.FeedURLChange{FeedId: id, OldURL: feed.Feed, NewURL: newURL, Reason: reason}).Error
+	})
+}
+
+// URLChanges lists the URL changes of a feed, oldest first
+func URLChanges(db *gorm.DB, id uint) ([]models.FeedURLChange, error) {
+	if db == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var changes []models.FeedURLChange
+	if err := db.Where("feed_id = ?", id).Order("id asc").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// UpdatePodcast stores the podcast namespace of a fetched feed: its
+// podcast:guid, when it has one, and its funding links in place of the
+// previous ones
+func UpdatePodcast(db *gorm.DB, id uint, guid string, funding []models.Funding) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if guid != "" {
+			if err := UpdateFeed(tx, id, map[string]interface{}{"podcast_guid": guid}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("feed_id = ?", id).Delete(&models.Funding{}).Error; err != nil {
+			return err
+		}
+		for _, f := range funding {
+			f.FeedId = id
+			if err := tx.Create(&f).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetFunding lists the funding links of a feed
+func GetFunding(db *gorm.DB, id uint) ([]models.Funding, error) {
+	if db == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var funding []models.Funding
+	if err := db.Where("feed_id = ?", id).Order("id asc").Find(&funding).Error; err != nil {
+		return nil, err
+	}
+	return funding, nil
+}
+
+// DeleteFeed soft deletes a feed, its items are kept
+func DeleteFeed(db *gorm.DB, id uint) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	result := db.Delete(&models.Feed{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
+// RestoreFeed brings back a soft deleted feed
+func RestoreFeed(db *gorm.DB, id uint) error {
+	return UpdateFeed(db, id, map[string]interface{}{"deleted_at": nil})
+}
+
+// GetStats counts the items and enclosures stored for a feed
+func GetStats(db *gorm.DB, id uint) (Stats, error) {
+	if db == nil {
+		return Stats{}, errors.New("database connection is nil")
+	}
+
+	var stats Stats
+	items := func() *gorm.DB { return db.Model(&models.Item{}).Where("feed_id = ?", id) }
+	if err := items().Count(&stats.Items).Error; err != nil {
+		return Stats{}, err
+	}
+	if err := items().Where("tg_published = ?", 1).Count(&stats.Published).Error; err != nil {
+		return Stats{}, err
+	}
+	if err := items().Where("tg_published = ?", 0).Count(&stats.Unpublished).Error; err != nil {
+		return Stats{}, err
+	}
+	err := db.Model(&models.Enclosure{}).
+		Joins("JOIN items ON items.id = enclosures.item_id").
+		Where("items.feed_id = ?", id).
+		Count(&stats.Enclosures).Error
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var last models.Item
+	err = items().Where("tg_published = ?", 1).Order("published_parsed desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return Stats{}, err
+	}
+	stats.LastPublished = last.PublishedParsed
+	return stats, nil
+}
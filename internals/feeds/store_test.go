@@ -0,0 +1,215 @@
+package feeds
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/feedurl"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newStoreDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{}, &models.Enclosure{})
+	return db
+}
+
+func TestListFeeds_WithDeleted(t *testing.T) {
+	db := newStoreDB(t)
+	db.Create(&models.Feed{Title: "Kept"})
+	deleted := models.Feed{Title: "Deleted"}
+	db.Create(&deleted)
+	db.Delete(&deleted)
+
+	active, err := ListFeeds(db, false)
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+	assert.Equal(t, "Kept", active[0].Title)
+
+	all, err := ListFeeds(db, true)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestGetFeed_NotFound(t *testing.T) {
+	db := newStoreDB(t)
+	_, err := GetFeed(db, 42)
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+}
+
+func TestUpdateFeed(t *testing.T) {
+	db := newStoreDB(t)
+	feed := models.Feed{Title: "Feed"}
+	db.Create(&feed)
+
+	err := UpdateFeed(db, feed.ID, map[string]interface{}{"tg_channel": -100123, "extra_link": "https://example.com"})
+	assert.NoError(t, err)
+	got, err := GetFeed(db, feed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, -100123, got.TgChannel)
+	assert.Equal(t, "https://example.com", got.ExtraLink)
+
+	assert.ErrorIs(t, UpdateFeed(db, 42, map[string]interface{}{"title": "x"}), ErrFeedNotFound)
+}
+
+func TestPauseAndResume(t *testing.T) {
+	db := newStoreDB(t)
+	feed := models.Feed{Title: "Feed"}
+	db.Create(&feed)
+
+	assert.NoError(t, SetPublishReady(db, feed.ID, true))
+	got, _ := GetFeed(db, feed.ID)
+	assert.True(t, got.PublishReady)
+
+	assert.NoError(t, SetPublishReady(db, feed.ID, false))
+	got, _ = GetFeed(db, feed.ID)
+	assert.False(t, got.PublishReady)
+}
+
+func TestDeleteAndRestoreFeed(t *testing.T) {
+	db := newStoreDB(t)
+	feed := models.Feed{Title: "Feed"}
+	db.Create(&feed)
+
+	assert.NoError(t, DeleteFeed(db, feed.ID))
+	got, err := GetFeed(db, feed.ID)
+	assert.NoError(t, err)
+	assert.True(t, got.DeletedAt.Valid)
+	assert.ErrorIs(t, DeleteFeed(db, feed.ID), ErrFeedNotFound)
+
+	assert.NoError(t, RestoreFeed(db, feed.ID))
+	got, _ = GetFeed(db, feed.ID)
+	assert.False(t, got.DeletedAt.Valid)
+}
+
+func TestSetFeedURL(t *testing.T) {
+	db := newStoreDB(t)
+	feed := models.Feed{Title: "Feed", Feed: "http://old.example.com/rss"}
+	db.Create(&feed)
+
+	assert.Error(t, SetFeedURL(db, feed.ID, ""))
+	assert.NoError(t, SetFeedURL(db, feed.ID, "http://new.example.com/rss"))
+	got, _ := GetFeed(db, feed.ID)
+	assert.Equal(t, "http://new.example.com/rss", got.Feed)
+	if assert.NotNil(t, got.URLKey) {
+		assert.Equal(t, feedurl.Key("http://new.example.com/rss"), *got.URLKey)
+	}
+
+	other := models.Feed{Title: "Other", Feed: "http://other.example.com/rss"}
+	db.Create(&other)
+	assert.ErrorContains(t, SetFeedURL(db, other.ID, "HTTP://new.example.com/rss"), "already uses")
+}
+
+func TestResolve(t *testing.T) {
+	db := newStoreDB(t)
+	first := models.Feed{Title: "Podcast", Feed: "https://one.example.com/rss", PodcastGUID: "ead4c236-bf58-58c6-a2c6-a6b28d128cb6"}
+	second := models.Feed{Title: "Podcast", Feed: "https://two.example.com/rss"}
+	renamed := models.Feed{Title: "New Name", Feed: "https://three.example.com/rss"}
+	db.Create(&first)
+	db.Create(&second)
+	db.Create(&renamed)
+
+	for selector, want := range map[string]uint{
+		strconv.Itoa(int(second.ID)):           second.ID,
+		"HTTPS://two.example.com:443/rss":      second.ID,
+		"ead4c236-bf58-58c6-a2c6-a6b28d128cb6": first.ID,
+		"New Name":                             renamed.ID,
+	} {
+		feed, err := Resolve(db, selector)
+		assert.NoError(t, err, selector)
+		assert.Equal(t, want, feed.ID, selector)
+	}
+
+	_, err := Resolve(db, "Podcast")
+	var ambiguous *AmbiguousError
+	if assert.ErrorAs(t, err, &ambiguous) {
+		assert.Equal(t, []uint{first.ID, second.ID}, ambiguous.Matches)
+	}
+	assert.ErrorContains(t, err, `"Podcast" matches feeds 1, 2`)
+
+	_, err = Resolve(db, "https://missing.example.com/rss")
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+	_, err = Resolve(db, "Missing")
+	assert.ErrorIs(t, err, ErrFeedNotFound)
+	_, err = Resolve(db, " ")
+	assert.Error(t, err)
+}
+
+func TestGetStats(t *testing.T) {
+	db := newStoreDB(t)
+	feed := models.Feed{Title: "Feed"}
+	db.Create(&feed)
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	published := models.Item{Title: "Old", FeedId: int(feed.ID), TgPublished: 1, PublishedParsed: &older}
+	db.Create(&published)
+	db.Create(&models.Item{Title: "Newer", FeedId: int(feed.ID), TgPublished: 1, PublishedParsed: &newer})
+	db.Create(&models.Item{Title: "Queued", FeedId: int(feed.ID)})
+	db.Create(&models.Item{Title: "Other feed", FeedId: int(feed.ID) + 1})
+	db.Create(&models.Enclosure{ItemId: published.ID, Url: "http://example.com/old.mp3"})
+
+	stats, err := GetStats(db, feed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Items)
+	assert.Equal(t, int64(2), stats.Published)
+	assert.Equal(t, int64(1), stats.Unpublished)
+	assert.Equal(t, int64(1), stats.Enclosures)
+	if assert.NotNil(t, stats.LastPublished) {
+		assert.True(t, newer.Equal(*stats.LastPublished))
+	}
+}
+
+func TestMoveFeed(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "echopan.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.FeedURLChange{})
+	feed := models.Feed{Title: "Feed", Feed: "http://old.example.com/feed"}
+	db.Create(&feed)
+
+	assert.NoError(t, MoveFeed(db, feed.ID, "https://new.example.com/feed", MoveRedirect))
+	assert.NoError(t, MoveFeed(db, feed.ID, "https://new.example.com/feed", MoveRedirect), "moving to the same url is a no-op")
+	got, _ := GetFeed(db, feed.ID)
+	assert.Equal(t, "https://new.example.com/feed", got.Feed)
+
+	changes, err := URLChanges(db, feed.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, "http://old.example.com/feed", changes[0].OldURL)
+		assert.Equal(t, "https://new.example.com/feed", changes[0].NewURL)
+		assert.Equal(t, MoveRedirect, changes[0].Reason)
+	}
+
+	assert.ErrorIs(t, MoveFeed(db, feed.ID+1, "https://other.example.com", MoveManual), ErrFeedNotFound)
+}
+
+func TestUpdatePodcast(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "echopan.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Funding{})
+	feed := models.Feed{Title: "Feed", Feed: "http://example.com/rss"}
+	db.Create(&feed)
+
+	assert.NoError(t, UpdatePodcast(db, feed.ID, "guid", []models.Funding{{Url: "http://example.com/a"}, {Url: "http://example.com/b"}}))
+	assert.NoError(t, UpdatePodcast(db, feed.ID, "", []models.Funding{{Url: "http://example.com/c", Text: "Support"}}))
+
+	got, _ := GetFeed(db, feed.ID)
+	assert.Equal(t, "guid", got.PodcastGUID, "a feed without podcast:guid keeps the known one")
+	funding, err := GetFunding(db, feed.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, funding, 1) {
+		assert.Equal(t, "Support", funding[0].Text)
+	}
+	assert.ErrorIs(t, UpdatePodcast(db, 42, "guid", nil), ErrFeedNotFound)
+}
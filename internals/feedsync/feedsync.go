@@ -0,0 +1,316 @@
+package feedsync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tutuna/echopan/internals/caption"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/feedurl"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/shownotes"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Definition is the desired state of one feed. Feeds are identified by URL.
+type Definition struct {
+	URL string `yaml:"url"`
+	// Title is only used when the feed is created, it is read from the feed when empty
+	Title           string  `yaml:"title"`
+	Channel         int     `yaml:"channel"`
+	Ready           bool    `yaml:"ready"`
+	CaptionTemplate string  `yaml:"caption_template"`
+	Caption         Caption `yaml:"caption_options"`
+	ExtraLink       string  `yaml:"extra_link"`
+	Schedule        string  `yaml:"schedule"`
+	// ShowNotes is reply or page, see internals/shownotes
+	ShowNotes string `yaml:"show_notes"`
+	Filter    Filter `yaml:"filter"`
+}
+
+// Caption is the caption options of a feed
+type Caption struct {
+	HideSubtitle bool `yaml:"hide_subtitle"`
+	// Source is subtitle, summary or description
+	Source     string `yaml:"source"`
+	MaxLength  int    `yaml:"max_length"`
+	StripLinks bool   `yaml:"strip_links"`
+	Numbers    bool   `yaml:"numbers"`
+}
+
+// Filter is the filter rules of a feed, see feeds.Rules
+type Filter struct {
+	Include          string   `yaml:"include"`
+	Exclude          string   `yaml:"exclude"`
+	SkipEpisodeTypes []string `yaml:"skip_episode_types"`
+	SkipExplicit     bool     `yaml:"skip_explicit"`
+	MinDuration      string   `yaml:"min_duration"`
+	MaxDuration      string   `yaml:"max_duration"`
+}
+
+// File is the layout of feeds.yaml
+type File struct {
+	Feeds []Definition `yaml:"feeds"`
+}
+
+// LoadFile reads and validates a feeds file
+func LoadFile(path string) (File, error) {
+	var file File
+	f, err := os.Open(path)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return file, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return file, file.Validate()
+}
+
+// Validate reports every invalid definition at once
+func (f File) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, def := range f.Feeds {
+		where := fmt.Sprintf("feeds[%d]", i)
+		if def.URL == "" {
+			errs = append(errs, fmt.Errorf("%s: url is required", where))
+			continue
+		}
+		where = fmt.Sprintf("feeds[%d] %s", i, def.URL)
+		// URLs differing only in case, default port and the like are the same feed
+		key := feedurl.Key(def.URL)
+		if seen[key] {
+			errs = append(errs, fmt.Errorf("%s: duplicate url", where))
+		}
+		seen[key] = true
+		if def.Ready && def.Channel == 0 {
+			errs = append(errs, fmt.Errorf("%s: a ready feed needs a channel", where))
+		}
+		if _, err := feeds.ParseSchedule(def.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+		}
+		if err := caption.Validate(def.CaptionTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("%s: caption_template: %w", where, err))
+		}
+		if err := caption.ValidSource(def.Caption.Source); err != nil {
+			errs = append(errs, fmt.Errorf("%s: caption_options: %w", where, err))
+		}
+		if def.Caption.MaxLength < 0 {
+			errs = append(errs, fmt.Errorf("%s: caption_options: max_length must not be negative", where))
+		}
+		if err := shownotes.ValidMode(def.ShowNotes); err != nil {
+			errs = append(errs, fmt.Errorf("%s: show_notes: %w", where, err))
+		}
+		if _, err := feeds.ParseRules(newFeed(def)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: filter: %w", where, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Action is what a sync does to one feed
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionRestore Action = "restore"
+	ActionUpdate  Action = "update"
+	ActionPause   Action = "pause"
+)
+
+// FieldChange is one column changed by an update
+type FieldChange struct {
+	Column string
+	Old    string
+	New    string
+	value  interface{}
+}
+
+// Change is one step of a Plan
+type Change struct {
+	Action Action
+	// Feed is the feed to create, or the stored feed to restore, update or pause
+	Feed   models.Feed
+	Fields []FieldChange
+}
+
+// Plan lists the changes bringing the stored feeds to the definitions
+type Plan struct {
+	Changes []Change
+}
+
+// Diff compares the stored feeds, soft deleted ones included, with the
+// definitions. Deleted feeds that are defined again are restored. Stored
+// feeds missing from the definitions are paused, they are never deleted.
+func Diff(stored []models.Feed, defs []Definition) Plan {
+	byURL := map[string]models.Feed{}
+	for _, feed := range stored {
+		if _, ok := byURL[feedurl.Key(feed.Feed)]; !ok {
+			byURL[feedurl.Key(feed.Feed)] = feed
+		}
+	}
+
+	var plan Plan
+	defined := map[string]bool{}
+	for _, def := range defs {
+		defined[feedurl.Key(def.URL)] = true
+		feed, ok := byURL[feedurl.Key(def.URL)]
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Feed: newFeed(def)})
+			continue
+		}
+		if feed.DeletedAt.Valid {
+			plan.Changes = append(plan.Changes, Change{Action: ActionRestore, Feed: feed, Fields: diffFields(feed, def)})
+			continue
+		}
+		if fields := diffFields(feed, def); len(fields) > 0 {
+			plan.Changes = append(plan.Changes, Change{Action: ActionUpdate, Feed: feed, Fields: fields})
+		}
+	}
+
+	var paused []Change
+	for _, feed := range stored {
+		if defined[feedurl.Key(feed.Feed)] || !feed.PublishReady || feed.DeletedAt.Valid {
+			continue
+		}
+		paused = append(paused, Change{Action: ActionPause, Feed: feed, Fields: []FieldChange{
+			{Column: "publish_ready", Old: "true", New: "false", value: false},
+		}})
+	}
+	sort.Slice(paused, func(i, j int) bool { return paused[i].Feed.ID < paused[j].Feed.ID })
+	plan.Changes = append(plan.Changes, paused...)
+	return plan
+}
+
+func newFeed(def Definition) models.Feed {
+	return models.Feed{
+		Title:               def.Title,
+		Feed:                def.URL,
+		TgChannel:           def.Channel,
+		PublishReady:        def.Ready,
+		CaptionTemplate:     def.CaptionTemplate,
+		CaptionHideSubtitle: def.Caption.HideSubtitle,
+		CaptionSource:       def.Caption.Source,
+		CaptionMaxLength:    def.Caption.MaxLength,
+		CaptionStripLinks:   def.Caption.StripLinks,
+		CaptionNumbers:      def.Caption.Numbers,
+		ExtraLinkEnabled:    def.ExtraLink != "",
+		ExtraLink:           def.ExtraLink,
+		Schedule:            def.Schedule,
+		ShowNotes:           def.ShowNotes,
+		FilterInclude:       def.Filter.Include,
+		FilterExclude:       def.Filter.Exclude,
+		FilterEpisodeTypes:  strings.Join(def.Filter.SkipEpisodeTypes, ","),
+		FilterExplicit:      def.Filter.SkipExplicit,
+		FilterMinDuration:   def.Filter.MinDuration,
+		FilterMaxDuration:   def.Filter.MaxDuration,
+	}
+}
+
+func diffFields(feed models.Feed, def Definition) []FieldChange {
+	want := newFeed(def)
+	var fields []FieldChange
+	add := func(column, old, new string, value interface{}) {
+		if old != new {
+			fields = append(fields, FieldChange{Column: column, Old: old, New: new, value: value})
+		}
+	}
+	add("tg_channel", strconv.Itoa(feed.TgChannel), strconv.Itoa(want.TgChannel), want.TgChannel)
+	add("publish_ready", strconv.FormatBool(feed.PublishReady), strconv.FormatBool(want.PublishReady), want.PublishReady)
+	add("caption_template", strconv.Quote(feed.CaptionTemplate), strconv.Quote(want.CaptionTemplate), want.CaptionTemplate)
+	add("caption_hide_subtitle", strconv.FormatBool(feed.CaptionHideSubtitle), strconv.FormatBool(want.CaptionHideSubtitle), want.CaptionHideSubtitle)
+	add("caption_source", strconv.Quote(feed.CaptionSource), strconv.Quote(want.CaptionSource), want.CaptionSource)
+	add("caption_max_length", strconv.Itoa(feed.CaptionMaxLength), strconv.Itoa(want.CaptionMaxLength), want.CaptionMaxLength)
+	add("caption_strip_links", strconv.FormatBool(feed.CaptionStripLinks), strconv.FormatBool(want.CaptionStripLinks), want.CaptionStripLinks)
+	add("caption_numbers", strconv.FormatBool(feed.CaptionNumbers), strconv.FormatBool(want.CaptionNumbers), want.CaptionNumbers)
+	add("extra_link_enabled", strconv.FormatBool(feed.ExtraLinkEnabled), strconv.FormatBool(want.ExtraLinkEnabled), want.ExtraLinkEnabled)
+	add("extra_link", strconv.Quote(feed.ExtraLink), strconv.Quote(want.ExtraLink), want.ExtraLink)
+	add("schedule", strconv.Quote(feed.Schedule), strconv.Quote(want.Schedule), want.Schedule)
+	add("show_notes", strconv.Quote(feed.ShowNotes), strconv.Quote(want.ShowNotes), want.ShowNotes)
+	add("filter_include", strconv.Quote(feed.FilterInclude), strconv.Quote(want.FilterInclude), want.FilterInclude)
+	add("filter_exclude", strconv.Quote(feed.FilterExclude), strconv.Quote(want.FilterExclude), want.FilterExclude)
+	add("filter_episode_types", strconv.Quote(feed.FilterEpisodeTypes), strconv.Quote(want.FilterEpisodeTypes), want.FilterEpisodeTypes)
+	add("filter_explicit", strconv.FormatBool(feed.FilterExplicit), strconv.FormatBool(want.FilterExplicit), want.FilterExplicit)
+	add("filter_min_duration", strconv.Quote(feed.FilterMinDuration), strconv.Quote(want.FilterMinDuration), want.FilterMinDuration)
+	add("filter_max_duration", strconv.Quote(feed.FilterMaxDuration), strconv.Quote(want.FilterMaxDuration), want.FilterMaxDuration)
+	return fields
+}
+
+// Empty reports whether the stored feeds already match the definitions
+func (p Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Write prints the plan as a diff, one line per feed and one per changed column
+func (p Plan) Write(w io.Writer) error {
+	counts := map[Action]int{}
+	for _, c := range p.Changes {
+		counts[c.Action]++
+		var err error
+		switch c.Action {
+		case ActionCreate:
+			_, err = fmt.Fprintf(w, "+ %s (channel %d, ready %t)\n", c.Feed.Feed, c.Feed.TgChannel, c.Feed.PublishReady)
+		case ActionRestore:
+			_, err = fmt.Fprintf(w, "^ %d %s (%s) restored\n", c.Feed.ID, c.Feed.Title, c.Feed.Feed)
+		case ActionUpdate:
+			_, err = fmt.Fprintf(w, "~ %d %s (%s)\n", c.Feed.ID, c.Feed.Title, c.Feed.Feed)
+		case ActionPause:
+			_, err = fmt.Fprintf(w, "- %d %s (%s) paused, not in the file\n", c.Feed.ID, c.Feed.Title, c.Feed.Feed)
+		}
+		if err != nil {
+			return err
+		}
+		if c.Action != ActionUpdate && c.Action != ActionRestore {
+			continue
+		}
+		for _, f := range c.Fields {
+			if _, err := fmt.Fprintf(w, "    %s: %s -> %s\n", f.Column, f.Old, f.New); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d to create, %d to restore, %d to update, %d to pause\n",
+		counts[ActionCreate], counts[ActionRestore], counts[ActionUpdate], counts[ActionPause])
+	return err
+}
+
+// Apply runs the plan in a single transaction
+func Apply(db *gorm.DB, plan Plan) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range plan.Changes {
+			if c.Action == ActionCreate {
+				feed := c.Feed
+				if err := tx.Create(&feed).Error; err != nil {
+					return fmt.Errorf("creating %s: %w", c.Feed.Feed, err)
+				}
+				continue
+			}
+			columns := map[string]interface{}{}
+			for _, f := range c.Fields {
+				columns[f.Column] = f.value
+			}
+			query := tx.Model(&models.Feed{})
+			if c.Action == ActionRestore {
+				query = query.Unscoped()
+				columns["deleted_at"] = nil
+			}
+			if err := query.Where("id = ?", c.Feed.ID).Updates(columns).Error; err != nil {
+				return fmt.Errorf("updating feed %d: %w", c.Feed.ID, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,187 @@
+package feedsync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func storedFeeds() []models.Feed {
+	return []models.Feed{
+		{Model: gorm.Model{ID: 1}, Title: "Kept", Feed: "http://example.com/kept", TgChannel: -100, PublishReady: true},
+		{Model: gorm.Model{ID: 2}, Title: "Changed", Feed: "http://example.com/changed", TgChannel: -200},
+		{Model: gorm.Model{ID: 3}, Title: "Dropped", Feed: "http://example.com/dropped", TgChannel: -300, PublishReady: true},
+		{Model: gorm.Model{ID: 4}, Title: "Idle", Feed: "http://example.com/idle"},
+	}
+}
+
+func definitions() []Definition {
+	return []Definition{
+		{URL: "http://example.com/kept", Channel: -100, Ready: true},
+		{URL: "http://example.com/changed", Channel: -200, Ready: true, ExtraLink: "https://t.me/extra", Schedule: "24h"},
+		{URL: "http://example.com/new", Title: "New", Channel: -400},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	plan := Diff(storedFeeds(), definitions())
+
+	if !assert.Len(t, plan.Changes, 3) {
+		return
+	}
+	update := plan.Changes[0]
+	assert.Equal(t, ActionUpdate, update.Action)
+	assert.Equal(t, uint(2), update.Feed.ID)
+	var columns []string
+	for _, f := range update.Fields {
+		columns = append(columns, f.Column)
+	}
+	assert.Equal(t, []string{"publish_ready", "extra_link_enabled", "extra_link", "schedule"}, columns)
+
+	create := plan.Changes[1]
+	assert.Equal(t, ActionCreate, create.Action)
+	assert.Equal(t, "New", create.Feed.Title)
+	assert.Equal(t, -400, create.Feed.TgChannel)
+
+	pause := plan.Changes[2]
+	assert.Equal(t, ActionPause, pause.Action)
+	assert.Equal(t, uint(3), pause.Feed.ID, "idle feeds missing from the file are already paused")
+
+	assert.True(t, Diff(storedFeeds()[:1], definitions()[:1]).Empty())
+}
+
+func TestPlan_Write(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, Diff(storedFeeds(), definitions()).Write(&out))
+	assert.Equal(t, `~ 2 Changed (http://example.com/changed)
+    publish_ready: false -> true
+    extra_link_enabled: false -> true
+    extra_link: "" -> "https://t.me/extra"
+    schedule: "" -> "24h"
++ http://example.com/new (channel -400, ready false)
+- 3 Dropped (http://example.com/dropped) paused, not in the file
+1 to create, 0 to restore, 1 to update, 1 to pause
+`, out.String())
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feeds.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+feeds:
+  - url: http://example.com/a
+    channel: -100
+    ready: true
+    caption_template: "*{{.Title}}*"
+    schedule: 12h
+    caption_options:
+      source: summary
+      numbers: true
+    filter:
+      skip_episode_types: [trailer, bonus]
+      min_duration: 5m
+`)
+	file, err := LoadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Definition{{
+		URL: "http://example.com/a", Channel: -100, Ready: true, CaptionTemplate: "*{{.Title}}*", Schedule: "12h",
+		Caption: Caption{Source: "summary", Numbers: true},
+		Filter:  Filter{SkipEpisodeTypes: []string{"trailer", "bonus"}, MinDuration: "5m"},
+	}}, file.Feeds)
+	assert.Equal(t, "trailer,bonus", newFeed(file.Feeds[0]).FilterEpisodeTypes)
+
+	write(`
+feeds:
+  - url: http://example.com/a
+    ready: true
+    schedule: weekly
+  - url: HTTP://EXAMPLE.com:80/a
+    caption_template: "{{.Nope}}"
+    caption_options:
+      source: title
+    filter:
+      exclude: "("
+  - channel: 1
+`)
+	_, err = LoadFile(path)
+	assert.ErrorContains(t, err, "a ready feed needs a channel")
+	assert.ErrorContains(t, err, "invalid schedule")
+	assert.ErrorContains(t, err, "duplicate url")
+	assert.ErrorContains(t, err, "caption_template")
+	assert.ErrorContains(t, err, "filter: invalid exclude rule")
+	assert.ErrorContains(t, err, "caption_options: unknown caption source")
+	assert.ErrorContains(t, err, "feeds[2]: url is required")
+
+	write("feeds:\n  - url: http://example.com/a\n    chanel: 1\n")
+	_, err = LoadFile(path)
+	assert.ErrorContains(t, err, "chanel", "typos are reported")
+}
+
+func TestApply(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "echopan.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{})
+	for _, feed := range storedFeeds() {
+		db.Create(&feed)
+	}
+
+	assert.NoError(t, Apply(db, Diff(storedFeeds(), definitions())))
+
+	var feeds []models.Feed
+	db.Order("id").Find(&feeds)
+	if !assert.Len(t, feeds, 5) {
+		return
+	}
+	assert.True(t, feeds[1].PublishReady)
+	assert.Equal(t, "24h", feeds[1].Schedule)
+	assert.Equal(t, "https://t.me/extra", feeds[1].ExtraLink)
+	assert.False(t, feeds[2].PublishReady)
+	assert.Equal(t, "http://example.com/new", feeds[4].Feed)
+
+	assert.True(t, Diff(feeds, definitions()).Empty(), "a second sync changes nothing")
+}
+
+func TestApply_RestoresDeletedFeed(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "echopan.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{})
+	for _, feed := range storedFeeds() {
+		db.Create(&feed)
+	}
+	db.Delete(&models.Feed{}, 2)
+	var stored []models.Feed
+	db.Unscoped().Order("id").Find(&stored)
+
+	plan := Diff(stored, definitions())
+	if !assert.Len(t, plan.Changes, 3) {
+		return
+	}
+	assert.Equal(t, ActionRestore, plan.Changes[0].Action)
+	assert.Equal(t, uint(2), plan.Changes[0].Feed.ID)
+	assert.NoError(t, Apply(db, plan))
+
+	var feed models.Feed
+	assert.NoError(t, db.First(&feed, 2).Error, "the feed is no longer deleted")
+	assert.True(t, feed.PublishReady)
+	assert.Equal(t, "24h", feed.Schedule)
+
+	db.Delete(&models.Feed{}, 3)
+	stored = nil
+	db.Unscoped().Order("id").Find(&stored)
+	assert.True(t, Diff(stored, definitions()).Empty(), "deleted feeds are not paused")
+}
@@ -0,0 +1,57 @@
+package feedurl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Normalize returns the canonical form of a feed URL: lower case scheme and
+// host, no default port, no fragment and no lone "/" path
+func Normalize(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("feed url %q is not absolute", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "/" {
+		u.Path, u.RawPath = "", ""
+	}
+	return u.String(), nil
+}
+
+// Key identifies a feed by its URL. It is the SHA-256 of the normalized URL,
+// or of the trimmed URL when it cannot be normalized, so that it fits an index
+// whatever the length of the URL.
+func Key(raw string) string {
+	normalized, err := Normalize(raw)
+	if err != nil {
+		normalized = strings.TrimSpace(raw)
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// Same reports whether two URLs point to the same feed
+func Same(a, b string) bool {
+	return Key(a) == Key(b)
+}
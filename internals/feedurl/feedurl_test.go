@@ -0,0 +1,31 @@
+package feedurl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	for raw, want := range map[string]string{
+		" HTTPS://Example.COM:443/Feed.xml#top ": "https://example.com/Feed.xml",
+		"http://example.com:80/":                 "http://example.com",
+		"http://example.com:8080/rss?page=1":     "http://example.com:8080/rss?page=1",
+		"http://[::1]:80/rss":                    "http://[::1]/rss",
+	} {
+		got, err := Normalize(raw)
+		assert.NoError(t, err, raw)
+		assert.Equal(t, want, got, raw)
+	}
+
+	_, err := Normalize("example.com/rss")
+	assert.Error(t, err)
+}
+
+func TestKey(t *testing.T) {
+	assert.True(t, Same("https://Example.com/rss#latest", "https://example.com:443/rss"))
+	assert.False(t, Same("https://example.com/rss", "http://example.com/rss"))
+	assert.False(t, Same("https://example.com/rss", "https://example.com/RSS"))
+	assert.Len(t, Key("not a url"), 64)
+	assert.Equal(t, Key("not a url"), Key(" not a url "))
+}
@@ -0,0 +1,188 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tracker follows the service loop and the running downloads
+type Tracker struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	lastBeat  time.Time
+	nextID    int
+	downloads map[int]download
+}
+
+type download struct {
+	url     string
+	started time.Time
+}
+
+// NewTracker creates a tracker, the loop counts as alive from now on
+func NewTracker() *Tracker {
+	return newTracker(time.Now)
+}
+
+func newTracker(now func() time.Time) *Tracker {
+	return &Tracker{now: now, lastBeat: now(), downloads: map[int]download{}}
+}
+
+// Beat records an iteration of the service loop
+func (t *Tracker) Beat() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastBeat = t.now()
+}
+
+// SinceBeat returns the time elapsed since the last loop iteration
+func (t *Tracker) SinceBeat() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.now().Sub(t.lastBeat)
+}
+
+// StartDownload records a running download, call the returned function when it ends
+func (t *Tracker) StartDownload(url string) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.nextID
+	t.nextID++
+	t.downloads[id] = download{url: url, started: t.now()}
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.downloads, id)
+	}
+}
+
+// Downloads returns the URLs of the running downloads
+func (t *Tracker) Downloads() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	urls := make([]string, 0, len(t.downloads))
+	for _, d := range t.downloads {
+		urls = append(urls, d.url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Stuck returns the URLs of the downloads running for longer than max
+func (t *Tracker) Stuck(max time.Duration) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var stuck []string
+	for _, d := range t.downloads {
+		if t.now().Sub(d.started) > max {
+			stuck = append(stuck, d.url)
+		}
+	}
+	sort.Strings(stuck)
+	return stuck
+}
+
+// Check is one probe reported by a Handler
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// LoopCheck fails when the service loop has not iterated for longer than max
+func LoopCheck(t *Tracker, max time.Duration) Check {
+	return Check{Name: "loop", Run: func(context.Context) error {
+		if since := t.SinceBeat(); since > max {
+			return fmt.Errorf("no loop iteration for %s", since.Round(time.Second))
+		}
+		return nil
+	}}
+}
+
+// DownloadCheck fails when a download runs for longer than max
+func DownloadCheck(t *Tracker, max time.Duration) Check {
+	return Check{Name: "downloads", Run: func(context.Context) error {
+		if stuck := t.Stuck(max); len(stuck) > 0 {
+			return fmt.Errorf("download stuck for more than %s: %v", max, stuck)
+		}
+		return nil
+	}}
+}
+
+// DatabaseCheck pings the database
+func DatabaseCheck(db *gorm.DB) Check {
+	return Check{Name: "database", Run: func(ctx context.Context) error {
+		if db == nil {
+			return errors.New("database connection is nil")
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}}
+}
+
+// CachedCheck runs check at most once per ttl, probes in between get the
+// last result. It keeps probes from hammering external APIs.
+func CachedCheck(check Check, ttl time.Duration) Check {
+	var (
+		mu      sync.Mutex
+		checked time.Time
+		last    error
+	)
+	return Check{Name: check.Name, Run: func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			return last
+		}
+		last = check.Run(ctx)
+		checked = time.Now()
+		return last
+	}}
+}
+
+type checkResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type report struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// Handler runs the checks on every request and answers 200 when they all
+// pass, 503 otherwise, with the results as JSON
+func Handler(timeout time.Duration, checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		rep := report{Status: "ok"}
+		for _, check := range checks {
+			result := checkResult{Name: check.Name, OK: true}
+			if err := check.Run(ctx); err != nil {
+				result.OK = false
+				result.Error = err.Error()
+				rep.Status = "fail"
+			}
+			rep.Checks = append(rep.Checks, result)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if rep.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(rep)
+	})
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func TestTracker(t *testing.T) {
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tracker := newTracker(c.now)
+	loop := LoopCheck(tracker, 15*time.Minute)
+	downloads := DownloadCheck(tracker, 10*time.Minute)
+
+	c.t = c.t.Add(10 * time.Minute)
+	assert.NoError(t, loop.Run(context.Background()))
+	c.t = c.t.Add(10 * time.Minute)
+	assert.ErrorContains(t, loop.Run(context.Background()), "no loop iteration for 20m0s")
+	tracker.Beat()
+	assert.NoError(t, loop.Run(context.Background()))
+
+	done := tracker.StartDownload("http://example.com/slow.mp3")
+	finished := tracker.StartDownload("http://example.com/fast.mp3")
+	assert.Equal(t, []string{"http://example.com/fast.mp3", "http://example.com/slow.mp3"}, tracker.Downloads())
+	finished()
+	assert.Equal(t, []string{"http://example.com/slow.mp3"}, tracker.Downloads())
+	c.t = c.t.Add(11 * time.Minute)
+	assert.ErrorContains(t, downloads.Run(context.Background()), "slow.mp3")
+	assert.Equal(t, []string{"http://example.com/slow.mp3"}, tracker.Stuck(10*time.Minute))
+	done()
+	assert.NoError(t, downloads.Run(context.Background()))
+}
+
+func TestCachedCheck(t *testing.T) {
+	calls := 0
+	check := CachedCheck(Check{Name: "telegram", Run: func(context.Context) error {
+		calls++
+		return errors.New("unreachable")
+	}}, time.Hour)
+
+	assert.Error(t, check.Run(context.Background()))
+	assert.Error(t, check.Run(context.Background()))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "telegram", check.Name)
+}
+
+func TestHandler(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	failing := Check{Name: "telegram", Run: func(context.Context) error { return errors.New("unauthorized") }}
+
+	rec := httptest.NewRecorder()
+	Handler(time.Second, DatabaseCheck(db)).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":[{"name":"database","ok":true}]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	Handler(time.Second, DatabaseCheck(db), failing).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var rep report
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rep))
+	assert.Equal(t, "fail", rep.Status)
+	assert.Equal(t, checkResult{Name: "telegram", Error: "unauthorized"}, rep.Checks[1])
+
+	rec = httptest.NewRecorder()
+	Handler(time.Second, DatabaseCheck(nil)).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
@@ -0,0 +1,170 @@
+package items
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+// Rejection explains why a fetched item was not stored
+type Rejection struct {
+	Title  string
+	Reason string
+}
+
+// IngestReport counts what Ingest did with the fetched items of a feed
+type IngestReport struct {
+	Created  int
+	Updated  int
+	Rejected []Rejection
+	// Unsized lists the stored enclosures the feed gave no length for, see
+	// SetEnclosureLength
+	Unsized []models.Enclosure
+}
+
+// refreshedColumns are overwritten when a stored item changed upstream, the
+// publication state is never touched
+var refreshedColumns = []string{
+	"description", "content", "link", "updated", "updated_parsed", "published", "published_parsed",
+	"itunes_author", "itunes_block", "itunes_duration", "itunes_explicit", "itunes_keywords",
+	"itunes_subtitle", "itunes_summary", "itunes_image", "itunes_is_closed_captioned",
+	"itunes_episode", "itunes_season", "itunes_order", "itunes_episode_type",
+	"chapters_url", "chapters_type", "podcast_season", "podcast_episode",
+}
+
+// Ingest stores the fetched items of a feed together with their enclosures
+// in a single transaction. Items are matched on feed and title; stored items
+// get missing enclosures added and their metadata, transcripts and persons
+// refreshed when the feed reports a new update time. Items without a title or without any enclosure
+// are rejected instead of being queued for publication. On error nothing
+// is stored.
+func Ingest(db *gorm.DB, feedID uint, fetched []models.Item) (IngestReport, error) {
+	var report IngestReport
+	if db == nil {
+		return report, errors.New("database connection is nil")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		report = IngestReport{}
+		for _, item := range fetched {
+			if reason := rejectReason(item); reason != "" {
+				report.Rejected = append(report.Rejected, Rejection{Title: item.Title, Reason: reason})
+				continue
+			}
+			enclosures := item.Enclosures
+			transcripts, persons := item.Transcripts, item.Persons
+			item.Enclosures, item.Transcripts, item.Persons = nil, nil, nil
+			item.FeedId = int(feedID)
+
+			var existing models.Item
+			err := tx.Where("feed_id = ? AND title = ?", feedID, item.Title).First(&existing).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				item.TgPublished = models.ItemPending
+				if err := tx.Create(&item).Error; err != nil {
+					return err
+				}
+				if _, err := addEnclosures(tx, item.ID, enclosures, &report); err != nil {
+					return err
+				}
+				if err := replacePodcast(tx, item.ID, transcripts, persons); err != nil {
+					return err
+				}
+				report.Created++
+			case err != nil:
+				return err
+			default:
+				refreshed := item.Updated != "" && item.Updated != existing.Updated
+				if refreshed {
+					if err := tx.Model(&existing).Select(refreshedColumns).Updates(&item).Error; err != nil {
+						return err
+					}
+					if err := replacePodcast(tx, existing.ID, transcripts, persons); err != nil {
+						return err
+					}
+				}
+				added, err := addEnclosures(tx, existing.ID, enclosures, &report)
+				if err != nil {
+					return err
+				}
+				if refreshed || added > 0 {
+					report.Updated++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return IngestReport{}, err
+	}
+	return report, nil
+}
+
+func rejectReason(item models.Item) string {
+	if strings.TrimSpace(item.Title) == "" {
+		return "missing title"
+	}
+	if len(item.Enclosures) == 0 {
+		return "no enclosure"
+	}
+	return ""
+}
+
+// addEnclosures stores the enclosures the item does not have yet and
+// returns how many were added, the ones without a length go to report.Unsized
+func addEnclosures(tx *gorm.DB, itemID uint, enclosures []models.Enclosure, report *IngestReport) (int, error) {
+	added := 0
+	for _, enc := range enclosures {
+		var count int64
+		if err := tx.Model(&models.Enclosure{}).Where("item_id = ? AND url = ?", itemID, enc.Url).Count(&count).Error; err != nil {
+			return added, err
+		}
+		if count > 0 {
+			continue
+		}
+		enc.ItemId = itemID
+		if err := tx.Create(&enc).Error; err != nil {
+			return added, err
+		}
+		if enc.Length == 0 {
+			report.Unsized = append(report.Unsized, enc)
+		}
+		added++
+	}
+	return added, nil
+}
+
+// SetEnclosureLength stores the size of an enclosure found after ingestion
+func SetEnclosureLength(db *gorm.DB, id uint, length uint64) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	return db.Model(&models.Enclosure{}).Where("id = ?", id).Update("length", length).Error
+}
+
+// replacePodcast stores the transcripts and persons of an item in place of
+// the ones it had
+func replacePodcast(tx *gorm.DB, itemID uint, transcripts []models.Transcript, persons []models.Person) error {
+	if err := tx.Where("item_id = ?", itemID).Delete(&models.Transcript{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("item_id = ?", itemID).Delete(&models.Person{}).Error; err != nil {
+		return err
+	}
+	for _, transcript := range transcripts {
+		transcript.ItemId = itemID
+		if err := tx.Create(&transcript).Error; err != nil {
+			return err
+		}
+	}
+	for _, person := range persons {
+		person.ItemId = itemID
+		if err := tx.Create(&person).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
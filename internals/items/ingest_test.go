@@ -0,0 +1,136 @@
+package items
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newFileDB uses a file because every connection to an in-memory sqlite
+// database gets an empty one, which breaks transactions
+func newFileDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "echopan.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Item{}, &models.Enclosure{}, &models.Transcript{}, &models.Person{})
+	return db
+}
+
+func episode(title, updated string, urls ...string) models.Item {
+	item := models.Item{Title: title, Updated: updated}
+	for _, url := range urls {
+		item.Enclosures = append(item.Enclosures, models.Enclosure{Url: url, Length: 10, Type: "audio/mpeg"})
+	}
+	return item
+}
+
+func TestIngest_Report(t *testing.T) {
+	db := newFileDB(t)
+	db.Create(&models.Item{Title: "Old", FeedId: 1, Updated: "Mon", TgPublished: models.ItemPublished})
+	db.Create(&models.Item{Title: "Bare", FeedId: 1, Updated: "Mon"})
+
+	report, err := Ingest(db, 1, []models.Item{
+		episode("New", "Tue", "http://example.com/new.mp3"),
+		episode("Old", "Mon", "http://example.com/old.mp3"),
+		episode("Bare", "Tue", "http://example.com/bare.mp3"),
+		episode("Empty", "Tue"),
+		episode(" ", "Tue", "http://example.com/untitled.mp3"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, report.Updated)
+	assert.Equal(t, []Rejection{{Title: "Empty", Reason: "no enclosure"}, {Title: " ", Reason: "missing title"}}, report.Rejected)
+
+	var old models.Item
+	db.Preload("Enclosures").Where("title = ?", "Old").First(&old)
+	assert.Equal(t, models.ItemPublished, old.TgPublished, "ingestion keeps the publication state")
+	assert.Len(t, old.Enclosures, 1)
+
+	var created models.Item
+	db.Preload("Enclosures").Where("title = ?", "New").First(&created)
+	assert.Equal(t, 1, created.FeedId)
+	assert.Equal(t, models.ItemPending, created.TgPublished)
+	assert.Len(t, created.Enclosures, 1)
+
+	var count int64
+	db.Model(&models.Item{}).Where("title = ?", "Empty").Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestIngest_Unsized(t *testing.T) {
+	db := newFileDB(t)
+	unsized := models.Item{Title: "New", Enclosures: []models.Enclosure{{Url: "http://example.com/new.mp3"}}}
+
+	report, err := Ingest(db, 1, []models.Item{unsized, episode("Sized", "", "http://example.com/sized.mp3")})
+	assert.NoError(t, err)
+	if assert.Len(t, report.Unsized, 1) {
+		assert.Equal(t, "http://example.com/new.mp3", report.Unsized[0].Url)
+		assert.NotZero(t, report.Unsized[0].ID)
+		assert.NoError(t, SetEnclosureLength(db, report.Unsized[0].ID, 99))
+	}
+
+	report, err = Ingest(db, 1, []models.Item{unsized})
+	assert.NoError(t, err)
+	assert.Empty(t, report.Unsized, "stored enclosures are not sized again")
+
+	var enc models.Enclosure
+	db.Where("url = ?", "http://example.com/new.mp3").First(&enc)
+	assert.Equal(t, uint64(99), enc.Length)
+}
+
+func TestIngest_PodcastNamespace(t *testing.T) {
+	db := newFileDB(t)
+	item := episode("Episode", "Mon", "http://example.com/1.mp3")
+	item.Persons = []models.Person{{Name: "Jane", Role: "host"}}
+	item.Transcripts = []models.Transcript{{Url: "http://example.com/1.vtt"}}
+	_, err := Ingest(db, 1, []models.Item{item})
+	assert.NoError(t, err)
+
+	item.Updated = "Tue"
+	item.Persons = []models.Person{{Name: "Jane", Role: "host"}, {Name: "Joe", Role: "guest"}}
+	_, err = Ingest(db, 1, []models.Item{item})
+	assert.NoError(t, err)
+
+	var stored models.Item
+	db.Where("title = ?", "Episode").First(&stored)
+	assert.NoError(t, LoadPodcast(db, &stored))
+	if assert.Len(t, stored.Persons, 2, "the persons are replaced on refresh") {
+		assert.Equal(t, "Joe", stored.Persons[1].Name)
+	}
+	assert.Len(t, stored.Transcripts, 1)
+	assert.Error(t, LoadPodcast(nil, &stored))
+}
+
+func TestIngest_Idempotent(t *testing.T) {
+	db := newFileDB(t)
+	fetched := []models.Item{episode("Episode", "Tue", "http://example.com/1.mp3")}
+
+	_, err := Ingest(db, 1, fetched)
+	assert.NoError(t, err)
+	report, err := Ingest(db, 1, fetched)
+	assert.NoError(t, err)
+	assert.Equal(t, IngestReport{}, report)
+
+	var items, enclosures int64
+	db.Model(&models.Item{}).Count(&items)
+	db.Model(&models.Enclosure{}).Count(&enclosures)
+	assert.Equal(t, int64(1), items)
+	assert.Equal(t, int64(1), enclosures)
+}
+
+func TestIngest_RollsBackOnError(t *testing.T) {
+	db := newFileDB(t)
+	db.Migrator().DropTable(&models.Enclosure{})
+
+	_, err := Ingest(db, 1, []models.Item{episode("Episode", "Tue", "http://example.com/1.mp3")})
+	assert.Error(t, err)
+
+	var count int64
+	db.Model(&models.Item{}).Count(&count)
+	assert.Zero(t, count, "the item is not kept without its enclosures")
+}
@@ -0,0 +1,156 @@
+package items
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+// ErrItemNotFound is returned when no item matches the given id
+var ErrItemNotFound = errors.New("item not found")
+
+var stateNames = map[int]string{
+	models.ItemPending:   "pending",
+	models.ItemPublished: "published",
+	models.ItemSkipped:   "skipped",
+	models.ItemFailed:    "failed",
+}
+
+// StateName returns the human readable name of a publication state
+func StateName(state int) string {
+	if name, ok := stateNames[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", state)
+}
+
+// ParseState converts a state name into the value stored in Item.TgPublished
+func ParseState(name string) (int, error) {
+	for state, n := range stateNames {
+		if n == name {
+			return state, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown item state %q", name)
+}
+
+// Filter selects the items returned by List
+type Filter struct {
+	FeedID uint
+	// State restricts the result to one publication state, nil means any state
+	State *int
+	// Limit caps the number of items, 0 means no cap
+	Limit int
+}
+
+// List retrieves items matching the filter, newest episodes first
+func List(db *gorm.DB, filter Filter) ([]models.Item, error) {
+	if db == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	query := db.Order("published_parsed desc").Order("id desc")
+	if filter.FeedID != 0 {
+		query = query.Where("feed_id = ?", filter.FeedID)
+	}
+	if filter.State != nil {
+		query = query.Where("tg_published = ?", *filter.State)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var items []models.Item
+	if err := query.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Get retrieves an item by id together with its enclosures
+func Get(db *gorm.DB, id uint) (models.Item, error) {
+	if db == nil {
+		return models.Item{}, errors.New("database connection is nil")
+	}
+
+	var item models.Item
+	err := db.Preload("Enclosures").First(&item, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Item{}, ErrItemNotFound
+	}
+	return item, err
+}
+
+// LoadPodcast loads the transcripts and persons of an item
+func LoadPodcast(db *gorm.DB, item *models.Item) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	item.Transcripts, item.Persons = nil, nil
+	if err := db.Where("item_id = ?", item.ID).Order("id asc").Find(&item.Transcripts).Error; err != nil {
+		return err
+	}
+	return db.Where("item_id = ?", item.ID).Order("id asc").Find(&item.Persons).Error
+}
+
+// SetState changes the publication state of an item and clears its last
+// error and skip reason
+func SetState(db *gorm.DB, id uint, state int) error {
+	if _, ok := stateNames[state]; !ok {
+		return fmt.Errorf("unknown item state %d", state)
+	}
+	return setState(db, id, state, nil)
+}
+
+// SetFailed moves an item to the failed state, keeping the reason
+func SetFailed(db *gorm.DB, id uint, reason string) error {
+	return setState(db, id, models.ItemFailed, map[string]interface{}{"last_error": reason})
+}
+
+// Skip moves an item to the skipped state, keeping the filter rule that skipped it
+func Skip(db *gorm.DB, id uint, reason string) error {
+	return setState(db, id, models.ItemSkipped, map[string]interface{}{"skip_reason": reason})
+}
+
+// Publish moves an item to the published state, keeping its Telegram message
+// and the time of the publication
+func Publish(db *gorm.DB, id uint, messageID int, at time.Time) error {
+	return setState(db, id, models.ItemPublished, map[string]interface{}{"tg_message_id": messageID, "tg_published_at": at})
+}
+
+// Recent retrieves the last published items, newest publication first.
+// Items published before their publication time was stored are left out.
+func Recent(db *gorm.DB, limit int) ([]models.Item, error) {
+	if db == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	var list []models.Item
+	err := db.Where("tg_published = ? AND tg_published_at IS NOT NULL", models.ItemPublished).
+		Order("tg_published_at desc").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// setState changes the state of an item together with the given fields, the
+// last error and skip reason are cleared unless fields sets them
+func setState(db *gorm.DB, id uint, state int, fields map[string]interface{}) error {
+	if db == nil {
+		return errors.New("database connection is nil")
+	}
+
+	updates := map[string]interface{}{"tg_published": state, "last_error": "", "skip_reason": ""}
+	for column, value := range fields {
+		updates[column] = value
+	}
+	result := db.Model(&models.Item{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
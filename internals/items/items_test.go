@@ -0,0 +1,143 @@
+package items
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Item{}, &models.Enclosure{})
+	return db
+}
+
+func TestParseState(t *testing.T) {
+	for _, state := range []int{models.ItemPending, models.ItemPublished, models.ItemSkipped} {
+		parsed, err := ParseState(StateName(state))
+		assert.NoError(t, err)
+		assert.Equal(t, state, parsed)
+	}
+	_, err := ParseState("bogus")
+	assert.Error(t, err)
+	assert.Equal(t, "unknown(9)", StateName(9))
+}
+
+func TestList_Filters(t *testing.T) {
+	db := newTestDB(t)
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	db.Create(&models.Item{Title: "Old", FeedId: 1, PublishedParsed: &older})
+	db.Create(&models.Item{Title: "New", FeedId: 1, PublishedParsed: &newer})
+	db.Create(&models.Item{Title: "Done", FeedId: 1, TgPublished: models.ItemPublished, PublishedParsed: &older})
+	db.Create(&models.Item{Title: "Other", FeedId: 2})
+
+	all, err := List(db, Filter{FeedID: 1})
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	pending := models.ItemPending
+	queued, err := List(db, Filter{FeedID: 1, State: &pending})
+	assert.NoError(t, err)
+	if assert.Len(t, queued, 2) {
+		assert.Equal(t, "New", queued[0].Title)
+		assert.Equal(t, "Old", queued[1].Title)
+	}
+
+	limited, err := List(db, Filter{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, limited, 1)
+}
+
+func TestGet_WithEnclosures(t *testing.T) {
+	db := newTestDB(t)
+	item := models.Item{Title: "Episode"}
+	db.Create(&item)
+	db.Create(&models.Enclosure{ItemId: item.ID, Url: "http://example.com/e.mp3", Length: 10, Type: "audio/mpeg"})
+
+	got, err := Get(db, item.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, got.Enclosures, 1) {
+		assert.Equal(t, "http://example.com/e.mp3", got.Enclosures[0].Url)
+	}
+
+	_, err = Get(db, item.ID+1)
+	assert.ErrorIs(t, err, ErrItemNotFound)
+}
+
+func TestSetState(t *testing.T) {
+	db := newTestDB(t)
+	item := models.Item{Title: "Episode", TgPublished: models.ItemPublished}
+	db.Create(&item)
+
+	assert.NoError(t, SetState(db, item.ID, models.ItemPending))
+	got, _ := Get(db, item.ID)
+	assert.Equal(t, models.ItemPending, got.TgPublished)
+
+	assert.NoError(t, SetState(db, item.ID, models.ItemSkipped))
+	got, _ = Get(db, item.ID)
+	assert.Equal(t, models.ItemSkipped, got.TgPublished)
+
+	assert.NoError(t, SetFailed(db, item.ID, "Forbidden: bot is not a member of the channel chat"))
+	got, _ = Get(db, item.ID)
+	assert.Equal(t, models.ItemFailed, got.TgPublished)
+	assert.Equal(t, "Forbidden: bot is not a member of the channel chat", got.LastError)
+
+	assert.NoError(t, SetState(db, item.ID, models.ItemPending))
+	got, _ = Get(db, item.ID)
+	assert.Empty(t, got.LastError, "requeueing clears the error")
+
+	assert.NoError(t, Skip(db, item.ID, "episode type trailer"))
+	got, _ = Get(db, item.ID)
+	assert.Equal(t, models.ItemSkipped, got.TgPublished)
+	assert.Equal(t, "episode type trailer", got.SkipReason)
+
+	assert.NoError(t, SetState(db, item.ID, models.ItemPending))
+	got, _ = Get(db, item.ID)
+	assert.Empty(t, got.SkipReason)
+
+	assert.Error(t, SetState(db, item.ID, 42))
+	assert.ErrorIs(t, SetState(db, item.ID+1, models.ItemPending), ErrItemNotFound)
+}
+
+func TestPublish_Recent(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, title := range []string{"Old", "First", "Second", "Pending"} {
+		db.Create(&models.Item{Title: title})
+	}
+	db.Model(&models.Item{}).Where("id = ?", 1).Update("tg_published", models.ItemPublished)
+	assert.NoError(t, Publish(db, 2, 10, now))
+	assert.NoError(t, Publish(db, 3, 11, now.Add(time.Hour)))
+	assert.ErrorIs(t, Publish(db, 9, 12, now), ErrItemNotFound)
+
+	got, _ := Get(db, 2)
+	assert.Equal(t, models.ItemPublished, got.TgPublished)
+	assert.Equal(t, 10, got.TgMessageId)
+
+	recent, err := Recent(db, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, recent, 2, "items without a publication time are left out") {
+		assert.Equal(t, "Second", recent[0].Title)
+		assert.Equal(t, "First", recent[1].Title)
+	}
+	recent, _ = Recent(db, 1)
+	assert.Len(t, recent, 1)
+}
+
+func TestNilDB(t *testing.T) {
+	_, err := List(nil, Filter{})
+	assert.Error(t, err)
+	_, err = Get(nil, 1)
+	assert.Error(t, err)
+	assert.Error(t, SetState(nil, 1, models.ItemPending))
+	_, err = Recent(nil, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Field keys shared by the log lines of the fetch, download and publish
+// steps, so an episode can be followed end to end
+const (
+	FeedID       = "feed_id"
+	ItemID       = "item_id"
+	EnclosureURL = "enclosure_url"
+	ChatID       = "chat_id"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel reads a level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// ValidFormat reports whether format is a known output format
+func ValidFormat(format string) bool {
+	return format == FormatText || format == FormatJSON
+}
+
+// New creates a logger writing to w in the given format from the given level on
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
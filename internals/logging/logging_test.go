@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, FormatJSON, "warn")
+	assert.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.Warn("Episode published", FeedID, 3, ItemID, 12)
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "WARN", line["level"])
+	assert.Equal(t, "Episode published", line["msg"])
+	assert.Equal(t, 3.0, line[FeedID])
+	assert.Equal(t, 12.0, line[ItemID])
+
+	out.Reset()
+	logger, err = New(&out, FormatText, "debug")
+	assert.NoError(t, err)
+	logger.Debug("Fetching feed", FeedID, 3)
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"Fetching feed\" feed_id=3")
+
+	_, err = New(&out, "xml", "info")
+	assert.Error(t, err)
+	_, err = New(&out, FormatText, "loud")
+	assert.Error(t, err)
+
+	level, err := ParseLevel("ERROR")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelError, level)
+}
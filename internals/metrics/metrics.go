@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Telegram send error classes
+const (
+	SendErrorTooLarge = "too_large"
+	SendErrorEncoding = "encoding"
+	SendErrorOther    = "other"
+)
+
+// Metrics holds the Prometheus collectors of echopan. Every feed labelled
+// series uses the feed id, titles change too often to be label values.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	feedFetches       *prometheus.CounterVec
+	feedFetchDuration *prometheus.HistogramVec
+	itemsIngested     *prometheus.CounterVec
+	episodesPublished *prometheus.CounterVec
+	lastPublish       *prometheus.GaugeVec
+	downloadBytes     prometheus.Histogram
+	downloadDuration  prometheus.Histogram
+	sendDuration      prometheus.Histogram
+	sendErrors        *prometheus.CounterVec
+	queueDepth        *prometheus.GaugeVec
+}
+
+// New registers the echopan collectors, with the Go runtime and process ones,
+// on a registry of their own
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		feedFetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "echopan_feed_fetches_total",
+			Help: "Feed fetches by feed and result.",
+		}, []string{"feed", "result"}),
+		feedFetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "echopan_feed_fetch_duration_seconds",
+			Help:    "Time spent fetching a feed, all pages included.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+		}, []string{"feed"}),
+		itemsIngested: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "echopan_items_ingested_total",
+			Help: "Fetched items by feed and ingestion outcome: created, updated or rejected.",
+		}, []string{"feed", "outcome"}),
+		episodesPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "echopan_episodes_published_total",
+			Help: "Episodes published to Telegram by feed.",
+		}, []string{"feed"}),
+		lastPublish: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "echopan_last_publish_timestamp_seconds",
+			Help: "Unix time of the last successful publication by feed.",
+		}, []string{"feed"}),
+		downloadBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "echopan_episode_download_bytes",
+			Help:    "Size of the downloaded episode files.",
+			Buckets: prometheus.ExponentialBuckets(1<<20, 2, 10),
+		}),
+		downloadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "echopan_episode_download_duration_seconds",
+			Help:    "Time spent downloading an episode file.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+		}),
+		sendDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "echopan_telegram_send_duration_seconds",
+			Help:    "Time spent sending an episode to Telegram.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+		}),
+		sendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "echopan_telegram_send_errors_total",
+			Help: "Failed Telegram sends by error class: too_large, encoding or other.",
+		}, []string{"class"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "echopan_queue_depth",
+			Help: "Pending items waiting to be published by feed.",
+		}, []string{"feed"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.feedFetches, m.feedFetchDuration, m.itemsIngested, m.episodesPublished, m.lastPublish,
+		m.downloadBytes, m.downloadDuration, m.sendDuration, m.sendErrors, m.queueDepth,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Registry exposes the registry, mostly for tests
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+func feedLabel(feedID uint) string {
+	return strconv.FormatUint(uint64(feedID), 10)
+}
+
+// FeedFetched records a feed fetch that took d
+func (m *Metrics) FeedFetched(feedID uint, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.feedFetches.WithLabelValues(feedLabel(feedID), result).Inc()
+	m.feedFetchDuration.WithLabelValues(feedLabel(feedID)).Observe(d.Seconds())
+}
+
+// ItemsIngested records the outcome of an ingestion
+func (m *Metrics) ItemsIngested(feedID uint, created, updated, rejected int) {
+	m.itemsIngested.WithLabelValues(feedLabel(feedID), "created").Add(float64(created))
+	m.itemsIngested.WithLabelValues(feedLabel(feedID), "updated").Add(float64(updated))
+	m.itemsIngested.WithLabelValues(feedLabel(feedID), "rejected").Add(float64(rejected))
+}
+
+// EpisodePublished records a successful publication at t
+func (m *Metrics) EpisodePublished(feedID uint, t time.Time) {
+	m.episodesPublished.WithLabelValues(feedLabel(feedID)).Inc()
+	m.lastPublish.WithLabelValues(feedLabel(feedID)).Set(float64(t.Unix()))
+}
+
+// EpisodeDownloaded records a downloaded episode file
+func (m *Metrics) EpisodeDownloaded(bytes int64, d time.Duration) {
+	m.downloadBytes.Observe(float64(bytes))
+	m.downloadDuration.Observe(d.Seconds())
+}
+
+// TelegramSent records a Telegram send, class is empty when it succeeded
+func (m *Metrics) TelegramSent(d time.Duration, class string) {
+	m.sendDuration.Observe(d.Seconds())
+	if class != "" {
+		m.sendErrors.WithLabelValues(class).Inc()
+	}
+}
+
+// SetQueueDepth records the number of pending items of a feed
+func (m *Metrics) SetQueueDepth(feedID uint, pending int64) {
+	m.queueDepth.WithLabelValues(feedLabel(feedID)).Set(float64(pending))
+}
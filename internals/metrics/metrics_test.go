@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.FeedFetched(3, time.Second, nil)
+	m.FeedFetched(3, time.Second, errors.New("timeout"))
+	m.FeedFetched(3, time.Second, nil)
+	m.ItemsIngested(3, 2, 1, 4)
+	m.EpisodePublished(3, time.Unix(1700000000, 0))
+	m.TelegramSent(time.Second, "")
+	m.TelegramSent(time.Second, SendErrorTooLarge)
+	m.SetQueueDepth(3, 7)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.feedFetches.WithLabelValues("3", "success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.feedFetches.WithLabelValues("3", "failure")))
+	assert.Equal(t, 4.0, testutil.ToFloat64(m.itemsIngested.WithLabelValues("3", "rejected")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.episodesPublished.WithLabelValues("3")))
+	assert.Equal(t, 1700000000.0, testutil.ToFloat64(m.lastPublish.WithLabelValues("3")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.sendErrors.WithLabelValues(SendErrorTooLarge)))
+	assert.Equal(t, 7.0, testutil.ToFloat64(m.queueDepth.WithLabelValues("3")))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.EpisodeDownloaded(1<<20, time.Second)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	assert.Equal(t, 200, rec.Code)
+	assert.True(t, strings.Contains(string(body), "echopan_episode_download_bytes_count 1"))
+	assert.True(t, strings.Contains(string(body), "go_goroutines"))
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"github.com/tutuna/echopan/internals/feedurl"
 	"gorm.io/gorm"
 	"time"
 )
@@ -10,8 +11,8 @@ type Image struct {
 	Url        string
 	Title      string
 	FeedId     int
-	FullImage  []byte `gorm:"type:bytea"`
-	SmallImage []byte `gorm:"type:bytea"`
+	FullImage  []byte
+	SmallImage []byte
 }
 
 type Feed struct {
@@ -28,4 +29,61 @@ type Feed struct {
 	LastPubDate      *time.Time
 	ExtraLinkEnabled bool `gorm:"default:false"`
 	ExtraLink        string
+	// CaptionTemplate replaces the default caption when set, see internals/caption
+	CaptionTemplate string
+	// Caption options, they shape the subtitle of the default caption and of templates.
+	// CaptionSource is subtitle, summary or description; CaptionMaxLength 0
+	// means publish.subtitle_limit; CaptionNumbers adds the season and episode
+	// numbers to the title of the default caption.
+	CaptionHideSubtitle bool   `gorm:"default:false"`
+	CaptionSource       string `gorm:"size:16"`
+	CaptionMaxLength    int    `gorm:"default:0"`
+	CaptionStripLinks   bool   `gorm:"default:false"`
+	CaptionNumbers      bool   `gorm:"default:false"`
+	// Schedule is the minimum time between two publications of the feed, as a Go duration
+	Schedule string `gorm:"size:64"`
+	// Fetch health, updated after every fetch, see feeds.RecordFetch
+	LastFetchAt         *time.Time
+	LastSuccessAt       *time.Time
+	ConsecutiveFailures int `gorm:"default:0"`
+	LastStatus          int `gorm:"default:0"`
+	LastFetchError      string
+	// Quarantined feeds are no longer fetched until released
+	Quarantined bool `gorm:"default:false"`
+	// URLKey identifies the feed by its normalized URL, see internals/feedurl.
+	// It is kept in sync with Feed by BeforeSave.
+	URLKey *string `gorm:"size:64;uniqueIndex:idx_feeds_url_key"`
+	// PodcastGUID is the podcast:guid of the feed, when it has one
+	PodcastGUID string `gorm:"size:64;index"`
+	// Funding lists the podcast:funding links, refreshed on every fetch
+	Funding []Funding `gorm:"foreignKey:FeedId"`
+	// ShowNotes posts the full show notes, see internals/shownotes for the modes
+	ShowNotes string `gorm:"size:16"`
+	// Filter rules, the items they reject are skipped, see feeds.ParseRules
+	FilterInclude      string
+	FilterExclude      string
+	FilterEpisodeTypes string
+	FilterExplicit     bool   `gorm:"default:false"`
+	FilterMinDuration  string `gorm:"size:64"`
+	FilterMaxDuration  string `gorm:"size:64"`
+}
+
+// BeforeSave derives URLKey from the feed URL
+func (f *Feed) BeforeSave(tx *gorm.DB) error {
+	f.URLKey = nil
+	if f.Feed != "" {
+		key := feedurl.Key(f.Feed)
+		f.URLKey = &key
+	}
+	return nil
+}
+
+// FeedURLChange records a change of Feed.Feed
+type FeedURLChange struct {
+	gorm.Model
+	FeedId uint   `gorm:"not null;index"`
+	OldURL string `gorm:"size:2048"`
+	NewURL string `gorm:"size:2048"`
+	// Reason is redirect, new-feed-url or manual
+	Reason string `gorm:"size:32"`
 }
@@ -5,6 +5,14 @@ import (
 	"time"
 )
 
+// Publication states stored in Item.TgPublished
+const (
+	ItemPending   = 0
+	ItemPublished = 1
+	ItemSkipped   = 2
+	ItemFailed    = 3
+)
+
 type Enclosure struct {
 	gorm.Model
 	Url    string `gorm:"not null;size:2048"`
@@ -38,4 +46,18 @@ type Item struct {
 	ItunesSeason            string
 	ItunesOrder             string
 	ItunesEpisodeType       string
+	// LastError is the reason of the last failed publication
+	LastError string
+	// SkipReason is the filter rule that skipped the item, see feeds.Rules
+	SkipReason string
+	// TgMessageId and TgPublishedAt identify the Telegram message of a published item
+	TgMessageId   int        `gorm:"default:0"`
+	TgPublishedAt *time.Time `gorm:"index"`
+	// Podcast namespace, see models/podcast.go
+	ChaptersURL    string `gorm:"size:2048"`
+	ChaptersType   string `gorm:"size:255"`
+	PodcastSeason  string
+	PodcastEpisode string
+	Transcripts    []Transcript `gorm:"foreignKey:ItemId"`
+	Persons        []Person     `gorm:"foreignKey:ItemId"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import "gorm.io/gorm"
+
+// Transcript is a podcast:transcript of an item
+type Transcript struct {
+	gorm.Model
+	ItemId   uint   `gorm:"not null;index"`
+	Url      string `gorm:"not null;size:2048"`
+	Type     string `gorm:"size:255"`
+	Language string `gorm:"size:64"`
+	Rel      string `gorm:"size:32"`
+}
+
+// Person is a podcast:person credited on an item
+type Person struct {
+	gorm.Model
+	ItemId uint   `gorm:"not null;index"`
+	Name   string `gorm:"not null"`
+	Role   string `gorm:"size:64"`
+	Group  string `gorm:"size:64"`
+	Href   string `gorm:"size:2048"`
+	Img    string `gorm:"size:2048"`
+}
+
+// Funding is a podcast:funding link of a feed
+type Funding struct {
+	gorm.Model
+	FeedId uint   `gorm:"not null;index"`
+	Url    string `gorm:"not null;size:2048"`
+	Text   string
+}
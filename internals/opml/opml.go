@@ -0,0 +1,97 @@
+package opml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Outline is one podcast subscription
+type Outline struct {
+	Title   string
+	XMLURL  string
+	HTMLURL string
+}
+
+type document struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    head     `xml:"head"`
+	Body    body     `xml:"body"`
+}
+
+type head struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type body struct {
+	Outlines []outline `xml:"outline"`
+}
+
+type outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []outline `xml:"outline"`
+}
+
+// Parse reads the feed outlines of an OPML document. Podcast apps group
+// subscriptions in nested outlines, every outline with an xmlUrl is returned
+// in document order, duplicates removed.
+func Parse(r io.Reader) ([]Outline, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing opml: %w", err)
+	}
+	var result []Outline
+	seen := map[string]bool{}
+	var walk func([]outline)
+	walk = func(outlines []outline) {
+		for _, o := range outlines {
+			url := strings.TrimSpace(o.XMLURL)
+			if url != "" && !seen[url] {
+				seen[url] = true
+				title := o.Title
+				if title == "" {
+					title = o.Text
+				}
+				result = append(result, Outline{Title: strings.TrimSpace(title), XMLURL: url, HTMLURL: o.HTMLURL})
+			}
+			walk(o.Outlines)
+		}
+	}
+	walk(doc.Body.Outlines)
+	return result, nil
+}
+
+// Write renders the outlines as an OPML 2.0 document
+func Write(w io.Writer, title string, outlines []Outline, created time.Time) error {
+	doc := document{
+		Version: "2.0",
+		Head:    head{Title: title, DateCreated: created.UTC().Format(time.RFC1123Z)},
+	}
+	for _, o := range outlines {
+		doc.Body.Outlines = append(doc.Body.Outlines, outline{
+			Text:    o.Title,
+			Title:   o.Title,
+			Type:    "rss",
+			XMLURL:  o.XMLURL,
+			HTMLURL: o.HTMLURL,
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
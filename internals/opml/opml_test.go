@@ -0,0 +1,50 @@
+package opml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const exported = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+  <head><title>Podcasts</title></head>
+  <body>
+    <outline text="feeds">
+      <outline type="rss" text="First" xmlUrl="https://example.com/first.rss" htmlUrl="https://example.com/first"/>
+      <outline type="rss" text="Second text" title="Second" xmlUrl=" https://example.com/second.rss "/>
+    </outline>
+    <outline type="rss" text="First again" xmlUrl="https://example.com/first.rss"/>
+    <outline text="Folder without feeds"/>
+  </body>
+</opml>`
+
+func TestParse(t *testing.T) {
+	outlines, err := Parse(strings.NewReader(exported))
+	assert.NoError(t, err)
+	assert.Equal(t, []Outline{
+		{Title: "First", XMLURL: "https://example.com/first.rss", HTMLURL: "https://example.com/first"},
+		{Title: "Second", XMLURL: "https://example.com/second.rss"},
+	}, outlines)
+
+	_, err = Parse(strings.NewReader("<rss>"))
+	assert.Error(t, err)
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	outlines := []Outline{
+		{Title: "Tom & Jerry", XMLURL: "https://example.com/a.rss?x=1&y=2", HTMLURL: "https://example.com/a"},
+		{Title: "B", XMLURL: "https://example.com/b.rss"},
+	}
+	var out bytes.Buffer
+	assert.NoError(t, Write(&out, "echopan feeds", outlines, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.Contains(t, out.String(), `<opml version="2.0">`)
+	assert.Contains(t, out.String(), "<dateCreated>Tue, 02 Jan 2024 03:04:05 +0000</dateCreated>")
+
+	parsed, err := Parse(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, outlines, parsed)
+}
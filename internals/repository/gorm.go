@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/feedsync"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+type gormFeedRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormFeedRepo) All() ([]models.Feed, error) {
+	return feeds.GetAllFeeds(r.db)
+}
+
+func (r *gormFeedRepo) Ready() ([]models.Feed, error) {
+	return feeds.GetReadyFeeds(r.db)
+}
+
+func (r *gormFeedRepo) List(withDeleted bool) ([]models.Feed, error) {
+	return feeds.ListFeeds(r.db, withDeleted)
+}
+
+func (r *gormFeedRepo) Get(id uint) (models.Feed, error) {
+	return feeds.GetFeed(r.db, id)
+}
+
+func (r *gormFeedRepo) Resolve(selector string) (models.Feed, error) {
+	return feeds.Resolve(r.db, selector)
+}
+
+func (r *gormFeedRepo) FirstOrCreateByURL(feed models.Feed) (models.Feed, bool, error) {
+	existing, err := feeds.FindByURL(r.db, feed.Feed)
+	if err == nil || !errors.Is(err, feeds.ErrFeedNotFound) {
+		return existing, false, err
+	}
+	if feed.PodcastGUID != "" {
+		err := r.db.Unscoped().Where("podcast_guid = ?", feed.PodcastGUID).First(&existing).Error
+		if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+			return existing, false, err
+		}
+	}
+	if err := r.db.Create(&feed).Error; err != nil {
+		return models.Feed{}, false, err
+	}
+	return feed, true, nil
+}
+
+func (r *gormFeedRepo) Save(feed *models.Feed) error {
+	return r.db.Save(feed).Error
+}
+
+func (r *gormFeedRepo) Update(id uint, fields map[string]interface{}) error {
+	return feeds.UpdateFeed(r.db, id, fields)
+}
+
+func (r *gormFeedRepo) SetPublishReady(id uint, ready bool) error {
+	return feeds.SetPublishReady(r.db, id, ready)
+}
+
+func (r *gormFeedRepo) SetURL(id uint, url string) error {
+	return feeds.MoveFeed(r.db, id, url, feeds.MoveManual)
+}
+
+func (r *gormFeedRepo) Move(id uint, url, reason string) error {
+	return feeds.MoveFeed(r.db, id, url, reason)
+}
+
+func (r *gormFeedRepo) URLChanges(id uint) ([]models.FeedURLChange, error) {
+	return feeds.URLChanges(r.db, id)
+}
+
+func (r *gormFeedRepo) Delete(id uint) error {
+	return feeds.DeleteFeed(r.db, id)
+}
+
+func (r *gormFeedRepo) Restore(id uint) error {
+	return feeds.RestoreFeed(r.db, id)
+}
+
+func (r *gormFeedRepo) Stats(id uint) (feeds.Stats, error) {
+	return feeds.GetStats(r.db, id)
+}
+
+func (r *gormFeedRepo) RecordFetch(id uint, fetchErr error, now time.Time, policy feeds.HealthPolicy) (models.Feed, error) {
+	return feeds.RecordFetch(r.db, id, fetchErr, now, policy)
+}
+
+func (r *gormFeedRepo) Release(id uint) error {
+	return feeds.Release(r.db, id)
+}
+
+func (r *gormFeedRepo) Health(staleAfter time.Duration, now time.Time) ([]feeds.Health, error) {
+	return feeds.CheckHealth(r.db, staleAfter, now)
+}
+
+func (r *gormFeedRepo) UpdatePodcast(id uint, guid string, funding []models.Funding) error {
+	return feeds.UpdatePodcast(r.db, id, guid, funding)
+}
+
+func (r *gormFeedRepo) Funding(id uint) ([]models.Funding, error) {
+	return feeds.GetFunding(r.db, id)
+}
+
+func (r *gormFeedRepo) CreateImageIfMissing(image models.Image) error {
+	return r.db.Where(&models.Image{FeedId: image.FeedId}).FirstOrCreate(&models.Image{}, image).Error
+}
+
+func (r *gormFeedRepo) SetImage(image models.Image) error {
+	var stored models.Image
+	if err := r.db.Where(&models.Image{FeedId: image.FeedId}).Attrs(image).FirstOrCreate(&stored).Error; err != nil {
+		return err
+	}
+	if stored.Url == image.Url && stored.Title == image.Title {
+		return nil
+	}
+	return r.db.Model(&stored).Updates(map[string]interface{}{"url": image.Url, "title": image.Title}).Error
+}
+
+func (r *gormFeedRepo) Sync(plan feedsync.Plan) error {
+	return feedsync.Apply(r.db, plan)
+}
+
+type gormItemRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormItemRepo) List(filter items.Filter) ([]models.Item, error) {
+	return items.List(r.db, filter)
+}
+
+func (r *gormItemRepo) Get(id uint) (models.Item, error) {
+	return items.Get(r.db, id)
+}
+
+func (r *gormItemRepo) FirstUnpublished(feedID uint) (models.Item, error) {
+	var item models.Item
+	err := r.db.Where("feed_id = ? AND tg_published = ?", feedID, models.ItemPending).
+		Order("published_parsed asc").
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Item{}, items.ErrItemNotFound
+	}
+	return item, err
+}
+
+func (r *gormItemRepo) Unpublished(feedID uint) ([]models.Item, error) {
+	var list []models.Item
+	// sorted by published date from the oldest to the newest
+	err := r.db.Where(map[string]interface{}{"feed_id": int(feedID), "tg_published": models.ItemPending}).
+		Order("published_parsed asc").
+		Find(&list).Error
+	return list, err
+}
+
+func (r *gormItemRepo) SetState(id uint, state int) error {
+	return items.SetState(r.db, id, state)
+}
+
+func (r *gormItemRepo) Fail(id uint, reason string) error {
+	return items.SetFailed(r.db, id, reason)
+}
+
+func (r *gormItemRepo) Skip(id uint, reason string) error {
+	return items.Skip(r.db, id, reason)
+}
+
+func (r *gormItemRepo) Publish(id uint, messageID int, at time.Time) error {
+	return items.Publish(r.db, id, messageID, at)
+}
+
+func (r *gormItemRepo) Recent(limit int) ([]models.Item, error) {
+	return items.Recent(r.db, limit)
+}
+
+func (r *gormItemRepo) Ingest(feedID uint, fetched []models.Item) (items.IngestReport, error) {
+	return items.Ingest(r.db, feedID, fetched)
+}
+
+func (r *gormItemRepo) LoadPodcast(item *models.Item) error {
+	return items.LoadPodcast(r.db, item)
+}
+
+func (r *gormItemRepo) Known(feed models.Feed) func(item *gofeed.Item) bool {
+	return feeds.KnownItem(r.db, feed)
+}
+
+type gormEnclosureRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormEnclosureRepo) ForItem(itemID uint) ([]models.Enclosure, error) {
+	var enclosures []models.Enclosure
+	err := r.db.Where(&models.Enclosure{ItemId: itemID}).Order("id asc").Find(&enclosures).Error
+	return enclosures, err
+}
+
+func (r *gormEnclosureRepo) SetLength(id uint, length uint64) error {
+	return items.SetEnclosureLength(r.db, id, length)
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestRepos(t *testing.T) *Repos {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Image{}, &models.Item{}, &models.Enclosure{},
+		&models.Transcript{}, &models.Person{}, &models.Funding{})
+	return New(db)
+}
+
+func TestFeedRepo_FirstOrCreateByURL(t *testing.T) {
+	repos := newTestRepos(t)
+
+	created, isNew, err := repos.Feeds.FirstOrCreateByURL(models.Feed{Title: "Podcast", Feed: "http://example.com/rss"})
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+	assert.NotZero(t, created.ID)
+
+	again, isNew, err := repos.Feeds.FirstOrCreateByURL(models.Feed{Title: "Renamed", Feed: "HTTP://example.com:80/rss"})
+	assert.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, created.ID, again.ID)
+
+	other, isNew, err := repos.Feeds.FirstOrCreateByURL(models.Feed{Title: "Podcast", Feed: "http://other.example.com/rss", PodcastGUID: "guid"})
+	assert.NoError(t, err)
+	assert.True(t, isNew, "feeds sharing a title are distinct")
+	assert.NotEqual(t, created.ID, other.ID)
+
+	moved, isNew, err := repos.Feeds.FirstOrCreateByURL(models.Feed{Title: "Podcast", Feed: "http://moved.example.com/rss", PodcastGUID: "guid"})
+	assert.NoError(t, err)
+	assert.False(t, isNew, "the podcast:guid identifies the feed too")
+	assert.Equal(t, other.ID, moved.ID)
+
+	found, err := repos.Feeds.Resolve("http://example.com/rss")
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, found.ID)
+	_, err = repos.Feeds.Resolve("Missing")
+	assert.ErrorIs(t, err, feeds.ErrFeedNotFound)
+}
+
+func TestFeedRepo_CreateImageIfMissing(t *testing.T) {
+	repos := newTestRepos(t)
+	feed, _, _ := repos.Feeds.FirstOrCreateByURL(models.Feed{Title: "Podcast", Feed: "http://example.com/rss"})
+
+	assert.NoError(t, repos.Feeds.CreateImageIfMissing(models.Image{FeedId: int(feed.ID), Url: "http://example.com/a.png"}))
+	assert.NoError(t, repos.Feeds.CreateImageIfMissing(models.Image{FeedId: int(feed.ID), Url: "http://example.com/a.png"}))
+
+	var images []models.Image
+	repos.Feeds.(*gormFeedRepo).db.Find(&images)
+	if assert.Len(t, images, 1) {
+		assert.Equal(t, "http://example.com/a.png", images[0].Url)
+	}
+}
+
+func TestFeedRepo_SetImage(t *testing.T) {
+	repos := newTestRepos(t)
+	feed := models.Feed{Title: "Podcast", Feed: "http://example.com/rss", Schedule: "24h"}
+	db := repos.Feeds.(*gormFeedRepo).db
+	db.Create(&feed)
+
+	assert.NoError(t, repos.Feeds.SetImage(models.Image{FeedId: int(feed.ID), Url: "http://example.com/a.png"}))
+	// the feed changed after it was loaded, SetImage must not revert it
+	assert.NoError(t, repos.Feeds.Update(feed.ID, map[string]interface{}{"schedule": "1h"}))
+	assert.NoError(t, repos.Feeds.SetImage(models.Image{FeedId: int(feed.ID), Url: "http://example.com/b.png", Title: "B"}))
+
+	var images []models.Image
+	db.Find(&images)
+	if assert.Len(t, images, 1) {
+		assert.Equal(t, "http://example.com/b.png", images[0].Url)
+		assert.Equal(t, "B", images[0].Title)
+	}
+	stored, _ := repos.Feeds.Get(feed.ID)
+	assert.Equal(t, "1h", stored.Schedule)
+}
+
+func TestItemRepo_Queue(t *testing.T) {
+	repos := newTestRepos(t)
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	for _, item := range []models.Item{
+		{Title: "Skipped", FeedId: 1, TgPublished: models.ItemSkipped, PublishedParsed: &older},
+		{Title: "Newer", FeedId: 1, PublishedParsed: &newer},
+		{Title: "Older", FeedId: 1, PublishedParsed: &older},
+		{Title: "Published", FeedId: 1, TgPublished: models.ItemPublished, PublishedParsed: &older},
+	} {
+		assert.NoError(t, repos.Items.(*gormItemRepo).db.Create(&item).Error)
+	}
+
+	first, err := repos.Items.FirstUnpublished(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Older", first.Title, "skipped and published items are not queued")
+
+	queue, err := repos.Items.Unpublished(1)
+	assert.NoError(t, err)
+	if assert.Len(t, queue, 2) {
+		assert.Equal(t, "Older", queue[0].Title)
+		assert.Equal(t, "Newer", queue[1].Title)
+	}
+
+	_, err = repos.Items.FirstUnpublished(2)
+	assert.ErrorIs(t, err, items.ErrItemNotFound)
+}
+
+func TestItemRepo_Known(t *testing.T) {
+	repos := newTestRepos(t)
+	repos.Items.(*gormItemRepo).db.Create(&models.Item{Title: "Stored", FeedId: 1})
+
+	known := repos.Items.Known(models.Feed{Model: gorm.Model{ID: 1}})
+	assert.True(t, known(&gofeed.Item{Title: "Stored"}))
+	assert.False(t, known(&gofeed.Item{Title: "New"}))
+}
+
+func TestEnclosureRepo(t *testing.T) {
+	repos := newTestRepos(t)
+
+	db := repos.Enclosures.(*gormEnclosureRepo).db
+	db.Create(&models.Enclosure{ItemId: 1, Url: "http://example.com/1.mp3"})
+	db.Create(&models.Enclosure{ItemId: 1, Url: "http://example.com/1b.mp3"})
+
+	enclosures, err := repos.Enclosures.ForItem(1)
+	assert.NoError(t, err)
+	if assert.Len(t, enclosures, 2) {
+		assert.Equal(t, "http://example.com/1.mp3", enclosures[0].Url)
+	}
+	none, err := repos.Enclosures.ForItem(2)
+	assert.NoError(t, err)
+	assert.Empty(t, none)
+}
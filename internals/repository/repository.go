@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/tutuna/echopan/internals/feeds"
+	"github.com/tutuna/echopan/internals/feedsync"
+	"github.com/tutuna/echopan/internals/items"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/gorm"
+)
+
+// FeedRepo stores feeds and their images
+type FeedRepo interface {
+	All() ([]models.Feed, error)
+	Ready() ([]models.Feed, error)
+	List(withDeleted bool) ([]models.Feed, error)
+	Get(id uint) (models.Feed, error)
+	// Resolve finds a feed by id, url, podcast:guid or title, see feeds.Resolve
+	Resolve(selector string) (models.Feed, error)
+	// FirstOrCreateByURL returns the feed with the same normalized URL or
+	// podcast:guid, creating it when missing. created reports whether it is new.
+	FirstOrCreateByURL(feed models.Feed) (stored models.Feed, created bool, err error)
+	Save(feed *models.Feed) error
+	Update(id uint, fields map[string]interface{}) error
+	SetPublishReady(id uint, ready bool) error
+	// SetURL changes the feed URL by hand, the change is recorded
+	SetURL(id uint, url string) error
+	// Move follows the feed to its new location, the change is recorded
+	Move(id uint, url, reason string) error
+	URLChanges(id uint) ([]models.FeedURLChange, error)
+	Delete(id uint) error
+	Restore(id uint) error
+	Stats(id uint) (feeds.Stats, error)
+	// RecordFetch stores the outcome of a fetch and returns the updated feed
+	RecordFetch(id uint, fetchErr error, now time.Time, policy feeds.HealthPolicy) (models.Feed, error)
+	// Release lifts the quarantine of a feed
+	Release(id uint) error
+	Health(staleAfter time.Duration, now time.Time) ([]feeds.Health, error)
+	// UpdatePodcast stores the podcast:guid and funding links of a fetched feed
+	UpdatePodcast(id uint, guid string, funding []models.Funding) error
+	Funding(id uint) ([]models.Funding, error)
+	// Sync applies a feeds file plan in a single transaction, see feedsync.Apply
+	Sync(plan feedsync.Plan) error
+	// CreateImageIfMissing stores the image unless the feed already has one
+	CreateImageIfMissing(image models.Image) error
+	// SetImage stores the image of the feed, replacing the url and title of
+	// the one it has. The feed itself is not written.
+	SetImage(image models.Image) error
+}
+
+// ItemRepo stores feed items
+type ItemRepo interface {
+	List(filter items.Filter) ([]models.Item, error)
+	Get(id uint) (models.Item, error)
+	// FirstUnpublished returns the oldest pending item of the feed
+	FirstUnpublished(feedID uint) (models.Item, error)
+	// Unpublished returns the pending items of the feed, oldest first
+	Unpublished(feedID uint) ([]models.Item, error)
+	SetState(id uint, state int) error
+	// Fail moves the item to the failed state with the reason of the failure
+	Fail(id uint, reason string) error
+	// Skip moves the item to the skipped state with the filter rule that skipped it
+	Skip(id uint, reason string) error
+	// Publish moves the item to the published state with its Telegram message
+	Publish(id uint, messageID int, at time.Time) error
+	// Recent returns the last published items, newest publication first
+	Recent(limit int) ([]models.Item, error)
+	// Ingest stores the fetched items of a feed with their enclosures in one transaction
+	Ingest(feedID uint, fetched []models.Item) (items.IngestReport, error)
+	// LoadPodcast loads the transcripts and persons of the item
+	LoadPodcast(item *models.Item) error
+	// Known reports whether a fetched item is already stored for the feed
+	Known(feed models.Feed) func(item *gofeed.Item) bool
+}
+
+// EnclosureRepo stores the media files attached to items
+type EnclosureRepo interface {
+	ForItem(itemID uint) ([]models.Enclosure, error)
+	// SetLength stores the size of the enclosure, see items.IngestReport.Unsized
+	SetLength(id uint, length uint64) error
+}
+
+// Repos bundles the repositories sharing one database handle
+type Repos struct {
+	Feeds      FeedRepo
+	Items      ItemRepo
+	Enclosures EnclosureRepo
+}
+
+// New creates gorm backed repositories on top of db
+func New(db *gorm.DB) *Repos {
+	return &Repos{
+		Feeds:      &gormFeedRepo{db: db},
+		Items:      &gormItemRepo{db: db},
+		Enclosures: &gormEnclosureRepo{db: db},
+	}
+}
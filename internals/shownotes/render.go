@@ -0,0 +1,124 @@
+package shownotes
+
+import (
+	"html"
+	"strings"
+	"unicode/utf16"
+)
+
+// Split cuts the notes into parts of at most limit UTF-16 code units,
+// preferring paragraph, line and word boundaries. Entities crossing a cut
+// are split with it.
+func Split(n Notes, limit int) []Notes {
+	runes := []rune(n.Text)
+	// offsets[i] is the UTF-16 offset of runes[i]
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + utf16.RuneLen(r)
+	}
+
+	var parts []Notes
+	start := 0
+	for start < len(runes) {
+		end := start
+		for end < len(runes) && offsets[end+1]-offsets[start] <= limit {
+			end++
+		}
+		switch {
+		case end == start:
+			end++
+		case end < len(runes):
+			end = cutPoint(runes, start, end)
+		}
+		part := Notes{Text: strings.TrimRight(string(runes[start:end]), " \n")}
+		from, to := offsets[start], offsets[start]+utf16Len(part.Text)
+		for _, e := range n.Entities {
+			s, f := max(e.Offset, from), min(e.Offset+e.Length, to)
+			if s < f {
+				part.Entities = append(part.Entities, Entity{Type: e.Type, Offset: s - from, Length: f - s, URL: e.URL})
+			}
+		}
+		if part.Text != "" {
+			parts = append(parts, part)
+		}
+		// the next part does not start with the separator
+		for start = end; start < len(runes) && (runes[start] == '\n' || runes[start] == ' '); start++ {
+		}
+	}
+	return parts
+}
+
+// cutPoint returns where to cut runes[start:end] before end: at the last
+// paragraph break, line break or space, looked for in the second half of
+// the part first so that parts are not too short, else at end
+func cutPoint(runes []rune, start, end int) int {
+	for _, from := range []int{start + (end-start)/2, start} {
+		text := string(runes[from:end])
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(text, sep); i > 0 {
+				return from + len([]rune(text[:i]))
+			}
+		}
+	}
+	return end
+}
+
+var entityTags = map[string]string{
+	Bold:          "b",
+	Italic:        "i",
+	Underline:     "u",
+	Strikethrough: "s",
+	Code:          "code",
+	Pre:           "pre",
+	Blockquote:    "blockquote",
+	TextLink:      "a",
+}
+
+// HTML renders the notes as escaped HTML with their formatting, line
+// breaks become <br>. The entities must be nested as Parse makes them.
+func HTML(n Notes) string {
+	entities := append([]Entity(nil), n.Entities...)
+	sortEntities(entities)
+
+	var b strings.Builder
+	var stack []Entity
+	next := 0
+	pos := 0
+	closeUntil := func(pos int) {
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.Offset+top.Length > pos {
+				return
+			}
+			b.WriteString("</" + entityTags[top.Type] + ">")
+			stack = stack[:len(stack)-1]
+		}
+	}
+	for _, r := range n.Text {
+		closeUntil(pos)
+		for ; next < len(entities) && entities[next].Offset <= pos; next++ {
+			e := entities[next]
+			tag, ok := entityTags[e.Type]
+			if !ok || e.Offset < pos {
+				continue
+			}
+			if e.Type == TextLink {
+				b.WriteString(`<a href="` + html.EscapeString(e.URL) + `" rel="nofollow noopener">`)
+			} else {
+				b.WriteString("<" + tag + ">")
+			}
+			stack = append(stack, e)
+		}
+		if r == '\n' {
+			b.WriteString("<br>\n")
+		} else {
+			b.WriteString(html.EscapeString(string(r)))
+		}
+		pos += utf16.RuneLen(r)
+	}
+	closeUntil(pos)
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString("</" + entityTags[stack[i].Type] + ">")
+	}
+	return b.String()
+}
@@ -0,0 +1,301 @@
+package shownotes
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"golang.org/x/net/html"
+)
+
+// Show notes modes of a feed
+const (
+	// ModeOff publishes the caption only
+	ModeOff = ""
+	// ModeReply posts the show notes as replies to the audio message
+	ModeReply = "reply"
+	// ModePage links a generated page with the show notes from the caption
+	ModePage = "page"
+)
+
+// ValidMode reports an unknown show notes mode
+func ValidMode(mode string) error {
+	switch mode {
+	case ModeOff, ModeReply, ModePage:
+		return nil
+	}
+	return fmt.Errorf("unknown show notes mode %q, expected reply, page or empty", mode)
+}
+
+// Entity types, named as in the Telegram Bot API
+const (
+	Bold          = "bold"
+	Italic        = "italic"
+	Underline     = "underline"
+	Strikethrough = "strikethrough"
+	Code          = "code"
+	Pre           = "pre"
+	Blockquote    = "blockquote"
+	TextLink      = "text_link"
+)
+
+// Entity formats a part of the text. Offset and Length count UTF-16 code
+// units, like Telegram does.
+type Entity struct {
+	Type   string
+	Offset int
+	Length int
+	URL    string
+}
+
+// Notes is plain text with its formatting
+type Notes struct {
+	Text     string
+	Entities []Entity
+}
+
+// Len is the length of the text in UTF-16 code units
+func (n Notes) Len() int {
+	return utf16Len(n.Text)
+}
+
+func utf16Len(s string) int {
+	l := 0
+	for _, r := range s {
+		l += utf16.RuneLen(r)
+	}
+	return l
+}
+
+var tagEntities = map[string]string{
+	"b": Bold, "strong": Bold,
+	"i": Italic, "em": Italic, "cite": Italic,
+	"u": Underline, "ins": Underline,
+	"s": Strikethrough, "strike": Strikethrough, "del": Strikethrough,
+	"code": Code, "tt": Code,
+	"pre":        Pre,
+	"blockquote": Blockquote,
+}
+
+// blockBreaks is the number of line breaks around block elements
+var blockBreaks = map[string]int{
+	"p": 2, "h1": 2, "h2": 2, "h3": 2, "h4": 2, "h5": 2, "h6": 2,
+	"ul": 2, "ol": 2, "blockquote": 2, "pre": 2, "table": 2,
+	"div": 1, "li": 1, "tr": 1, "dt": 1, "dd": 1,
+}
+
+type open struct {
+	tag    string
+	entity Entity
+}
+
+type converter struct {
+	text     strings.Builder
+	pos      int
+	entities []Entity
+	stack    []open
+	skip     int
+	pre      int
+}
+
+// Parse converts HTML show notes to text and entities. Links are kept as
+// text links, block elements become line breaks and anything else is
+// reduced to its text. Plain text notes come out with their whitespace
+// collapsed.
+func Parse(source string) Notes {
+	var c converter
+	z := html.NewTokenizer(strings.NewReader(source))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return c.notes()
+		case html.TextToken:
+			if c.skip == 0 {
+				c.write(string(z.Text()))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			c.start(tok, tok.Type == html.SelfClosingTagToken)
+		case html.EndTagToken:
+			c.end(z.Token().Data)
+		}
+	}
+}
+
+func (c *converter) start(tok html.Token, selfClosing bool) {
+	tag := tok.Data
+	switch tag {
+	case "script", "style", "head", "title":
+		if !selfClosing {
+			c.skip++
+		}
+		return
+	case "br":
+		c.raw("\n")
+		return
+	case "hr":
+		c.breaks(2)
+		return
+	case "li":
+		c.breaks(1)
+		c.raw("• ")
+	case "pre":
+		c.pre++
+	}
+	if n, ok := blockBreaks[tag]; ok && tag != "li" {
+		c.breaks(n)
+	}
+	if selfClosing {
+		return
+	}
+	if tag == "a" {
+		href := attr(tok, "href")
+		if linkable(href) {
+			c.stack = append(c.stack, open{tag: tag, entity: Entity{Type: TextLink, Offset: c.pos, URL: href}})
+		}
+		return
+	}
+	if typ, ok := tagEntities[tag]; ok {
+		c.stack = append(c.stack, open{tag: tag, entity: Entity{Type: typ, Offset: c.pos}})
+	}
+}
+
+func (c *converter) end(tag string) {
+	switch tag {
+	case "script", "style", "head", "title":
+		if c.skip > 0 {
+			c.skip--
+		}
+		return
+	case "pre":
+		if c.pre > 0 {
+			c.pre--
+		}
+	}
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if c.stack[i].tag != tag {
+			continue
+		}
+		// close the elements left open inside this one too
+		for j := len(c.stack) - 1; j >= i; j-- {
+			c.close(c.stack[j].entity)
+		}
+		c.stack = c.stack[:i]
+		break
+	}
+	if n, ok := blockBreaks[tag]; ok {
+		c.breaks(n)
+	}
+}
+
+func (c *converter) close(e Entity) {
+	// line breaks of the blocks ending inside are left out
+	trailing := c.text.Len() - len(strings.TrimRight(c.text.String(), "\n"))
+	e.Length = c.pos - trailing - e.Offset
+	if e.Length > 0 {
+		c.entities = append(c.entities, e)
+	}
+}
+
+// write adds a text node, collapsing its whitespace outside of pre
+func (c *converter) write(s string) {
+	if c.pre > 0 {
+		c.raw(s)
+		return
+	}
+	var b strings.Builder
+	space := c.atLineStart() || c.endsWithSpace()
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+			continue
+		}
+		b.WriteRune(r)
+		space = false
+	}
+	c.raw(b.String())
+}
+
+func (c *converter) raw(s string) {
+	c.text.WriteString(s)
+	c.pos += utf16Len(s)
+}
+
+func (c *converter) atLineStart() bool {
+	s := c.text.String()
+	return s == "" || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, "• ")
+}
+
+func (c *converter) endsWithSpace() bool {
+	return strings.HasSuffix(c.text.String(), " ")
+}
+
+// breaks ends the text with at least n line breaks, none at the start
+func (c *converter) breaks(n int) {
+	s := c.text.String()
+	if s == "" {
+		return
+	}
+	have := len(s) - len(strings.TrimRight(s, "\n"))
+	for ; have < n; have++ {
+		c.raw("\n")
+	}
+}
+
+func (c *converter) notes() Notes {
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		c.close(c.stack[i].entity)
+	}
+	text := strings.TrimRightFunc(c.text.String(), unicode.IsSpace)
+	n := Notes{Text: text}
+	size := utf16Len(text)
+	for _, e := range c.entities {
+		if e.Offset >= size {
+			continue
+		}
+		if e.Offset+e.Length > size {
+			e.Length = size - e.Offset
+		}
+		n.Entities = append(n.Entities, e)
+	}
+	sortEntities(n.Entities)
+	return n
+}
+
+// sortEntities orders entities by offset, the outer one first
+func sortEntities(entities []Entity) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		if entities[i].Offset != entities[j].Offset {
+			return entities[i].Offset < entities[j].Offset
+		}
+		return entities[i].Length > entities[j].Length
+	})
+}
+
+func attr(tok html.Token, name string) string {
+	for _, a := range tok.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// linkable accepts the absolute links Telegram opens
+func linkable(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "tg", "mailto":
+		return true
+	}
+	return false
+}
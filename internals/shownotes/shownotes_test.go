@@ -0,0 +1,70 @@
+package shownotes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	n := Parse(`<p>Welcome to <b>episode   <i>42</i></b>!</p>
+<script>alert(1)</script>
+<ul><li>Guest: <a href="https://example.com/guest">Jane</a></li><li>Bad <a href="javascript:alert(1)">link</a></li></ul>
+<p>Naïve 🎧 line<br>next</p>`)
+
+	assert.Equal(t, "Welcome to episode 42!\n\n• Guest: Jane\n• Bad link\n\nNaïve 🎧 line\nnext", n.Text)
+	assert.Equal(t, []Entity{
+		{Type: Bold, Offset: 11, Length: 10},
+		{Type: Italic, Offset: 19, Length: 2},
+		{Type: TextLink, Offset: 33, Length: 4, URL: "https://example.com/guest"},
+	}, n.Entities)
+
+	plain := Parse("Just  text,\n\n  no tags & more")
+	assert.Equal(t, "Just text, no tags & more", plain.Text)
+	assert.Empty(t, plain.Entities)
+}
+
+func TestParse_UTF16Offsets(t *testing.T) {
+	n := Parse("🎧 <b>bold</b>")
+	assert.Equal(t, []Entity{{Type: Bold, Offset: 3, Length: 4}}, n.Entities, "the emoji counts two code units")
+	assert.Equal(t, 7, n.Len())
+}
+
+func TestParse_BlockquoteKeepsBreaksOutside(t *testing.T) {
+	n := Parse("<blockquote><p>Quote</p></blockquote><p>After</p>")
+	assert.Equal(t, "Quote\n\nAfter", n.Text)
+	assert.Equal(t, []Entity{{Type: Blockquote, Offset: 0, Length: 5}}, n.Entities)
+}
+
+func TestSplit(t *testing.T) {
+	n := Parse("<p>" + strings.Repeat("a", 6) + " <b>bold words</b></p><p>" + strings.Repeat("c", 8) + "</p>")
+	parts := Split(n, 14)
+	if assert.Len(t, parts, 3) {
+		assert.Equal(t, "aaaaaa bold", parts[0].Text)
+		assert.Equal(t, []Entity{{Type: Bold, Offset: 7, Length: 4}}, parts[0].Entities)
+		assert.Equal(t, "words", parts[1].Text)
+		assert.Equal(t, []Entity{{Type: Bold, Offset: 0, Length: 5}}, parts[1].Entities)
+		assert.Equal(t, "cccccccc", parts[2].Text)
+		assert.Empty(t, parts[2].Entities)
+	}
+	for _, part := range Split(Parse(strings.Repeat("🎧", 10)), 5) {
+		assert.LessOrEqual(t, part.Len(), 5)
+	}
+	assert.Len(t, Split(Notes{Text: "short"}, 4096), 1)
+	assert.Empty(t, Split(Notes{}, 4096))
+}
+
+func TestHTML(t *testing.T) {
+	n := Parse(`<p>Hi <b>there <a href="https://example.com/?a=1&amp;b=2">you</a></b> &lt;3</p><p>Bye</p>`)
+	assert.Equal(t, `Hi <b>there <a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener">you</a></b> &lt;3<br>
+<br>
+Bye`, HTML(n))
+}
+
+func TestValidMode(t *testing.T) {
+	assert.NoError(t, ValidMode(ModeOff))
+	assert.NoError(t, ValidMode(ModeReply))
+	assert.NoError(t, ValidMode(ModePage))
+	assert.Error(t, ValidMode("email"))
+}
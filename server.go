@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/tutuna/echopan/internals/api"
+	"github.com/tutuna/echopan/internals/dashboard"
+	"github.com/tutuna/echopan/internals/health"
+	"github.com/tutuna/echopan/internals/logging"
+	"gopkg.in/telebot.v3"
+)
+
+// startServer serves the service endpoints on service.listen in the background,
+// the HTTP API included when service.api_token is set and the admin dashboard
+// when service.admin_password is set
+func (a *app) startServer() {
+	listen := a.cfg.Service.Listen
+	if listen == "" {
+		return
+	}
+	go func() {
+		slog.Info("Serving metrics and health checks", "listen", listen)
+		if err := http.ListenAndServe(listen, a.serverMux()); err != nil {
+			slog.Error("Error serving metrics", "error", err)
+		}
+	}()
+}
+
+func (a *app) serverMux() *http.ServeMux {
+	stall := a.cfg.Service.StallTimeout
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", a.metrics.Handler())
+	mux.Handle("/notes/", a.notesHandler())
+	if token := a.cfg.Service.APIToken; token != "" {
+		mux.Handle("/api/", api.New(a.feeds, a.items, apiService{a}, token))
+	}
+	if password := a.cfg.Service.AdminPassword; password != "" {
+		mux.Handle("/admin/", dashboard.New(a.feeds, a.items, apiService{a}, dashboard.Options{
+			User:       a.cfg.Service.AdminUser,
+			Password:   password,
+			StaleAfter: a.cfg.Feeds.StaleAfter,
+		}))
+	}
+	mux.Handle("/healthz", health.Handler(5*time.Second,
+		health.LoopCheck(a.health, a.cfg.Service.Interval+stall),
+		health.DownloadCheck(a.health, stall),
+	))
+	mux.Handle("/readyz", health.Handler(15*time.Second,
+		health.DatabaseCheck(a.db),
+		health.CachedCheck(a.telegramCheck(), time.Minute),
+	))
+	return mux
+}
+
+// telegramCheck calls getMe to make sure the bot token works and the API is reachable
+func (a *app) telegramCheck() health.Check {
+	return health.Check{Name: "telegram", Run: func(ctx context.Context) error {
+		if a.cfg.Telegram.BotToken == "" {
+			return errors.New("EP_TG_BOT_TOKEN is not set")
+		}
+		bot, err := telebot.NewBot(telebot.Settings{
+			Token:   a.cfg.Telegram.BotToken,
+			URL:     a.cfg.Telegram.BotURL,
+			Client:  &http.Client{Timeout: 10 * time.Second},
+			Offline: true,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = bot.Raw("getMe", nil)
+		return err
+	}}
+}
+
+// refreshQueueDepth updates the queue depth gauges from the database
+func (a *app) refreshQueueDepth() {
+	all, err := a.feeds.All()
+	if err != nil {
+		slog.Error("Error getting feeds", "error", err)
+		return
+	}
+	for _, feed := range all {
+		stats, err := a.feeds.Stats(feed.ID)
+		if err != nil {
+			slog.Error("Error getting feed stats", logging.FeedID, feed.ID, "error", err)
+			continue
+		}
+		a.metrics.SetQueueDepth(feed.ID, stats.Unpublished)
+	}
+}
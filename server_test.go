@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestServerMux(t *testing.T) {
+	telegram := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botgood/getMe" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"echopan"}}`)
+	}))
+	defer telegram.Close()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{})
+	a := newApp(db)
+	a.cfg.Telegram.BotURL = telegram.URL
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		a.serverMux().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+	assert.Equal(t, http.StatusOK, get("/metrics").Code)
+
+	rec := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "EP_TG_BOT_TOKEN is not set")
+
+	a.cfg.Telegram.BotToken = "bad"
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+	a.cfg.Telegram.BotToken = "good"
+	assert.Equal(t, http.StatusOK, get("/readyz").Code)
+}
+
+func TestServerMux_API(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{})
+	a := newApp(db)
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		a.serverMux().ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, get().Code, "the API is off without a token")
+	a.cfg.Service.APIToken = "s3cret"
+	rec := get()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"publishing":false`)
+	assert.Contains(t, rec.Body.String(), `"downloads":[]`)
+
+	a.busy.Store(true)
+	assert.Contains(t, get().Body.String(), `"publishing":true`)
+}
+
+func TestServerMux_Dashboard(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{}, &models.Enclosure{})
+	a := newApp(db)
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/", nil)
+		req.SetBasicAuth("admin", "pa55word")
+		a.serverMux().ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, get().Code, "the dashboard is off without a password")
+	a.cfg.Service.AdminPassword = "pa55word"
+	assert.Equal(t, http.StatusOK, get().Code)
+}
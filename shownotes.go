@@ -0,0 +1,106 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tutuna/echopan/internals/logging"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/shownotes"
+	"gopkg.in/telebot.v3"
+)
+
+// itemShowNotes returns the richest show notes of the item, the longest of
+// its content, description and iTunes summary
+func itemShowNotes(item models.Item) shownotes.Notes {
+	var best shownotes.Notes
+	for _, source := range []string{item.Content, item.Description, item.ItunesSummary} {
+		if notes := shownotes.Parse(source); notes.Len() > best.Len() {
+			best = notes
+		}
+	}
+	return best
+}
+
+// showNotesMode returns the show notes mode of the feed. Pages need
+// service.public_url, without it the notes are posted as replies.
+func (a *app) showNotesMode(feed models.Feed) string {
+	if feed.ShowNotes == shownotes.ModePage && a.cfg.Service.PublicURL == "" {
+		slog.Warn("Show notes pages need service.public_url, posting replies", logging.FeedID, feed.ID)
+		return shownotes.ModeReply
+	}
+	return feed.ShowNotes
+}
+
+// notesURL is the public address of the show notes page of the item
+func (a *app) notesURL(item models.Item) string {
+	return strings.TrimRight(a.cfg.Service.PublicURL, "/") + "/notes/" + strconv.FormatUint(uint64(item.ID), 10)
+}
+
+// sendShowNotes posts the show notes as replies to the audio message, split
+// at the Telegram message limit
+func sendShowNotes(bot *telebot.Bot, chat *telebot.Chat, audio *telebot.Message, notes shownotes.Notes) error {
+	for _, part := range shownotes.Split(notes, messageLimit) {
+		entities := make(telebot.Entities, 0, len(part.Entities))
+		for _, e := range part.Entities {
+			entities = append(entities, telebot.MessageEntity{Type: telebot.EntityType(e.Type), Offset: e.Offset, Length: e.Length, URL: e.URL})
+		}
+		_, err := bot.Send(chat, part.Text, &telebot.SendOptions{ReplyTo: audio, Entities: entities, DisableWebPagePreview: true})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var notesPage = template.Must(template.New("notes").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>body{max-width:40em;margin:2em auto;padding:0 1em;font-family:sans-serif;line-height:1.5}</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Feed}}{{if .Link}} · <a href="{{.Link}}" rel="nofollow noopener">{{.Link}}</a>{{end}}</p>
+<div>{{.Notes}}</div>
+</body>
+</html>
+`))
+
+// notesHandler serves /notes/<item id>, the show notes pages of the items
+// of feeds in page mode
+func (a *app) notesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/notes/"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		item, err := a.items.Get(uint(id))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		feed, err := a.feeds.Get(uint(item.FeedId))
+		if err != nil || feed.ShowNotes != shownotes.ModePage {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = notesPage.Execute(w, map[string]interface{}{
+			"Title": item.Title,
+			"Feed":  feed.Title,
+			"Link":  item.Link,
+			// shownotes.HTML escapes the text and only emits its own tags
+			"Notes": template.HTML(shownotes.HTML(itemShowNotes(item))),
+		})
+		if err != nil {
+			slog.Warn("Error writing show notes page", logging.ItemID, item.ID, "error", err)
+		}
+	})
+}
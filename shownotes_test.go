@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutuna/echopan/internals/models"
+	"github.com/tutuna/echopan/internals/shownotes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestItemShowNotes(t *testing.T) {
+	item := models.Item{
+		Description:   "<p>Short</p>",
+		Content:       `<p>The <a href="https://example.com">long</a> notes</p>`,
+		ItunesSummary: "Summary",
+	}
+	notes := itemShowNotes(item)
+	assert.Equal(t, "The long notes", notes.Text)
+	assert.Equal(t, []shownotes.Entity{{Type: shownotes.TextLink, Offset: 4, Length: 4, URL: "https://example.com"}}, notes.Entities)
+}
+
+func TestItemCaption_ShowNotesPage(t *testing.T) {
+	a := newApp(nil)
+	feed := models.Feed{ShowNotes: shownotes.ModePage}
+	item := models.Item{Model: gorm.Model{ID: 7}, Title: "Pilot", ItunesSubtitle: "First one"}
+
+	assert.Equal(t, shownotes.ModeReply, a.showNotesMode(feed), "pages need a public url")
+	assert.Equal(t, "*Pilot*\n\nFirst one", a.itemCaption(feed, item))
+
+	a.cfg.Service.PublicURL = "https://echopan.example.com/"
+	assert.Equal(t, "*Pilot*\n\nFirst one\n\nhttps://echopan.example.com/notes/7", a.itemCaption(feed, item))
+
+	feed.CaptionTemplate = "{{.Title}} {{.NotesURL}}"
+	assert.Equal(t, "Pilot https://echopan.example.com/notes/7", a.itemCaption(feed, item))
+}
+
+func TestNotesPage(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.AutoMigrate(&models.Feed{}, &models.Item{}, &models.Enclosure{})
+	paged := models.Feed{Title: "Paged", Feed: "https://example.com/paged.xml", ShowNotes: shownotes.ModePage}
+	plain := models.Feed{Title: "Plain", Feed: "https://example.com/plain.xml"}
+	db.Create(&paged)
+	db.Create(&plain)
+	shown := models.Item{FeedId: int(paged.ID), Title: "Pilot <1>", Content: `<p>See <a href="https://example.com">this</a><script>alert(1)</script></p>`}
+	hidden := models.Item{FeedId: int(plain.ID), Title: "Hidden"}
+	db.Create(&shown)
+	db.Create(&hidden)
+	a := newApp(db)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		a.serverMux().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	rec := get("/notes/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<h1>Pilot &lt;1&gt;</h1>")
+	assert.Contains(t, rec.Body.String(), `See <a href="https://example.com" rel="nofollow noopener">this</a>`)
+	assert.NotContains(t, rec.Body.String(), "alert")
+
+	assert.Equal(t, http.StatusNotFound, get("/notes/2").Code, "the feed does not publish pages")
+	assert.Equal(t, http.StatusNotFound, get("/notes/3").Code)
+	assert.Equal(t, http.StatusNotFound, get("/notes/x").Code)
+}